@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/output"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+)
+
+// defaultBatchLinger How long a batch waits for more events when no linger is configured
+const defaultBatchLinger = 100 * time.Millisecond
+
+// batching Reports whether the workers of a component send in batches
+// Batching needs a batch size above one and an output implementing output.BatchOutput
+func batching(c Component) bool {
+	if c.Worker.Batch.Size <= 1 {
+		return false
+	}
+	if _, ok := c.Output.(output.BatchOutput); !ok {
+		logx.Warn("output of source %s does not support batching, sending events one by one", c.Name)
+		return false
+	}
+	return true
+}
+
+// eventBatch Collects events until a size or byte limit is reached
+type eventBatch struct {
+	cfg    config.BatchConfig
+	events []types.EventData
+	bytes  int
+}
+
+// full Reports whether adding an event of size bytes would exceed the byte limit
+func (b *eventBatch) full(size int) bool {
+	return b.cfg.Bytes > 0 && len(b.events) > 0 && b.bytes+size > b.cfg.Bytes
+}
+
+// add Appends an event and reports whether the batch reached its size limit
+func (b *eventBatch) add(event types.EventData, size int) bool {
+	b.events = append(b.events, event)
+	b.bytes += size
+	return len(b.events) >= b.cfg.Size
+}
+
+// take Returns the collected events and starts a new batch
+func (b *eventBatch) take() []types.EventData {
+	events := b.events
+	b.events = make([]types.EventData, 0, b.cfg.Size)
+	b.bytes = 0
+	return events
+}
+
+// eventSize Returns the JSON size of an event, only computed when a byte limit is set
+func eventSize(cfg config.BatchConfig, event types.EventData) int {
+	if cfg.Bytes <= 0 {
+		return 0
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// batchWorkerLoop Worker main loop sending events in batches
+// A batch is sent when it is full or its linger time has passed; its events are acknowledged
+// together once the batch was delivered, the remaining batch is sent when the channel closes.
+// A transaction marker is sent right away, the partitioner holds back the next events until it is settled.
+// pending: Told about every settled event, nil when the events do not come from the partitioner
+// Returns: An error when a batch could neither be delivered nor dead-lettered
+func batchWorkerLoop(ctx context.Context, id int, c Component, events <-chan types.EventData, pending *inflight) error {
+	cfg := c.Worker.Batch
+	linger := time.Duration(cfg.Linger) * time.Millisecond
+	if linger <= 0 {
+		linger = defaultBatchLinger
+	}
+	logx.Info("batching worker started, source: %s, workerID: %d, size: %d, bytes: %d, linger: %s", c.Name, id, cfg.Size, cfg.Bytes, linger)
+	batch := &eventBatch{cfg: cfg, events: make([]types.EventData, 0, cfg.Size)}
+	timer := time.NewTimer(linger)
+	timer.Stop()
+	defer timer.Stop()
+	flush := func() error {
+		timer.Stop()
+		if len(batch.events) == 0 {
+			return nil
+		}
+		batchEvents := batch.take()
+		firstAttempt := time.Now()
+		attempts, err := c.Retrier.SendBatch(ctx, batchEvents)
+		err = settle(ctx, id, c, batchEvents, attempts, err, firstAttempt)
+		pending.done(len(batchEvents))
+		return err
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				logx.Info("event channel closed, workerID: %d", id)
+				return flush()
+			}
+			if !accept(id, c, &event) {
+				pending.done(1)
+				continue
+			}
+			logx.Info("CDC Event: %+v", event)
+			size := eventSize(cfg, event)
+			if batch.full(size) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if len(batch.events) == 0 {
+				timer.Reset(linger)
+			}
+			if batch.add(event, size) || isTransactionMarker(event) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			logx.Info("context canceled, worker exiting, workerID: %d", id)
+			return nil
+		}
+	}
+}
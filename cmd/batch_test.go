@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/output"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// ackSource Records the tokens of acknowledged events
+type ackSource struct {
+	mu    sync.Mutex
+	acked []uint64
+}
+
+func (s *ackSource) WithStore(store.IStore)                   {}
+func (s *ackSource) Run(context.Context) error                { return nil }
+func (s *ackSource) GetChanEventData() <-chan types.EventData { return nil }
+func (s *ackSource) Close() error                             { return nil }
+func (s *ackSource) Ack(event types.EventData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, event.Token)
+	return nil
+}
+
+func (s *ackSource) tokens() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.acked...)
+}
+
+// batchRecorder Records the size of every batch, failing while err is set
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+	err     error
+}
+
+func (o *batchRecorder) Send(ctx context.Context, event types.EventData) error {
+	return o.SendBatch(ctx, []types.EventData{event})
+}
+
+func (o *batchRecorder) SendBatch(ctx context.Context, events []types.EventData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return o.err
+	}
+	o.batches = append(o.batches, len(events))
+	return nil
+}
+
+func (o *batchRecorder) Close() error { return nil }
+
+func (o *batchRecorder) sizes() []int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]int(nil), o.batches...)
+}
+
+func newBatchComponent(o output.IOutput, batch config.BatchConfig) (Component, *ackSource) {
+	src := &ackSource{}
+	return Component{
+		Source:  src,
+		Output:  o,
+		Retrier: output.NewRetrier(o, output.RetryConfig{MaxAttempts: 1}, output.BreakerConfig{}),
+		Worker:  config.WorkerConfig{Batch: batch},
+	}, src
+}
+
+func TestBatchWorkerLoop_SizeLimit(t *testing.T) {
+	o := &batchRecorder{}
+	c, src := newBatchComponent(o, config.BatchConfig{Size: 2, Linger: 60000})
+	assert.True(t, batching(c))
+
+	events := make(chan types.EventData, 5)
+	for i := uint64(1); i <= 5; i++ {
+		events <- newPartitionEvent("users", fmt.Sprint(i), i)
+	}
+	close(events)
+	assert.NoError(t, batchWorkerLoop(context.Background(), 0, c, events, nil))
+
+	assert.Equal(t, []int{2, 2, 1}, o.sizes())
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, src.tokens())
+}
+
+func TestBatchWorkerLoop_ByteLimit(t *testing.T) {
+	o := &batchRecorder{}
+	size := eventSize(config.BatchConfig{Bytes: 1}, newPartitionEvent("users", "1", 1))
+	c, _ := newBatchComponent(o, config.BatchConfig{Size: 100, Bytes: 2*size + 1, Linger: 60000})
+
+	events := make(chan types.EventData, 5)
+	for i := uint64(1); i <= 5; i++ {
+		events <- newPartitionEvent("users", "1", i)
+	}
+	close(events)
+	assert.NoError(t, batchWorkerLoop(context.Background(), 0, c, events, nil))
+
+	assert.Equal(t, []int{2, 2, 1}, o.sizes())
+}
+
+func TestBatchWorkerLoop_Linger(t *testing.T) {
+	o := &batchRecorder{}
+	c, src := newBatchComponent(o, config.BatchConfig{Size: 100, Linger: 10})
+
+	events := make(chan types.EventData, 1)
+	events <- newPartitionEvent("users", "1", 1)
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, batchWorkerLoop(context.Background(), 0, c, events, nil))
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(src.tokens()) == 1 }, time.Second, 5*time.Millisecond)
+	close(events)
+	<-done
+	assert.Equal(t, []int{1}, o.sizes())
+}
+
+func TestBatchWorkerLoop_FailedBatchStopsWorker(t *testing.T) {
+	o := &batchRecorder{err: fmt.Errorf("broker unavailable")}
+	c, src := newBatchComponent(o, config.BatchConfig{Size: 2, Linger: 60000})
+
+	events := make(chan types.EventData, 4)
+	for i := uint64(1); i <= 4; i++ {
+		events <- newPartitionEvent("users", fmt.Sprint(i), i)
+	}
+	close(events)
+	err := batchWorkerLoop(context.Background(), 0, c, events, nil)
+
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Empty(t, src.tokens())
+	assert.Len(t, events, 2, "the worker must stop at the first batch it cannot settle")
+}
+
+func TestBatchWorkerLoop_FailedBatchDeadLettered(t *testing.T) {
+	o := &batchRecorder{err: fmt.Errorf("broker unavailable")}
+	c, src := newBatchComponent(o, config.BatchConfig{Size: 2, Linger: 60000})
+	dlq := &captureOutput{}
+	c.DLQ = output.NewRetrier(dlq, output.RetryConfig{}, output.BreakerConfig{})
+
+	events := make(chan types.EventData, 2)
+	events <- newPartitionEvent("users", "1", 1)
+	events <- newPartitionEvent("users", "2", 2)
+	close(events)
+	assert.NoError(t, batchWorkerLoop(context.Background(), 0, c, events, nil))
+
+	assert.Len(t, dlq.events, 2)
+	assert.Equal(t, []uint64{1, 2}, src.tokens())
+}
+
+func TestBatching_RequiresBatchOutput(t *testing.T) {
+	c, _ := newBatchComponent(&captureOutput{}, config.BatchConfig{Size: 10})
+	assert.False(t, batching(c))
+	c, _ = newBatchComponent(&batchRecorder{}, config.BatchConfig{Size: 1})
+	assert.False(t, batching(c))
+}
@@ -18,6 +18,21 @@ func Before(ctx context.Context, command *cli.Command) (context.Context, error)
 	if err != nil {
 		return ctx, err
 	}
+	if startTime := command.String(FlagStartTime); startTime != "" {
+		applyStartTime(conf, startTime)
+	}
 	//Put the configuration into the context
 	return context.WithValue(ctx, ContextValueConfig, conf), nil
 }
+
+// applyStartTime Sets the start_time option of the MySQL source, of every entry of the sources list
+// and of the source of every pipeline
+func applyStartTime(conf *config.Config, startTime string) {
+	conf.Source.Mysql.StartTime = startTime
+	for i := range conf.Sources {
+		conf.Sources[i].Mysql.StartTime = startTime
+	}
+	for i := range conf.Pipelines {
+		conf.Pipelines[i].Source.Mysql.StartTime = startTime
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyStartTime(t *testing.T) {
+	const startTime = "2026-10-15 03:00:00"
+	conf := &config.Config{
+		Source: source.Config{Type: source.SourceTypeMysql},
+		Sources: []config.SourceConfig{
+			{Config: source.Config{Name: "orders", Type: source.SourceTypeMysql}},
+			{Config: source.Config{Name: "users", Type: source.SourceTypeMysql, Mysql: source.MysqlConfig{StartTime: "2026-01-01 00:00:00"}}},
+		},
+		Pipelines: []config.PipelineConfig{
+			{Name: "orders", Source: source.Config{Type: source.SourceTypeMysql}},
+			{Name: "users", Source: source.Config{Type: source.SourceTypeMysql}},
+		},
+	}
+	applyStartTime(conf, startTime)
+
+	assert.Equal(t, startTime, conf.Source.Mysql.StartTime)
+	sources, err := conf.SourceConfigs()
+	assert.NoError(t, err)
+	for _, sc := range sources {
+		assert.Equal(t, startTime, sc.Mysql.StartTime, sc.Name)
+	}
+	pipelines, err := conf.PipelineConfigs()
+	assert.NoError(t, err)
+	for _, pc := range pipelines {
+		assert.Equal(t, startTime, pc.Source.Mysql.StartTime, pc.Name)
+	}
+}
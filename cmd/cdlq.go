@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/output"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+	"github.com/urfave/cli/v3"
+)
+
+func DLQCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "dlq",
+		Usage: "Manage the dead-letter queue",
+		Commands: []*cli.Command{
+			{
+				Name:  "replay",
+				Usage: "Re-send the dead-lettered events to the outputs they were meant for",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfg, ok := ctx.Value(ContextValueConfig).(*config.Config)
+					if !ok {
+						return fmt.Errorf("config not found in context")
+					}
+					return ReplayDLQ(ctx, cfg)
+				},
+			},
+		},
+	}
+}
+
+// ReplayDLQ Re-sends every dead letter to the primary output of the source that captured it
+// Replay stops at the first event that still cannot be sent, it stays in the queue.
+func ReplayDLQ(ctx context.Context, cfg *config.Config) error {
+	if !cfg.DLQ.Enabled() {
+		return fmt.Errorf("no dead-letter queue configured")
+	}
+	outputs, err := newReplayOutputs(cfg)
+	if err != nil {
+		return err
+	}
+	defer outputs.close()
+	dlq, err := output.OpenDLQ(cfg.DLQ)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter queue: %w", err)
+	}
+	defer func() {
+		if err := dlq.Close(); err != nil {
+			logx.Error("failed to close dead-letter queue: %v", err)
+		}
+	}()
+	replayed, err := dlq.Replay(ctx, func(event types.EventData) error {
+		retrier, err := outputs.get(event.Source)
+		if err != nil {
+			return err
+		}
+		event.DeadLetter = nil
+		_, err = retrier.Send(ctx, event)
+		return err
+	})
+	logx.Info("replayed %d dead-lettered events", replayed)
+	if err != nil {
+		return fmt.Errorf("replay stopped after %d events: %w", replayed, err)
+	}
+	return nil
+}
+
+// replayOutputs Creates the primary output of each source on first use
+type replayOutputs struct {
+	// configs Output configuration by source or pipeline name
+	configs  map[string]output.Config
+	fallback output.Config
+	outputs  map[string]*output.Retrier
+}
+
+// newReplayOutputs Collects the output configuration of every source and pipeline
+func newReplayOutputs(cfg *config.Config) (*replayOutputs, error) {
+	r := &replayOutputs{
+		configs:  make(map[string]output.Config),
+		fallback: cfg.Output,
+		outputs:  make(map[string]*output.Retrier),
+	}
+	sources, err := cfg.SourceConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, sc := range sources {
+		if sc.Output.Type != "" {
+			r.configs[sc.Name] = sc.Output
+		}
+	}
+	pipelines, err := cfg.PipelineConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pc := range pipelines {
+		r.configs[pc.Name] = pc.Output
+	}
+	return r, nil
+}
+
+// get Returns the output of a source, the top-level output for unknown names
+func (r *replayOutputs) get(name string) (*output.Retrier, error) {
+	if _, ok := r.configs[name]; !ok {
+		name = ""
+	}
+	if o, ok := r.outputs[name]; ok {
+		return o, nil
+	}
+	oc, ok := r.configs[name]
+	if !ok {
+		oc = r.fallback
+	}
+	o, err := newRetrier(oc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output: %w", err)
+	}
+	r.outputs[name] = o
+	return o, nil
+}
+
+// close Closes the created outputs
+func (r *replayOutputs) close() {
+	for name, o := range r.outputs {
+		if err := o.Output().Close(); err != nil {
+			logx.Error("failed to close output %s: %v", name, err)
+		}
+	}
+}
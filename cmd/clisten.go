@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"github.com/chihqiang/dbxgo/config"
-	"github.com/chihqiang/dbxgo/output"
 	"github.com/chihqiang/dbxgo/source"
+	"github.com/chihqiang/dbxgo/types"
 	"github.com/chihqiang/logx"
 	"github.com/urfave/cli/v3"
 	"runtime"
+	"sync"
+	"time"
 )
 
 func ListenCommand() *cli.Command {
@@ -28,24 +30,75 @@ func ListenCommand() *cli.Command {
 }
 
 // Listen starts the entire CDC listening process, including data source, storage, and output handling
+// Every source runs with its own worker pool, the first one that fails stops the others
+// Pipelines, when configured, are supervised instead, see ListenPipelines
 func Listen(ctx context.Context, config *config.Config) error {
-	iSource, iStore, iOutput, err := SetupComponents(config)
+	if len(config.Pipelines) > 0 {
+		return ListenPipelines(ctx, config)
+	}
+	iStore, components, err := SetupComponents(config)
 	if err != nil {
 		return err
 	}
-	defer CloseSetupComponents(iSource, iStore, iOutput)
+	defer CloseSetupComponents(iStore, components)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	sourceErrChan := startSource(ctx, iSource)
-	workerCount := runtime.NumCPU()
-	startWorkers(ctx, iSource, iOutput, workerCount)
-	if err := waitSourceError(sourceErrChan); err != nil {
-		return err
+	errChan := make(chan error, len(components))
+	for _, c := range components {
+		go func(c Component) {
+			errChan <- runComponent(ctx, c)
+		}(c)
+	}
+	var firstErr error
+	for range components {
+		if err := <-errChan; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	if firstErr != nil {
+		return firstErr
 	}
 	logx.Info("CDC process completed successfully")
 	return nil
 }
 
+// runComponent Runs one source with its worker pool until the source stops or a worker fails
+// The workers have exited when it returns, so the source and output can be closed safely
+func runComponent(ctx context.Context, c Component) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sourceErrChan := startSource(ctx, c.Source)
+	workers := startWorkers(ctx, c)
+	select {
+	case err, ok := <-sourceErrChan:
+		if ok && err != nil {
+			cancel()
+			_ = workers.Wait()
+			return componentError(c, err)
+		}
+	case <-workers.failed:
+		// An event could neither be delivered nor dead-lettered, stop before the checkpoint falls further behind
+		cancel()
+		_ = waitSourceError(sourceErrChan)
+		return componentError(c, workers.Wait())
+	}
+	// A finite source (e.g. binlog file replay) closes its channel when done, let the workers drain it
+	logx.Info("source %s finished, waiting for workers to deliver the remaining events", c.Name)
+	if err := workers.Wait(); err != nil {
+		return componentError(c, err)
+	}
+	return nil
+}
+
+// componentError Prefixes an error with the component name, when it has one
+func componentError(c Component, err error) error {
+	if c.Name != "" {
+		return fmt.Errorf("source %s: %w", c.Name, err)
+	}
+	return err
+}
+
 // Start Source and return the error channel
 func startSource(ctx context.Context, iSource source.ISource) <-chan error {
 	errChan := make(chan error, 1)
@@ -60,35 +113,170 @@ func startSource(ctx context.Context, iSource source.ISource) <-chan error {
 	return errChan
 }
 
+// workerPool Workers of a component
+type workerPool struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	// err First error a worker stopped with
+	err error
+	// failed Closed once a worker stopped with an error
+	failed chan struct{}
+}
+
+// run Starts a worker, its error is recorded and signaled through failed
+func (p *workerPool) run(loop func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if err := loop(); err != nil {
+			p.once.Do(func() {
+				p.err = err
+				close(p.failed)
+			})
+		}
+	}()
+}
+
+// Wait Waits until every worker has exited
+// Returns: The first error a worker stopped with
+func (p *workerPool) Wait() error {
+	p.wg.Wait()
+	return p.err
+}
+
 // Start the worker pool
-func startWorkers(ctx context.Context, iSource source.ISource, iOutput output.IOutput, workerCount int) {
-	for i := 0; i < workerCount; i++ {
-		go workerLoop(ctx, i, iSource, iOutput)
+// Unless partitioning is disabled, every worker owns a lane so events of the same row are sent in order,
+// and transaction markers are kept in order with the rows of their transaction
+// The returned pool is done once every worker has exited
+func startWorkers(ctx context.Context, c Component) *workerPool {
+	cfg := c.Worker
+	workerCount := cfg.Count
+	if workerCount <= 0 {
+		workerCount = runtime.NumCPU()
+	}
+	mode := cfg.Partition
+	if mode == "" {
+		mode = config.PartitionModePrimaryKey
+	}
+	loop := workerLoop
+	if batching(c) {
+		loop = batchWorkerLoop
+	}
+	pool := &workerPool{failed: make(chan struct{})}
+	if mode == config.PartitionModeNone {
+		for i := 0; i < workerCount; i++ {
+			pool.run(func() error {
+				return loop(ctx, i, c, c.Source.GetChanEventData(), nil)
+			})
+		}
+		logx.Info("started all workers, source: %s, count: %d, partition: %s", c.Name, workerCount, mode)
+		return pool
+	}
+	lanes := make([]chan types.EventData, workerCount)
+	pending := newInflight()
+	for i := range lanes {
+		lanes[i] = make(chan types.EventData, laneBufferSize)
+		pool.run(func() error {
+			return loop(ctx, i, c, lanes[i], pending)
+		})
 	}
-	logx.Info("started all workers, count: %d", workerCount)
+	go partitionEvents(ctx, mode, c.Source.GetChanEventData(), lanes, pending)
+	logx.Info("started all workers, source: %s, count: %d, partition: %s", c.Name, workerCount, mode)
+	return pool
 }
 
 // Worker main loop
-func workerLoop(ctx context.Context, id int, iSource source.ISource, iOutput output.IOutput) {
-	logx.Info("worker started, workerID: %d", id)
+// The component name is stamped into every event, events rejected by its filter are only acknowledged
+// pending: Told about every settled event, nil when the events do not come from the partitioner
+// Returns: An error when an event could neither be delivered nor dead-lettered
+func workerLoop(ctx context.Context, id int, c Component, events <-chan types.EventData, pending *inflight) error {
+	logx.Info("worker started, source: %s, workerID: %d", c.Name, id)
 	for {
 		select {
-		case event, ok := <-iSource.GetChanEventData():
+		case event, ok := <-events:
 			if !ok {
 				logx.Info("event channel closed, workerID: %d", id)
-				return
+				return nil
+			}
+			if !accept(id, c, &event) {
+				pending.done(1)
+				continue
 			}
 			logx.Info("CDC Event: %+v", event)
-			if err := output.SendWithRetry(ctx, iOutput, event, 3); err != nil {
-				logx.Error("failed to send event, workerID: %d, error: %v", id, err)
+			firstAttempt := time.Now()
+			attempts, err := c.Retrier.Send(ctx, event)
+			err = settle(ctx, id, c, []types.EventData{event}, attempts, err, firstAttempt)
+			pending.done(1)
+			if err != nil {
+				return err
 			}
 		case <-ctx.Done():
 			logx.Info("context canceled, worker exiting, workerID: %d", id)
-			return
+			return nil
 		}
 	}
 }
 
+// accept Stamps the component name into the event and applies the filter
+// Returns: false when the filter rejected the event, it has then been acknowledged
+func accept(id int, c Component, event *types.EventData) bool {
+	event.Source = c.Name
+	if c.Filter == nil || c.Filter.Match(*event) {
+		return true
+	}
+	if err := c.Source.Ack(*event); err != nil {
+		logx.Error("failed to acknowledge event, workerID: %d, error: %v", id, err)
+	}
+	return false
+}
+
+// settle Acknowledges sent events, failed ones are dead-lettered first
+// Events that cannot be dead-lettered stay unacknowledged so the checkpoint holds and they are replayed after a restart
+// Returns: An error when an event could neither be delivered nor dead-lettered, unless ctx is done,
+// the worker must stop then since the checkpoint cannot move past the event anymore
+func settle(ctx context.Context, id int, c Component, events []types.EventData, attempts int, sendErr error, firstAttempt time.Time) error {
+	if sendErr != nil {
+		logx.Error("failed to send %d events after %d attempts, workerID: %d, error: %v", len(events), attempts, id, sendErr)
+	}
+	var stuck error
+	for _, event := range events {
+		if sendErr != nil {
+			if err := deadLetter(ctx, c, event, sendErr, attempts, firstAttempt); err != nil {
+				logx.Error("failed to dead-letter event, workerID: %d, error: %v", id, err)
+				if stuck == nil && ctx.Err() == nil {
+					stuck = fmt.Errorf("event %s.%s could not be delivered (%w) nor dead-lettered (%w)", event.Row.Database, event.Row.Table, sendErr, err)
+				}
+				continue
+			}
+		}
+		if err := c.Source.Ack(event); err != nil {
+			logx.Error("failed to acknowledge event, workerID: %d, error: %v", id, err)
+		}
+	}
+	return stuck
+}
+
+// deadLetter Sends an event that exhausted its retries to the dead-letter queue
+// The event may be acknowledged once it returns nil
+func deadLetter(ctx context.Context, c Component, event types.EventData, sendErr error, attempts int, firstAttempt time.Time) error {
+	if c.DLQ == nil {
+		return fmt.Errorf("no dead-letter queue configured")
+	}
+	if ctx.Err() != nil {
+		// The send was interrupted by shutdown, the event is sent again after a restart
+		return ctx.Err()
+	}
+	event.DeadLetter = &types.DeadLetter{
+		Error:          sendErr.Error(),
+		Attempts:       attempts,
+		FirstAttemptAt: firstAttempt,
+		FailedAt:       time.Now(),
+		Output:         c.OutputName,
+	}
+	_, err := c.DLQ.Send(ctx, event)
+	return err
+}
+
 // Waiting for data source error signal
 func waitSourceError(errChan <-chan error) error {
 	if err, ok := <-errChan; ok && err != nil {
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/output"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureOutput Keeps the events it receives
+type captureOutput struct {
+	events []types.EventData
+}
+
+func (o *captureOutput) Send(ctx context.Context, event types.EventData) error {
+	o.events = append(o.events, event)
+	return nil
+}
+
+func (o *captureOutput) Close() error { return nil }
+
+func TestDeadLetter_WrapsEvent(t *testing.T) {
+	dlq := &captureOutput{}
+	c := Component{Name: "orders", OutputName: "kafka", DLQ: output.NewRetrier(dlq, output.RetryConfig{}, output.BreakerConfig{})}
+	first := time.Now().Add(-time.Second)
+
+	err := deadLetter(context.Background(), c, newPartitionEvent("orders", "1", 7), fmt.Errorf("broker unavailable"), 4, first)
+	assert.NoError(t, err)
+	if assert.Len(t, dlq.events, 1) {
+		dl := dlq.events[0].DeadLetter
+		assert.Equal(t, "broker unavailable", dl.Error)
+		assert.Equal(t, 4, dl.Attempts)
+		assert.Equal(t, "kafka", dl.Output)
+		assert.Equal(t, first, dl.FirstAttemptAt)
+		assert.False(t, dl.FailedAt.Before(first))
+	}
+}
+
+func TestDeadLetter_SkipsWithoutQueueOrOnShutdown(t *testing.T) {
+	event := newPartitionEvent("orders", "1", 7)
+	assert.Error(t, deadLetter(context.Background(), Component{}, event, fmt.Errorf("boom"), 1, time.Now()))
+
+	dlq := &captureOutput{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, deadLetter(ctx, Component{DLQ: output.NewRetrier(dlq, output.RetryConfig{}, output.BreakerConfig{})}, event, fmt.Errorf("boom"), 1, time.Now()))
+	assert.Empty(t, dlq.events)
+}
+
+// streamSource Emits the events of its channel until it is stopped
+type streamSource struct {
+	ackSource
+	events chan types.EventData
+}
+
+func (s *streamSource) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *streamSource) GetChanEventData() <-chan types.EventData { return s.events }
+
+func TestRunComponent_StopsWhenEventIsStuck(t *testing.T) {
+	for _, partition := range []config.PartitionMode{config.PartitionModePrimaryKey, config.PartitionModeNone} {
+		t.Run(string(partition), func(t *testing.T) {
+			src := &streamSource{events: make(chan types.EventData, 1)}
+			src.events <- newPartitionEvent("users", "1", 1)
+			o := &batchRecorder{err: fmt.Errorf("broker unavailable")}
+			c := Component{
+				Name:    "orders",
+				Source:  src,
+				Output:  o,
+				Retrier: output.NewRetrier(o, output.RetryConfig{MaxAttempts: 1}, output.BreakerConfig{}),
+				Worker:  config.WorkerConfig{Count: 2, Partition: partition},
+			}
+
+			errChan := make(chan error, 1)
+			go func() { errChan <- runComponent(context.Background(), c) }()
+			select {
+			case err := <-errChan:
+				assert.ErrorContains(t, err, "source orders")
+				assert.ErrorContains(t, err, "broker unavailable")
+			case <-time.After(5 * time.Second):
+				t.Fatal("component kept running with an event it can neither deliver nor dead-letter")
+			}
+			assert.Empty(t, src.tokens())
+		})
+	}
+}
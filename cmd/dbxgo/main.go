@@ -30,6 +30,7 @@ func main() {
 	app.Before = cmd.Before
 	app.Commands = []*cli.Command{
 		cmd.ListenCommand(),
+		cmd.DLQCommand(),
 	}
 	app.Action = func(ctx context.Context, command *cli.Command) error {
 		listenCmd := cmd.ListenCommand()
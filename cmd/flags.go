@@ -4,6 +4,8 @@ import "github.com/urfave/cli/v3"
 
 const (
 	FlagConfig = "config"
+	// FlagStartTime Overrides the start_time option of every MySQL source
+	FlagStartTime = "start-time"
 )
 
 func Flags() []cli.Flag {
@@ -14,5 +16,9 @@ func Flags() []cli.Flag {
 			Usage:   "Load configuration from `FILE`",
 			Value:   "config.yml",
 		},
+		&cli.StringFlag{
+			Name:  FlagStartTime,
+			Usage: "Start the MySQL source from the first transaction at or after `TIME` (RFC3339 or \"2006-01-02 15:04:05\" UTC), replacing the stored position",
+		},
 	}
 }
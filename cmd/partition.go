@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+)
+
+// laneBufferSize Capacity of each worker lane channel
+const laneBufferSize = 1024
+
+// laneIndex Picks the worker lane for an event
+// Events with the same database, table (and primary key in primary_key mode) always map to the same lane
+func laneIndex(mode config.PartitionMode, event types.EventData, lanes int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(event.Row.Database))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(event.Row.Table))
+	// Tables without a primary key fall back to per-table ordering
+	if mode == config.PartitionModePrimaryKey && event.PartitionKey != "" {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(event.PartitionKey))
+	}
+	return int(h.Sum64() % uint64(lanes))
+}
+
+// inflight Counts the events handed to the worker lanes that the workers have not settled yet
+type inflight struct {
+	mu    sync.Mutex
+	count int
+	// drained Closed while no event is in flight
+	drained chan struct{}
+}
+
+// newInflight Creates a counter with no event in flight
+func newInflight() *inflight {
+	f := &inflight{drained: make(chan struct{})}
+	close(f.drained)
+	return f
+}
+
+// add Counts an event handed to a lane
+func (f *inflight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.count == 0 {
+		f.drained = make(chan struct{})
+	}
+	f.count++
+}
+
+// done Counts n events settled by a worker, a nil counter ignores them
+func (f *inflight) done(n int) {
+	if f == nil || n == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count -= n
+	if f.count == 0 {
+		close(f.drained)
+	}
+}
+
+// wait Blocks until every event handed to the lanes has been settled
+// Returns: The error of ctx when it is done first
+func (f *inflight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	drained := f.drained
+	f.mu.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransactionMarker Reports whether an event is a begin or commit marker
+func isTransactionMarker(event types.EventData) bool {
+	return event.Row.Type == types.BeginEventRowType || event.Row.Type == types.CommitEventRowType
+}
+
+// partitionEvents Distributes events from the source channel onto dedicated lanes
+// Transaction markers span every lane their rows are spread over, so a marker is sent on its own:
+// the events before it are settled first, and the events after it wait until it is settled.
+// A begin marker thus reaches the output before the rows of its transaction, a commit marker after them.
+// The lanes are closed once the source channel is closed or the context is canceled
+func partitionEvents(ctx context.Context, mode config.PartitionMode, in <-chan types.EventData, lanes []chan types.EventData, pending *inflight) {
+	defer func() {
+		for _, lane := range lanes {
+			close(lane)
+		}
+	}()
+	dispatch := func(event types.EventData) bool {
+		pending.add()
+		select {
+		case lanes[laneIndex(mode, event, len(lanes))] <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		select {
+		case event, ok := <-in:
+			if !ok {
+				logx.Info("event channel closed, partitioner exiting")
+				return
+			}
+			if !isTransactionMarker(event) {
+				if !dispatch(event) {
+					return
+				}
+				continue
+			}
+			if pending.wait(ctx) != nil || !dispatch(event) || pending.wait(ctx) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPartitionEvent(table, key string, token uint64) types.EventData {
+	return types.EventData{
+		PartitionKey: key,
+		Token:        token,
+		Row:          types.EventRowData{Database: "dbxgo", Table: table},
+	}
+}
+
+func TestLaneIndex_SameRowSameLane(t *testing.T) {
+	a := laneIndex(config.PartitionModePrimaryKey, newPartitionEvent("users", "1", 1), 8)
+	b := laneIndex(config.PartitionModePrimaryKey, newPartitionEvent("users", "1", 2), 8)
+	assert.Equal(t, a, b)
+}
+
+func TestLaneIndex_TableModeIgnoresKey(t *testing.T) {
+	lanes := map[int]struct{}{}
+	for i := 0; i < 100; i++ {
+		lanes[laneIndex(config.PartitionModeTable, newPartitionEvent("users", fmt.Sprint(i), 0), 8)] = struct{}{}
+	}
+	assert.Len(t, lanes, 1)
+}
+
+func TestLaneIndex_PrimaryKeySpreadsRows(t *testing.T) {
+	lanes := map[int]struct{}{}
+	for i := 0; i < 100; i++ {
+		lanes[laneIndex(config.PartitionModePrimaryKey, newPartitionEvent("users", fmt.Sprint(i), 0), 8)] = struct{}{}
+	}
+	assert.Greater(t, len(lanes), 1)
+}
+
+func TestPartitionEvents_KeepsRowOrder(t *testing.T) {
+	in := make(chan types.EventData, 100)
+	lanes := make([]chan types.EventData, 4)
+	for i := range lanes {
+		lanes[i] = make(chan types.EventData, 100)
+	}
+	for i := uint64(1); i <= 30; i++ {
+		in <- newPartitionEvent("users", fmt.Sprint(i%3), i)
+	}
+	close(in)
+	partitionEvents(context.Background(), config.PartitionModePrimaryKey, in, lanes, newInflight())
+
+	last := map[string]uint64{}
+	for _, lane := range lanes {
+		for event := range lane {
+			assert.Greater(t, event.Token, last[event.PartitionKey])
+			last[event.PartitionKey] = event.Token
+		}
+	}
+	assert.Len(t, last, 3)
+}
+
+func TestPartitionEvents_MarkersWaitForRows(t *testing.T) {
+	in := make(chan types.EventData, 10)
+	lanes := make([]chan types.EventData, 4)
+	for i := range lanes {
+		lanes[i] = make(chan types.EventData, 10)
+	}
+	begin := types.EventData{Token: 1, Row: types.EventRowData{Type: types.BeginEventRowType}}
+	commit := types.EventData{Token: 4, Row: types.EventRowData{Type: types.CommitEventRowType}}
+	in <- begin
+	in <- newPartitionEvent("users", "1", 2)
+	in <- newPartitionEvent("orders", "9", 3)
+	in <- commit
+	close(in)
+	pending := newInflight()
+	done := make(chan struct{})
+	go func() {
+		partitionEvents(context.Background(), config.PartitionModePrimaryKey, in, lanes, pending)
+		close(done)
+	}()
+
+	// receive Returns the next event dispatched to any lane
+	receive := func() (types.EventData, bool) {
+		deadline := time.Now().Add(20 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			for _, lane := range lanes {
+				select {
+				case event := <-lane:
+					return event, true
+				default:
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return types.EventData{}, false
+	}
+
+	event, ok := receive()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), event.Token)
+	_, ok = receive()
+	assert.False(t, ok, "rows must wait until the begin marker is settled")
+
+	pending.done(1)
+	var rows []uint64
+	for i := 0; i < 2; i++ {
+		event, ok := receive()
+		assert.True(t, ok)
+		rows = append(rows, event.Token)
+	}
+	assert.ElementsMatch(t, []uint64{2, 3}, rows)
+
+	pending.done(1)
+	_, ok = receive()
+	assert.False(t, ok, "the commit marker must wait until every row is settled")
+
+	pending.done(1)
+	event, ok = receive()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), event.Token)
+	pending.done(1)
+	<-done
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/filter"
+	"github.com/chihqiang/dbxgo/output"
+	"github.com/chihqiang/dbxgo/source"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/logx"
+)
+
+const (
+	// defaultInitialBackoff Delay before the first restart of a failed pipeline
+	defaultInitialBackoff = time.Second
+	// defaultMaxBackoff Upper limit of the restart delay
+	defaultMaxBackoff = time.Minute
+)
+
+// ListenPipelines Runs every configured pipeline in one process
+// Each pipeline has its own source, store namespace, filter, output and worker pool.
+// A failing pipeline is restarted with backoff while the others keep running;
+// it returns once every pipeline has finished or given up.
+func ListenPipelines(ctx context.Context, cfg *config.Config) error {
+	pipelines, err := cfg.PipelineConfigs()
+	if err != nil {
+		return err
+	}
+	iStore, err := store.NewStore(cfg.Store)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	defer func() {
+		if err := iStore.Close(); err != nil {
+			logx.Error("failed to close store: %v", err)
+		}
+	}()
+	dlq, err := newDLQ(cfg.DLQ)
+	if err != nil {
+		return err
+	}
+	if dlq != nil {
+		defer func() {
+			if err := dlq.Output().Close(); err != nil {
+				logx.Error("failed to close dead-letter queue: %v", err)
+			}
+		}()
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(pipelines))
+	for i, pc := range pipelines {
+		wg.Add(1)
+		go func(i int, pc config.PipelineConfig) {
+			defer wg.Done()
+			errs[i] = supervise(ctx, pc.Name, pc.Restart, func(ctx context.Context) error {
+				return runPipeline(ctx, iStore, dlq, pc)
+			})
+		}(i, pc)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	logx.Info("all pipelines completed successfully")
+	return nil
+}
+
+// runPipeline Builds a pipeline, runs it until it stops and closes it again
+func runPipeline(ctx context.Context, iStore store.IStore, dlq *output.Retrier, pc config.PipelineConfig) error {
+	c, err := SetupPipeline(iStore, dlq, pc)
+	if err != nil {
+		return err
+	}
+	defer closeComponent(c)
+	return runComponent(ctx, c)
+}
+
+// SetupPipeline Creates the source, filter and output of a pipeline
+// iStore: Shared store, the pipeline uses its own namespace of it
+// dlq: Shared dead-letter queue, nil when disabled
+// pc: Pipeline configuration with defaults applied
+func SetupPipeline(iStore store.IStore, dlq *output.Retrier, pc config.PipelineConfig) (Component, error) {
+	f, err := filter.New(pc.Filter)
+	if err != nil {
+		return Component{}, fmt.Errorf("invalid filter of pipeline %s: %w", pc.Name, err)
+	}
+	iSource, err := source.NewSource(pc.Source)
+	if err != nil {
+		return Component{}, fmt.Errorf("failed to create source of pipeline %s: %w", pc.Name, err)
+	}
+	iSource.WithStore(store.NewNamespaceStore(iStore, pc.Namespace))
+	retrier, err := newRetrier(pc.Output)
+	if err != nil {
+		_ = iSource.Close()
+		return Component{}, fmt.Errorf("failed to create output of pipeline %s: %w", pc.Name, err)
+	}
+	return Component{
+		Name:       pc.Name,
+		Source:     iSource,
+		Output:     retrier.Output(),
+		Retrier:    retrier,
+		OutputName: outputName(pc.Output),
+		DLQ:        dlq,
+		Filter:     f,
+		Worker:     pc.Worker,
+	}, nil
+}
+
+// closeComponent Closes the source and output of a component, the shared dead-letter queue stays open
+func closeComponent(c Component) {
+	if err := c.Source.Close(); err != nil {
+		logx.Error("failed to close source %s: %v", c.Name, err)
+	}
+	if err := c.Output.Close(); err != nil {
+		logx.Error("failed to close output %s: %v", c.Name, err)
+	}
+}
+
+// supervise Runs attempt until it succeeds, restarting it with exponential backoff when it fails
+// The backoff is reset once an attempt has run longer than the maximum delay.
+// name: Pipeline name used in logs and errors
+// cfg: Restart policy
+// Returns: nil when an attempt succeeds or ctx is canceled, the last error once MaxRestarts is exceeded
+func supervise(ctx context.Context, name string, cfg config.RestartConfig, attempt func(context.Context) error) error {
+	initial, maxDelay := defaultInitialBackoff, defaultMaxBackoff
+	if cfg.InitialBackoff > 0 {
+		initial = time.Duration(cfg.InitialBackoff) * time.Second
+	}
+	if cfg.MaxBackoff > 0 {
+		maxDelay = time.Duration(cfg.MaxBackoff) * time.Second
+	}
+	return superviseWithBackoff(ctx, name, cfg.MaxRestarts, initial, maxDelay, attempt)
+}
+
+// superviseWithBackoff Implements supervise with explicit delays
+func superviseWithBackoff(ctx context.Context, name string, maxRestarts int, initial, maxDelay time.Duration, attempt func(context.Context) error) error {
+	delay := initial
+	restarts := 0
+	for {
+		started := time.Now()
+		err := attempt(ctx)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(started) >= maxDelay {
+			delay, restarts = initial, 0
+		}
+		if maxRestarts > 0 && restarts >= maxRestarts {
+			return fmt.Errorf("pipeline %s gave up after %d restarts: %w", name, restarts, err)
+		}
+		restarts++
+		logx.Error("pipeline %s failed, restarting in %s (restart %d): %v", name, delay, restarts, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervise_RestartsUntilSuccess(t *testing.T) {
+	attempts := 0
+	err := superviseWithBackoff(context.Background(), "orders", 0, time.Millisecond, 4*time.Millisecond, func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestSupervise_GivesUpAfterMaxRestarts(t *testing.T) {
+	attempts := 0
+	err := superviseWithBackoff(context.Background(), "orders", 2, time.Millisecond, 4*time.Millisecond, func(context.Context) error {
+		attempts++
+		return fmt.Errorf("connection refused")
+	})
+	assert.ErrorContains(t, err, "pipeline orders gave up after 2 restarts")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestSupervise_StopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := superviseWithBackoff(ctx, "orders", 0, time.Hour, time.Hour, func(context.Context) error {
+		attempts++
+		cancel()
+		return fmt.Errorf("context canceled")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+}
@@ -3,40 +3,144 @@ package cmd
 import (
 	"fmt"
 	"github.com/chihqiang/dbxgo/config"
+	"github.com/chihqiang/dbxgo/filter"
 	"github.com/chihqiang/dbxgo/output"
 	"github.com/chihqiang/dbxgo/source"
 	"github.com/chihqiang/dbxgo/store"
 	"github.com/chihqiang/logx"
 )
 
-// SetupComponents components: Store, Source, Output
-func SetupComponents(cfg *config.Config) (source.ISource, store.IStore, output.IOutput, error) {
+// Component A source together with the output its events are sent to
+type Component struct {
+	// Name Source name, empty for a single unnamed source
+	Name   string
+	Source source.ISource
+	Output output.IOutput
+	// Retrier Sends to Output following its retry policy and circuit breaker
+	Retrier *output.Retrier
+	// OutputName Type of the output, recorded in dead letters
+	OutputName string
+	// DLQ Dead-letter queue of the events the output rejects, nil leaves them unacknowledged
+	DLQ *output.Retrier
+	// Filter Events it rejects are acknowledged without being sent, nil keeps every event
+	Filter *filter.Filter
+	// Worker Worker pool settings of the component
+	Worker config.WorkerConfig
+}
+
+// SetupComponents components: Store, Sources, Outputs
+// Every source gets the store namespaced by its name, sources without their own output share one
+func SetupComponents(cfg *config.Config) (store.IStore, []Component, error) {
+	sourceConfigs, err := cfg.SourceConfigs()
+	if err != nil {
+		return nil, nil, err
+	}
 	iStore, err := store.NewStore(cfg.Store)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create store: %w", err)
+		return nil, nil, fmt.Errorf("failed to create store: %w", err)
 	}
-	iSource, err := source.NewSource(cfg.Source)
+	dlq, err := newDLQ(cfg.DLQ)
+	if err != nil {
+		_ = iStore.Close()
+		return nil, nil, err
+	}
+	// The dead-letter queue is closed with the components, or on its own while there are none
+	closeAll := func(components []Component) {
+		if len(components) == 0 && dlq != nil {
+			_ = dlq.Output().Close()
+		}
+		CloseSetupComponents(iStore, components)
+	}
+	var components []Component
+	var shared *output.Retrier
+	for _, sc := range sourceConfigs {
+		iSource, err := source.NewSource(sc.Config)
+		if err != nil {
+			closeAll(components)
+			return nil, nil, fmt.Errorf("failed to create source %s: %w", sc.Name, err)
+		}
+		iSource.WithStore(store.NewNamespaceStore(iStore, sc.Name))
+		component := Component{Name: sc.Name, Source: iSource, Worker: cfg.Worker, DLQ: dlq}
+		switch {
+		case sc.Output.Type != "":
+			component.OutputName = outputName(sc.Output)
+			component.Retrier, err = newRetrier(sc.Output)
+		case shared == nil:
+			component.OutputName = outputName(cfg.Output)
+			shared, err = newRetrier(cfg.Output)
+			component.Retrier = shared
+		default:
+			component.OutputName = outputName(cfg.Output)
+			component.Retrier = shared
+		}
+		if component.Retrier != nil {
+			component.Output = component.Retrier.Output()
+		}
+		if err != nil {
+			_ = iSource.Close()
+			closeAll(components)
+			return nil, nil, fmt.Errorf("failed to create output of source %s: %w", sc.Name, err)
+		}
+		components = append(components, component)
+	}
+	return iStore, components, nil
+}
+
+// newRetrier Creates an output wrapped with its retry policy and circuit breaker
+func newRetrier(cfg output.Config) (*output.Retrier, error) {
+	iOutput, err := output.NewOutput(cfg)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create source: %w", err)
+		return nil, err
 	}
-	iSource.WithStore(iStore)
-	iOutput, err := output.NewOutput(cfg.Output)
+	return output.NewRetrier(iOutput, cfg.Retry, cfg.Breaker), nil
+}
+
+// newDLQ Creates the dead-letter queue output with the default retry policy, nil when it is disabled
+func newDLQ(cfg output.DLQConfig) (*output.Retrier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	dlq, err := output.NewDLQOutput(cfg)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create output: %w", err)
+		return nil, fmt.Errorf("failed to create dead-letter queue: %w", err)
 	}
-	return iSource, iStore, iOutput, nil
+	return output.NewRetrier(dlq, output.RetryConfig{}, output.BreakerConfig{}), nil
+}
+
+// outputName Returns the type of an output configuration, stdout when it is unset
+func outputName(cfg output.Config) string {
+	if cfg.Type == "" {
+		return string(output.OutputTypeStdout)
+	}
+	return string(cfg.Type)
 }
 
 // CloseSetupComponents resources uniformly
-func CloseSetupComponents(iSource source.ISource, iStore store.IStore, iOutput output.IOutput) {
-	logx.Info("closing source and output")
-	if err := iSource.Close(); err != nil {
-		logx.Error("failed to close source: %v", err)
+// A shared output or dead-letter queue is closed once
+func CloseSetupComponents(iStore store.IStore, components []Component) {
+	logx.Info("closing sources and outputs")
+	for _, c := range components {
+		if err := c.Source.Close(); err != nil {
+			logx.Error("failed to close source %s: %v", c.Name, err)
+		}
+	}
+	closed := make(map[output.IOutput]bool, len(components))
+	for _, c := range components {
+		outputs := []output.IOutput{c.Output}
+		if c.DLQ != nil {
+			outputs = append(outputs, c.DLQ.Output())
+		}
+		for _, o := range outputs {
+			if o == nil || closed[o] {
+				continue
+			}
+			closed[o] = true
+			if err := o.Close(); err != nil {
+				logx.Error("failed to close output: %v", err)
+			}
+		}
 	}
 	if err := iStore.Close(); err != nil {
 		logx.Error("failed to close store: %v", err)
 	}
-	if err := iOutput.Close(); err != nil {
-		logx.Error("failed to close output: %v", err)
-	}
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/chihqiang/dbxgo/filter"
 	"github.com/chihqiang/dbxgo/output"
 	"github.com/chihqiang/dbxgo/source"
 	"github.com/chihqiang/dbxgo/store"
@@ -21,9 +22,140 @@ func init() {
 type Config struct {
 	Store  store.Config  `yaml:"store" json:"store" mapstructure:"store"`
 	Source source.Config `yaml:"source" json:"source" mapstructure:"source"`
+	// Sources Several sources in one process, each with a unique name; replaces Source when set
+	Sources []SourceConfig `yaml:"sources" json:"sources" mapstructure:"sources"`
+	// Pipelines Independent pipelines supervised in one process; replaces Source and Sources when set
+	Pipelines []PipelineConfig `yaml:"pipelines" json:"pipelines" mapstructure:"pipelines"`
+	Output    output.Config    `yaml:"output" json:"output" mapstructure:"output"`
+	Worker    WorkerConfig     `yaml:"worker" json:"worker" mapstructure:"worker"`
+	// DLQ Dead-letter queue of the events that exhausted their send retries, shared by all sources
+	DLQ output.DLQConfig `yaml:"dlq" json:"dlq" mapstructure:"dlq"`
+}
+
+// SourceConfig Defines one entry of the sources list
+type SourceConfig struct {
+	source.Config `yaml:",inline" mapstructure:",squash"`
+	// Output Output of this source only, the shared output is used when its type is empty
 	Output output.Config `yaml:"output" json:"output" mapstructure:"output"`
 }
 
+// SourceConfigs Returns the configured sources
+// The single Source is returned as an unnamed entry when no sources list is given
+// Returns: Source entries and an error when a name is missing or used twice
+func (c *Config) SourceConfigs() ([]SourceConfig, error) {
+	if len(c.Sources) == 0 {
+		return []SourceConfig{{Config: c.Source}}, nil
+	}
+	names := make(map[string]bool, len(c.Sources))
+	for i, sc := range c.Sources {
+		if sc.Name == "" {
+			return nil, fmt.Errorf("sources[%d] has no name", i)
+		}
+		if names[sc.Name] {
+			return nil, fmt.Errorf("source name %q is used more than once", sc.Name)
+		}
+		names[sc.Name] = true
+	}
+	return c.Sources, nil
+}
+
+// PipelineConfig Defines one entry of the pipelines list
+// A pipeline bundles a source, its store namespace, a filter, an output and a worker pool.
+// When it fails it is restarted with backoff while the other pipelines keep running.
+type PipelineConfig struct {
+	// Name Unique name of the pipeline, stamped into its events
+	Name string `yaml:"name" json:"name" mapstructure:"name"`
+	// Namespace Store namespace of the checkpoints, defaults to the name
+	Namespace string        `yaml:"namespace" json:"namespace" mapstructure:"namespace"`
+	Source    source.Config `yaml:"source" json:"source" mapstructure:"source"`
+	// Filter Events that do not match are acknowledged without being sent
+	Filter filter.Config `yaml:"filter" json:"filter" mapstructure:"filter"`
+	// Output Output of the pipeline, the top-level output is used when its type is empty
+	Output output.Config `yaml:"output" json:"output" mapstructure:"output"`
+	// Worker Worker pool of the pipeline, the top-level worker settings are used when unset
+	Worker WorkerConfig `yaml:"worker" json:"worker" mapstructure:"worker"`
+	// Restart Restart policy applied when the pipeline fails
+	Restart RestartConfig `yaml:"restart" json:"restart" mapstructure:"restart"`
+}
+
+// RestartConfig Defines how a failed pipeline is restarted
+// The delay doubles after every failure, starting at InitialBackoff and capped at MaxBackoff
+type RestartConfig struct {
+	// InitialBackoff Delay before the first restart in seconds, defaults to 1
+	InitialBackoff int `yaml:"initial_backoff" json:"initial_backoff" mapstructure:"initial_backoff"`
+	// MaxBackoff Upper limit of the delay in seconds, defaults to 60
+	MaxBackoff int `yaml:"max_backoff" json:"max_backoff" mapstructure:"max_backoff"`
+	// MaxRestarts Consecutive restarts before the pipeline gives up, 0 restarts forever
+	MaxRestarts int `yaml:"max_restarts" json:"max_restarts" mapstructure:"max_restarts"`
+}
+
+// PipelineConfigs Returns the configured pipelines with their defaults applied
+// Namespace falls back to the name, output and worker settings to the top-level ones
+// Returns: Pipeline entries and an error when a name is missing or a name or namespace is used twice
+func (c *Config) PipelineConfigs() ([]PipelineConfig, error) {
+	names := make(map[string]bool, len(c.Pipelines))
+	namespaces := make(map[string]bool, len(c.Pipelines))
+	pipelines := make([]PipelineConfig, 0, len(c.Pipelines))
+	for i, pc := range c.Pipelines {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("pipelines[%d] has no name", i)
+		}
+		if names[pc.Name] {
+			return nil, fmt.Errorf("pipeline name %q is used more than once", pc.Name)
+		}
+		names[pc.Name] = true
+		if pc.Namespace == "" {
+			pc.Namespace = pc.Name
+		}
+		if namespaces[pc.Namespace] {
+			return nil, fmt.Errorf("pipeline %q shares store namespace %q with another pipeline", pc.Name, pc.Namespace)
+		}
+		namespaces[pc.Namespace] = true
+		if pc.Output.Type == "" {
+			pc.Output = c.Output
+		}
+		if pc.Worker == (WorkerConfig{}) {
+			pc.Worker = c.Worker
+		}
+		pipelines = append(pipelines, pc)
+	}
+	return pipelines, nil
+}
+
+// PartitionMode Defines how events are distributed across worker lanes
+type PartitionMode string
+
+const (
+	// PartitionModePrimaryKey Routes events by database, table and primary key, keeping per-row order
+	PartitionModePrimaryKey PartitionMode = "primary_key"
+	// PartitionModeTable Routes events by database and table, keeping per-table order
+	PartitionModeTable PartitionMode = "table"
+	// PartitionModeNone All workers share one channel, no ordering guarantee
+	PartitionModeNone PartitionMode = "none"
+)
+
+// WorkerConfig Defines the worker pool that sends events to the output
+type WorkerConfig struct {
+	// Count Number of worker lanes, defaults to the number of CPUs
+	Count int `yaml:"count" json:"count" mapstructure:"count" env:"WORKER_COUNT"`
+	// Partition Partitioning mode: primary_key / table / none
+	Partition PartitionMode `yaml:"partition" json:"partition" mapstructure:"partition" env:"WORKER_PARTITION" envDefault:"primary_key"`
+	// Batch Batching of events for outputs that can send several events in one request
+	Batch BatchConfig `yaml:"batch" json:"batch" mapstructure:"batch"`
+}
+
+// BatchConfig Defines how a worker groups events into batches
+// A batch is sent once it holds Size events or Bytes bytes, or Linger has passed since its first event.
+// It only applies to outputs implementing output.BatchOutput.
+type BatchConfig struct {
+	// Size Maximum events per batch, 0 or 1 disables batching
+	Size int `yaml:"size" json:"size" mapstructure:"size" env:"WORKER_BATCH_SIZE"`
+	// Bytes Maximum JSON size of a batch in bytes, 0 means no limit
+	Bytes int `yaml:"bytes" json:"bytes" mapstructure:"bytes" env:"WORKER_BATCH_BYTES"`
+	// Linger Milliseconds a batch waits for more events, defaults to 100
+	Linger int `yaml:"linger" json:"linger" mapstructure:"linger" env:"WORKER_BATCH_LINGER"`
+}
+
 // Load attempts to load the configuration.
 // Load order: prioritizes reading from the file → if the file does not exist or fails to parse, it loads from environment variables.
 func Load(path string) (*Config, error) {
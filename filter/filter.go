@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/chihqiang/dbxgo/types"
+)
+
+// Config Defines which events are kept
+// An empty config keeps every event
+type Config struct {
+	// IncludeTableRegex Only keep tables whose "database.table" matches one of these regexes
+	IncludeTableRegex []string `yaml:"include_table_regex" json:"include_table_regex" mapstructure:"include_table_regex"`
+	// ExcludeTableRegex Drop tables whose "database.table" matches one of these regexes
+	ExcludeTableRegex []string `yaml:"exclude_table_regex" json:"exclude_table_regex" mapstructure:"exclude_table_regex"`
+	// Types Only keep these event types (insert/update/delete/snapshot/ddl/begin/commit), empty keeps all
+	Types []types.EventRowType `yaml:"types" json:"types" mapstructure:"types"`
+}
+
+// Tables Matches "database.table" names against include and exclude regexes
+// A table must match an include regex (if any) and must not match any exclude regex
+type Tables struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewTables Compiles the include and exclude regexes
+func NewTables(include, exclude []string) (*Tables, error) {
+	f := &Tables{}
+	for _, expr := range include {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include table regex %q: %w", expr, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, expr := range exclude {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude table regex %q: %w", expr, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+// Match Reports whether the table should be processed
+func (f *Tables) Match(database, table string) bool {
+	key := database + "." + table
+	matched := len(f.include) == 0
+	for _, re := range f.include {
+		if re.MatchString(key) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter Decides whether an event is kept, by its table and its type
+type Filter struct {
+	tables *Tables
+	types  map[types.EventRowType]bool
+}
+
+// New Creates a filter from its configuration
+// cfg: Filter configuration
+// Returns: Filter and an error when a regex does not compile
+func New(cfg Config) (*Filter, error) {
+	tables, err := NewTables(cfg.IncludeTableRegex, cfg.ExcludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{tables: tables}
+	if len(cfg.Types) > 0 {
+		f.types = make(map[types.EventRowType]bool, len(cfg.Types))
+		for _, t := range cfg.Types {
+			f.types[t] = true
+		}
+	}
+	return f, nil
+}
+
+// Match Reports whether the event is kept
+// Transaction markers carry no table, they are only matched by their type
+func (f *Filter) Match(event types.EventData) bool {
+	if f.types != nil && !f.types[event.Row.Type] {
+		return false
+	}
+	if event.Row.Table == "" {
+		return true
+	}
+	return f.tables.Match(event.Row.Database, event.Row.Table)
+}
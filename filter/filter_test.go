@@ -0,0 +1,41 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEvent(database, table string, rowType types.EventRowType) types.EventData {
+	return types.EventData{Row: types.EventRowData{Database: database, Table: table, Type: rowType}}
+}
+
+func TestFilter_EmptyKeepsAll(t *testing.T) {
+	f, err := New(Config{})
+	assert.NoError(t, err)
+	assert.True(t, f.Match(newEvent("shop", "orders", types.InsertEventRowType)))
+	assert.True(t, f.Match(newEvent("", "", types.CommitEventRowType)))
+}
+
+func TestFilter_TablesAndTypes(t *testing.T) {
+	f, err := New(Config{
+		IncludeTableRegex: []string{"shop\\..*"},
+		ExcludeTableRegex: []string{"shop\\.tmp_.*"},
+		Types:             []types.EventRowType{types.InsertEventRowType, types.CommitEventRowType},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, f.Match(newEvent("shop", "orders", types.InsertEventRowType)))
+	assert.False(t, f.Match(newEvent("shop", "orders", types.DeleteEventRowType)))
+	assert.False(t, f.Match(newEvent("shop", "tmp_orders", types.InsertEventRowType)))
+	assert.False(t, f.Match(newEvent("crm", "users", types.InsertEventRowType)))
+	// Transaction markers carry no table
+	assert.True(t, f.Match(newEvent("", "", types.CommitEventRowType)))
+	assert.False(t, f.Match(newEvent("", "", types.BeginEventRowType)))
+}
+
+func TestFilter_InvalidRegex(t *testing.T) {
+	_, err := New(Config{ExcludeTableRegex: []string{"("}})
+	assert.Error(t, err)
+}
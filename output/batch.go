@@ -0,0 +1,29 @@
+package output
+
+import (
+	"context"
+
+	"github.com/chihqiang/dbxgo/types"
+)
+
+// BatchOutput Implemented by outputs that can publish several events in one round trip
+type BatchOutput interface {
+	IOutput
+	// SendBatch Sends the events in order
+	// It returns nil only once every event was accepted; after an error the whole batch may be
+	// sent again, so events accepted before the failure can be delivered twice.
+	SendBatch(ctx context.Context, events []types.EventData) error
+}
+
+// SendBatch Sends events through the batch interface of an output, or one by one when it has none
+func SendBatch(ctx context.Context, output IOutput, events []types.EventData) error {
+	if b, ok := output.(BatchOutput); ok {
+		return b.SendBatch(ctx, events)
+	}
+	for _, event := range events {
+		if err := output.Send(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
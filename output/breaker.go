@@ -0,0 +1,119 @@
+package output
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	// defaultOpenTimeout How long an open breaker waits before letting a probe through
+	defaultOpenTimeout = 30 * time.Second
+	// probePollInterval How often callers check a breaker whose probe is still in flight
+	probePollInterval = 100 * time.Millisecond
+)
+
+// BreakerConfig Defines the circuit breaker of an output
+// After FailureThreshold consecutive transient failures the breaker opens and sends wait instead of
+// failing; after OpenTimeout a single probe is let through, closing the breaker when it succeeds.
+type BreakerConfig struct {
+	// FailureThreshold Consecutive failures that open the breaker, 0 disables it
+	FailureThreshold int `yaml:"failure_threshold" json:"failure_threshold" mapstructure:"failure_threshold" env:"OUTPUT_BREAKER_FAILURE_THRESHOLD"`
+	// OpenTimeout Seconds the breaker stays open before a probe, defaults to 30
+	OpenTimeout int `yaml:"open_timeout" json:"open_timeout" mapstructure:"open_timeout" env:"OUTPUT_BREAKER_OPEN_TIMEOUT"`
+}
+
+// Breaker A circuit breaker shared by the workers sending to one output
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	// failures Consecutive failures
+	failures int
+	// openUntil When the next probe may be sent while the breaker is open
+	openUntil time.Time
+	// probing Whether a probe is in flight
+	probing bool
+	now     func() time.Time
+}
+
+// NewBreaker Creates a closed breaker
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	b := &Breaker{
+		threshold:   cfg.FailureThreshold,
+		openTimeout: time.Duration(cfg.OpenTimeout) * time.Second,
+		now:         time.Now,
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultOpenTimeout
+	}
+	return b
+}
+
+// open Reports whether the breaker is open, the caller holds the lock
+func (b *Breaker) open() bool {
+	return b.threshold > 0 && b.failures >= b.threshold
+}
+
+// Wait Blocks while the breaker is open
+// Once the open timeout has passed, exactly one caller is let through as the probe.
+// Returns: The error of ctx when it is done first
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if !b.open() {
+			b.mu.Unlock()
+			return nil
+		}
+		wait := b.openUntil.Sub(b.now())
+		if wait <= 0 && !b.probing {
+			b.probing = true
+			b.mu.Unlock()
+			return nil
+		}
+		if wait <= 0 {
+			wait = probePollInterval
+		}
+		b.mu.Unlock()
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Success Closes the breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open() {
+		logx.Info("circuit breaker closed, output recovered")
+	}
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure Counts a transient failure, opening the breaker at the threshold
+// Returns: Whether the breaker is open, also after a failed probe
+func (b *Breaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if !b.open() {
+		return false
+	}
+	b.openUntil = b.now().Add(b.openTimeout)
+	if b.failures == b.threshold {
+		logx.Warn("circuit breaker opened after %d consecutive failures, pausing sends for %s", b.failures, b.openTimeout)
+	}
+	return true
+}
+
+// Release Gives up a probe without an outcome, e.g. when the send was canceled
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker_OpensAndProbes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: 10})
+	b.now = func() time.Time { return now }
+
+	assert.NoError(t, b.Wait(context.Background()))
+	b.Failure()
+	assert.NoError(t, b.Wait(context.Background()))
+	b.Failure()
+
+	// Open: callers wait instead of sending
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+
+	// After the open timeout a single probe is let through
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, b.Wait(context.Background()))
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+
+	b.Success()
+	assert.NoError(t, b.Wait(context.Background()))
+}
+
+func TestBreaker_DisabledByDefault(t *testing.T) {
+	b := NewBreaker(BreakerConfig{})
+	for i := 0; i < 100; i++ {
+		b.Failure()
+	}
+	assert.NoError(t, b.Wait(context.Background()))
+}
+
+func TestRetrier_BreakerPausesInsteadOfSpendingAttempts(t *testing.T) {
+	o := &flakyOutput{err: fmt.Errorf("connection refused"), failures: -1}
+	r, _ := newTestRetrier(o, RetryConfig{MaxAttempts: -1}, BreakerConfig{FailureThreshold: 3, OpenTimeout: 3600})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attempts, err := r.Send(ctx, types.EventData{})
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, o.sends)
+}
+
+// downOutput Always fails, canceling the send once stopAfter sends have been made
+type downOutput struct {
+	sends     int
+	stopAfter int
+	cancel    context.CancelFunc
+}
+
+func (o *downOutput) Send(ctx context.Context, event types.EventData) error {
+	o.sends++
+	if o.sends == o.stopAfter {
+		o.cancel()
+	}
+	return fmt.Errorf("connection refused")
+}
+
+func (o *downOutput) Close() error { return nil }
+
+func TestRetrier_FailedProbesDoNotSpendAttempts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &downOutput{stopAfter: 10, cancel: cancel}
+	r, _ := newTestRetrier(o, RetryConfig{}, BreakerConfig{FailureThreshold: 2, OpenTimeout: 3600})
+	// Every wait finds the open timeout elapsed, so each probe is sent right away
+	now := time.Unix(1000, 0)
+	r.breaker.now = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+
+	// The output stays down: the send keeps probing until shutdown instead of giving up
+	attempts, err := r.Send(ctx, types.EventData{})
+	assert.Error(t, err)
+	assert.False(t, IsPermanent(o, err))
+	assert.Equal(t, 10, attempts)
+	assert.Equal(t, 10, o.sends)
+}
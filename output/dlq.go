@@ -0,0 +1,276 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chihqiang/dbxgo/pkg/redisx"
+	"github.com/chihqiang/dbxgo/pkg/structx"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// defaultDLQFilePath File of the dead-letter queue when no path is configured
+	defaultDLQFilePath = "runtime/dbxgo-dlq.jsonl"
+	// dlqKafkaGroup Consumer group committing the replayed dead letters of a Kafka topic
+	dlqKafkaGroup = "dbxgo-dlq-replay"
+	// dlqKafkaIdle A Kafka replay ends once no message arrived for this long
+	dlqKafkaIdle = 5 * time.Second
+)
+
+// DLQConfig Dead-letter queue receiving the events that exhausted their send retries
+// The queue is disabled while Type is empty
+type DLQConfig struct {
+	// Type Type of the dead-letter queue: file / redis / kafka
+	Type  OutputType  `yaml:"type" json:"type" mapstructure:"type" env:"DLQ_TYPE"`
+	File  FileConfig  `yaml:"file" json:"file" mapstructure:"file" envPrefix:"DLQ_"`
+	Redis RedisConfig `yaml:"redis" json:"redis" mapstructure:"redis" envPrefix:"DLQ_"`
+	Kafka KafkaConfig `yaml:"kafka" json:"kafka" mapstructure:"kafka" envPrefix:"DLQ_"`
+}
+
+// Enabled Reports whether a dead-letter queue is configured
+func (c DLQConfig) Enabled() bool {
+	return c.Type != ""
+}
+
+// fileConfig Returns the file settings with the dead-letter default path
+func (c DLQConfig) fileConfig() FileConfig {
+	cfg := c.File
+	if cfg.Path == "" {
+		cfg.Path = defaultDLQFilePath
+	}
+	return cfg
+}
+
+// NewDLQOutput Creates the output dead letters are sent to
+// Only queue types that can be read back for replay are accepted
+func NewDLQOutput(cfg DLQConfig) (IOutput, error) {
+	switch cfg.Type {
+	case OutputTypeFile:
+		return NewFileOutput(cfg.fileConfig())
+	case OutputTypeRedis:
+		return NewRedisOutput(cfg.Redis)
+	case OutputTypeKafka:
+		if cfg.Kafka.dynamicTopic() {
+			return nil, fmt.Errorf("the kafka dead-letter queue needs a fixed topic")
+		}
+		// A tombstone carries no event, the replay could not decode it
+		kc := cfg.Kafka
+		kc.Tombstones = false
+		return NewKafkaOutput(kc)
+	default:
+		return nil, fmt.Errorf("unsupported dead-letter queue type: %s", cfg.Type)
+	}
+}
+
+// DLQ Reads dead letters back for replay
+type DLQ interface {
+	// Replay Hands the dead letters to fn, oldest first
+	// Dead letters fn accepts are removed from the queue; replay stops at the first one it
+	// rejects, which stays at the head of the queue.
+	// Returns: Number of replayed dead letters and the error that stopped the replay
+	Replay(ctx context.Context, fn func(types.EventData) error) (int, error)
+	// Close Releases the connection to the queue
+	Close() error
+}
+
+// OpenDLQ Opens the dead-letter queue for replay
+func OpenDLQ(cfg DLQConfig) (DLQ, error) {
+	switch cfg.Type {
+	case OutputTypeFile:
+		return &fileDLQ{path: cfg.fileConfig().Path}, nil
+	case OutputTypeRedis:
+		rc, err := structx.MergeWithDefaults[RedisConfig](cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		rdb, err := redisx.Open(redisx.Config{Addr: rc.Addr, Password: rc.Password, DB: rc.DB})
+		if err != nil {
+			return nil, err
+		}
+		return &redisDLQ{rdb: rdb, key: rc.Key}, nil
+	case OutputTypeKafka:
+		kc, err := structx.MergeWithDefaults[KafkaConfig](cfg.Kafka)
+		if err != nil {
+			return nil, err
+		}
+		dialer, err := kafkaDialer(kc)
+		if err != nil {
+			return nil, err
+		}
+		return &kafkaDLQ{reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     kc.Brokers,
+			Dialer:      dialer,
+			Topic:       kc.Topic,
+			GroupID:     dlqKafkaGroup,
+			StartOffset: kafka.FirstOffset,
+		})}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dead-letter queue type: %s", cfg.Type)
+	}
+}
+
+// decodeDeadLetter Decodes a dead letter written by an output
+// UseNumber keeps integers exact, so BIGINT values and message keys survive the replay
+func decodeDeadLetter(data []byte) (types.EventData, error) {
+	var event types.EventData
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return event, fmt.Errorf("failed to decode dead letter: %w", err)
+	}
+	return event, nil
+}
+
+// fileDLQ Dead letters in a JSON Lines file
+// The file is rewritten after a replay, dbxgo should not be appending to it meanwhile.
+type fileDLQ struct {
+	path string
+}
+
+// Replay Replays the lines of the file and keeps the ones that were not replayed
+func (q *fileDLQ) Replay(ctx context.Context, fn func(types.EventData) error) (int, error) {
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	replayed := 0
+	var replayErr error
+	for _, line := range lines {
+		if replayErr = ctx.Err(); replayErr != nil {
+			break
+		}
+		event, err := decodeDeadLetter(line)
+		if err == nil {
+			err = fn(event)
+		}
+		if err != nil {
+			replayErr = err
+			break
+		}
+		replayed++
+	}
+	if replayed == 0 {
+		return 0, replayErr
+	}
+	var rest bytes.Buffer
+	for _, line := range lines[replayed:] {
+		rest.Write(line)
+		rest.WriteByte('\n')
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, rest.Bytes(), 0644); err != nil {
+		return replayed, err
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return replayed, err
+	}
+	return replayed, replayErr
+}
+
+// Close Nothing to release
+func (q *fileDLQ) Close() error {
+	return nil
+}
+
+// redisDLQ Dead letters in a Redis list, pushed to its head by RedisOutput
+type redisDLQ struct {
+	rdb *redis.Client
+	key string
+}
+
+// Replay Pops dead letters from the tail of the list, a rejected one is pushed back
+func (q *redisDLQ) Replay(ctx context.Context, fn func(types.EventData) error) (int, error) {
+	replayed := 0
+	for {
+		data, err := q.rdb.RPop(ctx, q.key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return replayed, nil
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("failed to pop dead letter: %w", err)
+		}
+		event, err := decodeDeadLetter(data)
+		if err == nil {
+			err = fn(event)
+		}
+		if err != nil {
+			if pushErr := q.rdb.RPush(context.WithoutCancel(ctx), q.key, data).Err(); pushErr != nil {
+				return replayed, fmt.Errorf("failed to push back dead letter: %w (replay error: %v)", pushErr, err)
+			}
+			return replayed, err
+		}
+		replayed++
+	}
+}
+
+// Close Closes the Redis client
+func (q *redisDLQ) Close() error {
+	return q.rdb.Close()
+}
+
+// kafkaDLQ Dead letters in a Kafka topic, consumed by a dedicated consumer group
+type kafkaDLQ struct {
+	reader *kafka.Reader
+}
+
+// Replay Consumes the topic until it stays idle, committing every replayed message
+// Messages without a value, such as tombstones, are committed and skipped
+func (q *kafkaDLQ) Replay(ctx context.Context, fn func(types.EventData) error) (int, error) {
+	replayed := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, dlqKafkaIdle)
+		msg, err := q.reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return replayed, nil
+			}
+			return replayed, fmt.Errorf("failed to fetch dead letter: %w", err)
+		}
+		if msg.Value == nil {
+			if err := q.reader.CommitMessages(ctx, msg); err != nil {
+				return replayed, fmt.Errorf("failed to commit dead letter: %w", err)
+			}
+			continue
+		}
+		event, err := decodeDeadLetter(msg.Value)
+		if err == nil {
+			err = fn(event)
+		}
+		if err != nil {
+			return replayed, err
+		}
+		if err := q.reader.CommitMessages(ctx, msg); err != nil {
+			return replayed, fmt.Errorf("failed to commit dead letter: %w", err)
+		}
+		replayed++
+	}
+}
+
+// Close Closes the Kafka reader
+func (q *kafkaDLQ) Close() error {
+	return q.reader.Close()
+}
@@ -0,0 +1,142 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func deadLetterEvent(table string) types.EventData {
+	event := routeEvent(table, types.InsertEventRowType)
+	event.DeadLetter = &types.DeadLetter{Error: "broker unavailable", Attempts: 4, Output: "kafka"}
+	return event
+}
+
+// replayTables Replays the queue, rejecting the event of the table named by reject
+func replayTables(t *testing.T, q DLQ, reject string) ([]string, error) {
+	var tables []string
+	n, err := q.Replay(context.Background(), func(event types.EventData) error {
+		assert.Equal(t, "broker unavailable", event.DeadLetter.Error)
+		if event.Row.Table == reject {
+			return fmt.Errorf("still unavailable")
+		}
+		tables = append(tables, event.Row.Table)
+		return nil
+	})
+	assert.Equal(t, len(tables), n)
+	return tables, err
+}
+
+func TestFileDLQ_Replay(t *testing.T) {
+	cfg := DLQConfig{Type: OutputTypeFile, File: FileConfig{Path: filepath.Join(t.TempDir(), "dlq", "events.jsonl")}}
+	out, err := NewDLQOutput(cfg)
+	assert.NoError(t, err)
+	for _, table := range []string{"orders", "users", "sessions"} {
+		assert.NoError(t, out.Send(context.Background(), deadLetterEvent(table)))
+	}
+	assert.NoError(t, out.Close())
+
+	q, err := OpenDLQ(cfg)
+	assert.NoError(t, err)
+	tables, err := replayTables(t, q, "users")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"orders"}, tables)
+
+	// The rejected event and everything after it stay in the file
+	data, err := os.ReadFile(cfg.File.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+
+	tables, err = replayTables(t, q, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users", "sessions"}, tables)
+	assert.NoError(t, q.Close())
+}
+
+func TestFileDLQ_ReplayKeepsLargeIntegers(t *testing.T) {
+	cfg := DLQConfig{Type: OutputTypeFile, File: FileConfig{Path: filepath.Join(t.TempDir(), "events.jsonl")}}
+	out, err := NewDLQOutput(cfg)
+	assert.NoError(t, err)
+	event := deadLetterEvent("orders")
+	// 2^53 + 1 is the first integer a float64 cannot hold
+	event.Row.PrimaryKey = []string{"id"}
+	event.Row.Key = map[string]any{"id": uint64(9007199254740993)}
+	event.Row.Data = map[string]any{"id": uint64(9007199254740993), "total": int64(1000000)}
+	assert.NoError(t, out.Send(context.Background(), event))
+	assert.NoError(t, out.Close())
+
+	q, err := OpenDLQ(cfg)
+	assert.NoError(t, err)
+	var replayed []types.EventData
+	n, err := q.Replay(context.Background(), func(event types.EventData) error {
+		replayed = append(replayed, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, json.Number("9007199254740993"), replayed[0].Row.Data["id"])
+	assert.Equal(t, json.Number("1000000"), replayed[0].Row.Data["total"])
+	assert.Equal(t, "shop.orders:9007199254740993", string(primaryKeyMessageKey(replayed[0].Row)))
+	assert.NoError(t, q.Close())
+}
+
+func TestFileDLQ_MissingFile(t *testing.T) {
+	q, err := OpenDLQ(DLQConfig{Type: OutputTypeFile, File: FileConfig{Path: filepath.Join(t.TempDir(), "none.jsonl")}})
+	assert.NoError(t, err)
+	tables, err := replayTables(t, q, "")
+	assert.NoError(t, err)
+	assert.Empty(t, tables)
+}
+
+func TestRedisDLQ_Replay(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	cfg := DLQConfig{Type: OutputTypeRedis, Redis: RedisConfig{Addr: mr.Addr(), Key: "dbxgo-dlq"}}
+	out, err := NewDLQOutput(cfg)
+	assert.NoError(t, err)
+	for _, table := range []string{"orders", "users", "sessions"} {
+		assert.NoError(t, out.Send(context.Background(), deadLetterEvent(table)))
+	}
+	assert.NoError(t, out.Close())
+
+	q, err := OpenDLQ(cfg)
+	assert.NoError(t, err)
+	defer q.Close()
+	tables, err := replayTables(t, q, "users")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"orders"}, tables)
+
+	tables, err = replayTables(t, q, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users", "sessions"}, tables)
+}
+
+func TestNewDLQOutput_KafkaWithoutTombstones(t *testing.T) {
+	out, err := NewDLQOutput(DLQConfig{Type: OutputTypeKafka, Kafka: KafkaConfig{Topic: "dbxgo-dlq", Key: KafkaKeyPrimaryKey, Tombstones: true}})
+	assert.NoError(t, err)
+	defer out.Close()
+
+	k, ok := out.(*KafkaOutput)
+	assert.True(t, ok)
+	msgs, err := k.messages(kafkaRowEvent(types.DeleteEventRowType, 3))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1, "a delete must not be followed by a tombstone the replay cannot decode")
+	assert.NotNil(t, msgs[0].Value)
+}
+
+func TestNewDLQOutput_UnsupportedType(t *testing.T) {
+	_, err := NewDLQOutput(DLQConfig{Type: OutputTypeStdout})
+	assert.Error(t, err)
+	_, err = OpenDLQ(DLQConfig{Type: OutputTypeStdout})
+	assert.Error(t, err)
+}
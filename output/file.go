@@ -0,0 +1,61 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chihqiang/dbxgo/types"
+)
+
+// FileConfig Local file configuration entity
+type FileConfig struct {
+	// Path File the events are appended to, one JSON document per line, defaults to runtime/dbxgo-events.jsonl
+	Path string `yaml:"path" json:"path" mapstructure:"path" env:"OUTPUT_FILE_PATH"`
+}
+
+// defaultFilePath File of the file output when no path is configured
+const defaultFilePath = "runtime/dbxgo-events.jsonl"
+
+// FileOutput Appends events to a local JSON Lines file
+type FileOutput struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileOutput Opens the file for appending, creating it and its directory when missing
+func NewFileOutput(cfg FileConfig) (*FileOutput, error) {
+	if cfg.Path == "" {
+		cfg.Path = defaultFilePath
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory of %s: %w", cfg.Path, err)
+	}
+	file, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", cfg.Path, err)
+	}
+	return &FileOutput{file: file}, nil
+}
+
+// Send Appends the event as one line
+func (f *FileOutput) Send(ctx context.Context, event types.EventData) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Close Closes the file
+func (f *FileOutput) Close() error {
+	return f.file.Close()
+}
@@ -1,21 +1,86 @@
 package output
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/chihqiang/dbxgo/pkg/structx"
 	"github.com/chihqiang/dbxgo/types"
 	"github.com/segmentio/kafka-go"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 )
 
+const (
+	// KafkaKeyPrimaryKey Keys messages by "database.table:" followed by the primary key values
+	KafkaKeyPrimaryKey = "primary_key"
+
+	// KafkaBalancerLeastBytes Sends to the partition that received the fewest bytes
+	KafkaBalancerLeastBytes = "least_bytes"
+	// KafkaBalancerHash Picks the partition from an FNV-1a hash of the key
+	KafkaBalancerHash = "hash"
+	// KafkaBalancerMurmur2 Picks the partition like the Java client, for topics shared with it
+	KafkaBalancerMurmur2 = "murmur2"
+	// KafkaBalancerRoundRobin Cycles through the partitions
+	KafkaBalancerRoundRobin = "round_robin"
+)
+
 // KafkaConfig Kafka configuration entity, used to initialize KafkaOutput
 type KafkaConfig struct {
 	// Brokers List of Kafka brokers, e.g., ["127.0.0.1:9092"]
 	Brokers []string `yaml:"brokers" json:"brokers" mapstructure:"brokers" env:"OUTPUT_KAFKA_BROKERS" envDefault:"127.0.0.1:9092"`
 
-	// Topic The name of the Kafka topic to send messages to
+	// Topic The name of the Kafka topic to send messages to, or a Go template over the row, e.g. cdc.{{.Database}}.{{.Table}}
 	Topic string `yaml:"topic" json:"topic" mapstructure:"topic" env:"OUTPUT_KAFKA_TOPIC" envDefault:"dbxgo-events"`
+
+	// TopicOverrides Topics of the tables matching a regex, checked in order before the topic template
+	TopicOverrides []KafkaTopicOverride `yaml:"topic_overrides" json:"topic_overrides" mapstructure:"topic_overrides"`
+
+	// DefaultTopic Topic of the events without a table, such as transaction markers, when topics depend on the table
+	DefaultTopic string `yaml:"default_topic" json:"default_topic" mapstructure:"default_topic" env:"OUTPUT_KAFKA_DEFAULT_TOPIC" envDefault:"dbxgo-events"`
+
+	// AutoCreate Creation of missing topics
+	AutoCreate KafkaTopicCreation `yaml:"auto_create" json:"auto_create" mapstructure:"auto_create"`
+
+	// SASL Authentication against the brokers
+	SASL KafkaSASLConfig `yaml:"sasl" json:"sasl" mapstructure:"sasl"`
+
+	// TLS Encryption of the broker connections
+	TLS KafkaTLSConfig `yaml:"tls" json:"tls" mapstructure:"tls"`
+
+	// Compression Compression codec: none / gzip / snappy / lz4 / zstd
+	Compression string `yaml:"compression" json:"compression" mapstructure:"compression" env:"OUTPUT_KAFKA_COMPRESSION" envDefault:"none"`
+
+	// RequiredAcks Acknowledgements a write waits for: all / one / none
+	RequiredAcks string `yaml:"required_acks" json:"required_acks" mapstructure:"required_acks" env:"OUTPUT_KAFKA_REQUIRED_ACKS" envDefault:"all"`
+
+	// BatchSize Messages per partition request, defaults to 100
+	BatchSize int `yaml:"batch_size" json:"batch_size" mapstructure:"batch_size" env:"OUTPUT_KAFKA_BATCH_SIZE"`
+
+	// BatchBytes Upper limit of a partition request in bytes, defaults to 1048576
+	BatchBytes int64 `yaml:"batch_bytes" json:"batch_bytes" mapstructure:"batch_bytes" env:"OUTPUT_KAFKA_BATCH_BYTES"`
+
+	// BatchTimeout Milliseconds an incomplete partition request waits for more messages, defaults to 1000
+	BatchTimeout int `yaml:"batch_timeout" json:"batch_timeout" mapstructure:"batch_timeout" env:"OUTPUT_KAFKA_BATCH_TIMEOUT"`
+
+	// WriteTimeout Milliseconds a write request may take, defaults to 10000
+	WriteTimeout int `yaml:"write_timeout" json:"write_timeout" mapstructure:"write_timeout" env:"OUTPUT_KAFKA_WRITE_TIMEOUT"`
+
+	// Key Message key: empty for none, "primary_key", or a Go template over the row, e.g. {{.Database}}.{{.Table}}:{{.Key.id}}
+	Key string `yaml:"key" json:"key" mapstructure:"key" env:"OUTPUT_KAFKA_KEY"`
+
+	// Balancer Partition selection: least_bytes / hash / murmur2 / round_robin, defaults to hash when a key is set
+	Balancer string `yaml:"balancer" json:"balancer" mapstructure:"balancer" env:"OUTPUT_KAFKA_BALANCER"`
+
+	// Headers Whether to add database, table, type, source, position and gtid headers
+	Headers bool `yaml:"headers" json:"headers" mapstructure:"headers" env:"OUTPUT_KAFKA_HEADERS"`
+
+	// Tombstones Whether to follow every delete with a null-value message of the same key, for compacted topics
+	Tombstones bool `yaml:"tombstones" json:"tombstones" mapstructure:"tombstones" env:"OUTPUT_KAFKA_TOMBSTONES"`
 }
 
 // KafkaOutput Kafka implementation that satisfies the IOutput interface
@@ -24,6 +89,12 @@ type KafkaOutput struct {
 	writer *kafka.Writer
 	// config Kafka configuration entity
 	config KafkaConfig
+	// keyTemplate Compiled key template, nil unless Key is a template
+	keyTemplate *template.Template
+	// topics Topic of every event
+	topics *kafkaTopics
+	// transport Connections shared by the writer and the admin client
+	transport *kafka.Transport
 }
 
 // NewKafkaOutput Creates a KafkaOutput using the configuration entity
@@ -42,25 +113,96 @@ func NewKafkaOutput(cfg KafkaConfig) (*KafkaOutput, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Tombstones && cfg.Key == "" {
+		return nil, fmt.Errorf("kafka tombstones require a message key")
+	}
+	var keyTemplate *template.Template
+	if cfg.Key != "" && cfg.Key != KafkaKeyPrimaryKey {
+		keyTemplate, err = template.New("key").Option("missingkey=error").Parse(cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka key template: %w", err)
+		}
+	}
+	balancer, err := kafkaBalancer(cfg.Balancer, cfg.Key != "")
+	if err != nil {
+		return nil, err
+	}
+	compression, err := kafkaCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := kafkaRequiredAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := kafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	addr := kafka.TCP(cfg.Brokers...)
+	topics, err := newKafkaTopics(cfg, &kafka.Client{Addr: addr, Transport: transport})
+	if err != nil {
+		return nil, err
+	}
 	// Create Kafka writer
 	writer := &kafka.Writer{
 		// Kafka broker address list
-		Addr: kafka.TCP(cfg.Brokers...),
-		// Kafka topic to send messages to
-		Topic: cfg.Topic,
-		// Partition selection strategy, LeastBytes means selecting the partition with the least load
-		Balancer: &kafka.LeastBytes{},
-		// Wait for all replicas to confirm the message has been written, ensuring message reliability
-		RequiredAcks: kafka.RequireAll,
+		Addr: addr,
+		// Kafka topic to send messages to, empty when every message names its topic
+		Topic: topics.static,
+		// Partition selection strategy, keyed messages hash to a fixed partition to keep per-row order
+		Balancer: balancer,
+		// Replicas that must confirm a write, all ensures message reliability
+		RequiredAcks: acks,
 		// Whether the send is asynchronous, false means synchronous sending
 		Async: false,
+		// Zero values keep the kafka-go defaults
+		BatchSize:    cfg.BatchSize,
+		BatchBytes:   cfg.BatchBytes,
+		BatchTimeout: time.Duration(cfg.BatchTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Millisecond,
+		Compression:  compression,
+		Transport:    transport,
 	}
 	return &KafkaOutput{
-		writer: writer,
-		config: cfg,
+		writer:      writer,
+		config:      cfg,
+		keyTemplate: keyTemplate,
+		topics:      topics,
+		transport:   transport,
 	}, nil
 }
 
+// kafkaBalancer Resolves the partition balancer by name
+// Parameters:
+//
+//	name: balancer name, empty picks hash for keyed messages and least_bytes otherwise
+//	keyed: whether messages carry a key
+//
+// Returns:
+//
+//	kafka.Balancer and an error when the name is unknown
+func kafkaBalancer(name string, keyed bool) (kafka.Balancer, error) {
+	if name == "" {
+		name = KafkaBalancerLeastBytes
+		if keyed {
+			name = KafkaBalancerHash
+		}
+	}
+	switch name {
+	case KafkaBalancerLeastBytes:
+		return &kafka.LeastBytes{}, nil
+	case KafkaBalancerHash:
+		return &kafka.Hash{}, nil
+	case KafkaBalancerMurmur2:
+		return kafka.Murmur2Balancer{}, nil
+	case KafkaBalancerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kafka balancer: %s", name)
+	}
+}
+
 // Send Serializes EventData to a JSON string and sends it to Kafka
 // Parameters:
 //
@@ -70,15 +212,133 @@ func NewKafkaOutput(cfg KafkaConfig) (*KafkaOutput, error) {
 //
 //	error error if sending fails, otherwise nil
 func (k *KafkaOutput) Send(ctx context.Context, event types.EventData) error {
+	return k.SendBatch(ctx, []types.EventData{event})
+}
+
+// SendBatch Serializes the events and writes them to Kafka in one request
+// Parameters:
+//
+//	events: the events to send, in order
+//
+// Returns:
+//
+//	error error if any message could not be written, otherwise nil
+func (k *KafkaOutput) SendBatch(ctx context.Context, events []types.EventData) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		msgs, err := k.messages(event)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, msgs...)
+	}
+	if err := k.topics.ensure(ctx, messages); err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(ctx, messages...)
+}
+
+// messages Builds the Kafka messages of one event
+// A delete is followed by a tombstone when tombstones are enabled and the event has a key.
+func (k *KafkaOutput) messages(event types.EventData) ([]kafka.Message, error) {
 	// Serialize the event into a JSON string
 	eventValue, err := json.Marshal(event)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	key, err := k.key(event)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := k.topics.topic(event.Row)
+	if err != nil {
+		return nil, err
+	}
+	var headers []kafka.Header
+	if k.config.Headers {
+		headers = kafkaHeaders(event)
+	}
+	now := time.Now()
+	msgs := []kafka.Message{{Topic: topic, Key: key, Value: eventValue, Headers: headers, Time: now}}
+	if k.config.Tombstones && key != nil && event.Row.Type == types.DeleteEventRowType {
+		// A nil value lets log compaction drop every message of the deleted row
+		msgs = append(msgs, kafka.Message{Topic: topic, Key: key, Headers: headers, Time: now})
+	}
+	return msgs, nil
+}
+
+// key Returns the message key of an event, nil when it has none
+// Events without a primary key, such as ddl and transaction markers, are not keyed in primary_key mode.
+func (k *KafkaOutput) key(event types.EventData) ([]byte, error) {
+	switch {
+	case k.config.Key == "":
+		return nil, nil
+	case k.keyTemplate == nil:
+		return primaryKeyMessageKey(event.Row), nil
+	}
+	var buf bytes.Buffer
+	if err := k.keyTemplate.Execute(&buf, event.Row); err != nil {
+		// The same event fails the same way on every attempt
+		return nil, Permanent(fmt.Errorf("failed to render kafka key: %w", err))
+	}
+	return buf.Bytes(), nil
+}
+
+// primaryKeyMessageKey Formats "database.table:" followed by the comma separated primary key values
+func primaryKeyMessageKey(row types.EventRowData) []byte {
+	if len(row.PrimaryKey) == 0 || len(row.Key) == 0 {
+		return nil
+	}
+	values := make([]string, len(row.PrimaryKey))
+	for i, col := range row.PrimaryKey {
+		values[i] = fmt.Sprint(row.Key[col])
+	}
+	return []byte(row.Database + "." + row.Table + ":" + strings.Join(values, ","))
+}
+
+// kafkaHeaders Describes where an event comes from, empty values are left out
+func kafkaHeaders(event types.EventData) []kafka.Header {
+	position := strconv.FormatInt(event.Pos, 10)
+	if event.File != "" {
+		position = event.File + ":" + position
+	}
+	fields := []struct{ key, value string }{
+		{"database", event.Row.Database},
+		{"table", event.Row.Table},
+		{"type", string(event.Row.Type)},
+		{"source", event.Source},
+		{"position", position},
+		{"gtid", event.GTID},
+	}
+	headers := make([]kafka.Header, 0, len(fields))
+	for _, f := range fields {
+		if f.value != "" {
+			headers = append(headers, kafka.Header{Key: f.key, Value: []byte(f.value)})
+		}
+	}
+	return headers
+}
+
+// IsPermanent Reports whether Kafka rejected the message itself, retrying it cannot succeed
+// Broker, leader and network errors are transient.
+func (k *KafkaOutput) IsPermanent(err error) bool {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, e := range writeErrs {
+			if e != nil && !k.IsPermanent(e) {
+				return false
+			}
+		}
+		return writeErrs.Count() > 0
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr {
+		case kafka.MessageSizeTooLarge, kafka.InvalidTopic, kafka.RecordListTooLarge, kafka.InvalidTimestamp, kafka.InvalidRecord:
+			return true
+		}
 	}
-	return k.writer.WriteMessages(ctx, kafka.Message{
-		Value: eventValue,
-		Time:  time.Now(),
-	})
+	return isPermanentDefault(err)
 }
 
 // Close Closes the Kafka connection
@@ -86,5 +346,7 @@ func (k *KafkaOutput) Send(ctx context.Context, event types.EventData) error {
 //
 //	error error if closing fails, otherwise nil
 func (k *KafkaOutput) Close() error {
-	return k.writer.Close()
+	err := k.writer.Close()
+	k.transport.CloseIdleConnections()
+	return err
 }
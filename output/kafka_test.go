@@ -0,0 +1,126 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// kafkaRowEvent Builds a row event of the users table keyed by id
+func kafkaRowEvent(typ types.EventRowType, id int) types.EventData {
+	return types.EventData{
+		Pos:    120,
+		File:   "mysql-bin.000003",
+		Source: "orders",
+		Row: types.EventRowData{
+			Database:   "shop",
+			Table:      "users",
+			Type:       typ,
+			Data:       map[string]any{"id": id, "name": "alice"},
+			PrimaryKey: []string{"id"},
+			Key:        map[string]any{"id": id},
+		},
+	}
+}
+
+func TestKafkaOutput_PrimaryKey(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{Key: KafkaKeyPrimaryKey})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.IsType(t, &kafka.Hash{}, k.writer.Balancer)
+
+	msgs, err := k.messages(kafkaRowEvent(types.InsertEventRowType, 7))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "shop.users:7", string(msgs[0].Key))
+	assert.Empty(t, msgs[0].Headers)
+
+	event := kafkaRowEvent(types.InsertEventRowType, 7)
+	event.Row.PrimaryKey = []string{"tenant", "id"}
+	event.Row.Key = map[string]any{"tenant": "acme", "id": 7}
+	msgs, err = k.messages(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "shop.users:acme,7", string(msgs[0].Key))
+
+	msgs, err = k.messages(types.EventData{Row: types.EventRowData{Type: types.CommitEventRowType}})
+	assert.NoError(t, err)
+	assert.Nil(t, msgs[0].Key)
+}
+
+func TestKafkaOutput_KeyTemplate(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{Key: "{{.Database}}.{{.Table}}:{{.Key.id}}"})
+	assert.NoError(t, err)
+	defer k.Close()
+
+	msgs, err := k.messages(kafkaRowEvent(types.UpdateEventRowType, 42))
+	assert.NoError(t, err)
+	assert.Equal(t, "shop.users:42", string(msgs[0].Key))
+
+	event := kafkaRowEvent(types.UpdateEventRowType, 42)
+	event.Row.Key = map[string]any{"uuid": "x"}
+	_, err = k.messages(event)
+	assert.Error(t, err)
+	assert.True(t, k.IsPermanent(err))
+
+	_, err = NewKafkaOutput(KafkaConfig{Key: "{{.Key.id"})
+	assert.Error(t, err)
+}
+
+func TestKafkaOutput_Headers(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{Headers: true})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.IsType(t, &kafka.LeastBytes{}, k.writer.Balancer)
+
+	msgs, err := k.messages(kafkaRowEvent(types.InsertEventRowType, 1))
+	assert.NoError(t, err)
+	assert.Nil(t, msgs[0].Key)
+	headers := make(map[string]string)
+	for _, h := range msgs[0].Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"database": "shop",
+		"table":    "users",
+		"type":     "insert",
+		"source":   "orders",
+		"position": "mysql-bin.000003:120",
+	}, headers)
+}
+
+func TestKafkaOutput_Tombstones(t *testing.T) {
+	_, err := NewKafkaOutput(KafkaConfig{Tombstones: true})
+	assert.Error(t, err)
+
+	k, err := NewKafkaOutput(KafkaConfig{Key: KafkaKeyPrimaryKey, Tombstones: true})
+	assert.NoError(t, err)
+	defer k.Close()
+
+	msgs, err := k.messages(kafkaRowEvent(types.DeleteEventRowType, 3))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.NotNil(t, msgs[0].Value)
+	assert.Equal(t, msgs[0].Key, msgs[1].Key)
+	assert.Nil(t, msgs[1].Value)
+
+	msgs, err = k.messages(kafkaRowEvent(types.UpdateEventRowType, 3))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+}
+
+func TestKafkaBalancer(t *testing.T) {
+	for name, want := range map[string]kafka.Balancer{
+		KafkaBalancerLeastBytes: &kafka.LeastBytes{},
+		KafkaBalancerHash:       &kafka.Hash{},
+		KafkaBalancerMurmur2:    kafka.Murmur2Balancer{},
+		KafkaBalancerRoundRobin: &kafka.RoundRobin{},
+	} {
+		b, err := kafkaBalancer(name, false)
+		assert.NoError(t, err)
+		assert.IsType(t, want, b, name)
+	}
+	_, err := kafkaBalancer("sticky", true)
+	assert.Error(t, err)
+}
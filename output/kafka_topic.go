@@ -0,0 +1,193 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// maxKafkaTopicLength Longest topic name Kafka accepts
+	maxKafkaTopicLength = 249
+)
+
+// invalidKafkaTopicChars Characters Kafka does not allow in topic names
+var invalidKafkaTopicChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// KafkaTopicOverride Sends the tables matching a regex to their own topic
+type KafkaTopicOverride struct {
+	// Match Regular expression matched against "database.table"
+	Match string `yaml:"match" json:"match" mapstructure:"match"`
+	// Topic Topic name or template of the matching tables
+	Topic string `yaml:"topic" json:"topic" mapstructure:"topic"`
+}
+
+// KafkaTopicCreation Settings of the topics created when they are missing
+type KafkaTopicCreation struct {
+	// Enabled Whether missing topics are created before the first write
+	Enabled bool `yaml:"enabled" json:"enabled" mapstructure:"enabled" env:"OUTPUT_KAFKA_AUTO_CREATE"`
+	// Partitions Partitions of a created topic, defaults to 1
+	Partitions int `yaml:"partitions" json:"partitions" mapstructure:"partitions" env:"OUTPUT_KAFKA_AUTO_CREATE_PARTITIONS"`
+	// ReplicationFactor Replicas of every partition of a created topic, defaults to 1
+	ReplicationFactor int `yaml:"replication_factor" json:"replication_factor" mapstructure:"replication_factor" env:"OUTPUT_KAFKA_AUTO_CREATE_REPLICATION_FACTOR"`
+}
+
+// kafkaTopicRule A compiled topic override
+type kafkaTopicRule struct {
+	match *regexp.Regexp
+	topic *template.Template
+}
+
+// kafkaTopics Resolves the topic of every event and creates missing topics
+type kafkaTopics struct {
+	// static Topic of every event, empty when topics depend on the event
+	static string
+	// fallback Topic of events without a table when topics depend on the event
+	fallback  string
+	template  *template.Template
+	overrides []kafkaTopicRule
+	create    KafkaTopicCreation
+	client    *kafka.Client
+	mu        sync.Mutex
+	// created Topics known to exist
+	created map[string]bool
+}
+
+// newKafkaTopics Compiles the topic template and overrides of a configuration
+func newKafkaTopics(cfg KafkaConfig, client *kafka.Client) (*kafkaTopics, error) {
+	t := &kafkaTopics{
+		fallback: cfg.DefaultTopic,
+		create:   cfg.AutoCreate,
+		client:   client,
+		created:  make(map[string]bool),
+	}
+	t.create.Partitions = max(t.create.Partitions, 1)
+	t.create.ReplicationFactor = max(t.create.ReplicationFactor, 1)
+	if !cfg.dynamicTopic() {
+		t.static = cfg.Topic
+		return t, nil
+	}
+	var err error
+	if t.template, err = parseTopicTemplate(cfg.Topic); err != nil {
+		return nil, fmt.Errorf("invalid kafka topic template: %w", err)
+	}
+	for i, o := range cfg.TopicOverrides {
+		match, err := regexp.Compile(o.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic_overrides[%d] match: %w", i, err)
+		}
+		topic, err := parseTopicTemplate(o.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic_overrides[%d] topic: %w", i, err)
+		}
+		t.overrides = append(t.overrides, kafkaTopicRule{match: match, topic: topic})
+	}
+	return t, nil
+}
+
+// parseTopicTemplate Parses a topic name or template
+func parseTopicTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, fmt.Errorf("empty topic")
+	}
+	return template.New("topic").Option("missingkey=error").Parse(text)
+}
+
+// dynamicTopic Reports whether the topic depends on the event
+func (cfg KafkaConfig) dynamicTopic() bool {
+	return strings.Contains(cfg.Topic, "{{") || len(cfg.TopicOverrides) > 0
+}
+
+// topic Returns the topic of a row, empty when every event goes to the static topic
+// The first override matching "database.table" wins, otherwise the topic template is used.
+func (t *kafkaTopics) topic(row types.EventRowData) (string, error) {
+	if t.template == nil {
+		return "", nil
+	}
+	if row.Table == "" {
+		return t.fallback, nil
+	}
+	tmpl := t.template
+	name := row.Database + "." + row.Table
+	for _, o := range t.overrides {
+		if o.match.MatchString(name) {
+			tmpl = o.topic
+			break
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, row); err != nil {
+		// The same event fails the same way on every attempt
+		return "", Permanent(fmt.Errorf("failed to render kafka topic: %w", err))
+	}
+	return sanitizeKafkaTopic(buf.String()), nil
+}
+
+// sanitizeKafkaTopic Replaces the characters Kafka rejects in topic names with "_", like Debezium does
+func sanitizeKafkaTopic(topic string) string {
+	topic = invalidKafkaTopicChars.ReplaceAllString(topic, "_")
+	if len(topic) > maxKafkaTopicLength {
+		topic = topic[:maxKafkaTopicLength]
+	}
+	return topic
+}
+
+// ensure Creates the topics of the messages that were not seen before
+// Does nothing unless auto-creation is enabled; topics that already exist count as created.
+func (t *kafkaTopics) ensure(ctx context.Context, messages []kafka.Message) error {
+	if !t.create.Enabled {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var missing []kafka.TopicConfig
+	for _, msg := range messages {
+		topic := msg.Topic
+		if topic == "" {
+			topic = t.static
+		}
+		if t.created[topic] {
+			continue
+		}
+		t.created[topic] = true
+		missing = append(missing, kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     t.create.Partitions,
+			ReplicationFactor: t.create.ReplicationFactor,
+		})
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	err := t.createTopics(ctx, missing)
+	if err != nil {
+		// Try again with the next send
+		for _, tc := range missing {
+			delete(t.created, tc.Topic)
+		}
+	}
+	return err
+}
+
+// createTopics Sends one CreateTopics request, ignoring topics that already exist
+func (t *kafkaTopics) createTopics(ctx context.Context, topics []kafka.TopicConfig) error {
+	resp, err := t.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("failed to create kafka topics: %w", err)
+	}
+	var errs []error
+	for topic, err := range resp.Errors {
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			errs = append(errs, fmt.Errorf("failed to create kafka topic %s: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaTopics_Static(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{Topic: "events"})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.Equal(t, "events", k.writer.Topic)
+
+	msgs, err := k.messages(kafkaRowEvent(types.InsertEventRowType, 1))
+	assert.NoError(t, err)
+	assert.Empty(t, msgs[0].Topic)
+}
+
+func TestKafkaTopics_Template(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{
+		Topic:        "cdc.{{.Database}}.{{.Table}}",
+		DefaultTopic: "cdc.transaction",
+		TopicOverrides: []KafkaTopicOverride{
+			{Match: `^shop\.audit_`, Topic: "cdc.audit"},
+			{Match: `^shop\.`, Topic: "shop.{{.Table}}"},
+		},
+	})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.Empty(t, k.writer.Topic)
+
+	for table, want := range map[string]string{
+		"audit_logins": "cdc.audit",
+		"users":        "shop.users",
+	} {
+		event := kafkaRowEvent(types.InsertEventRowType, 1)
+		event.Row.Table = table
+		msgs, err := k.messages(event)
+		assert.NoError(t, err)
+		assert.Equal(t, want, msgs[0].Topic, table)
+	}
+
+	topic, err := k.topics.topic(types.EventRowData{Database: "crm", Table: "leads"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cdc.crm.leads", topic)
+
+	topic, err = k.topics.topic(types.EventRowData{Database: "crm", Table: "order items$"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cdc.crm.order_items_", topic)
+
+	topic, err = k.topics.topic(types.EventRowData{Type: types.CommitEventRowType})
+	assert.NoError(t, err)
+	assert.Equal(t, "cdc.transaction", topic)
+}
+
+func TestKafkaTopics_Invalid(t *testing.T) {
+	_, err := NewKafkaOutput(KafkaConfig{Topic: "cdc.{{.Table"})
+	assert.Error(t, err)
+
+	_, err = NewKafkaOutput(KafkaConfig{TopicOverrides: []KafkaTopicOverride{{Match: "(", Topic: "x"}}})
+	assert.Error(t, err)
+
+	_, err = NewKafkaOutput(KafkaConfig{TopicOverrides: []KafkaTopicOverride{{Match: "shop"}}})
+	assert.Error(t, err)
+
+	k, err := NewKafkaOutput(KafkaConfig{Topic: "cdc.{{.Key.id}}"})
+	assert.NoError(t, err)
+	defer k.Close()
+	_, err = k.topics.topic(types.EventRowData{Database: "shop", Table: "users"})
+	assert.Error(t, err)
+	assert.True(t, k.IsPermanent(err))
+
+	_, err = NewDLQOutput(DLQConfig{Type: OutputTypeKafka, Kafka: KafkaConfig{Topic: "dlq.{{.Table}}"}})
+	assert.Error(t, err)
+}
+
+func TestKafkaTopics_EnsureKnown(t *testing.T) {
+	topics, err := newKafkaTopics(KafkaConfig{Topic: "events", AutoCreate: KafkaTopicCreation{Enabled: true}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, topics.create.Partitions)
+	assert.Equal(t, 1, topics.create.ReplicationFactor)
+
+	// Known topics are not created again, so no client is needed
+	topics.created["events"] = true
+	assert.NoError(t, topics.ensure(context.Background(), []kafka.Message{{}, {}}))
+
+	topics.create.Enabled = false
+	assert.NoError(t, topics.ensure(context.Background(), []kafka.Message{{Topic: "other"}}))
+}
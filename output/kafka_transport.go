@@ -0,0 +1,166 @@
+package output
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	// KafkaSASLPlain Sends the username and password in clear text, use it with TLS
+	KafkaSASLPlain = "plain"
+	// KafkaSASLScramSHA256 Salted challenge-response authentication with SHA-256
+	KafkaSASLScramSHA256 = "scram-sha-256"
+	// KafkaSASLScramSHA512 Salted challenge-response authentication with SHA-512
+	KafkaSASLScramSHA512 = "scram-sha-512"
+
+	// kafkaDialTimeout Timeout of connecting to a broker, including the TLS handshake
+	kafkaDialTimeout = 10 * time.Second
+)
+
+// KafkaSASLConfig Authentication against the brokers
+type KafkaSASLConfig struct {
+	// Mechanism SASL mechanism: plain / scram-sha-256 / scram-sha-512, empty disables SASL
+	Mechanism string `yaml:"mechanism" json:"mechanism" mapstructure:"mechanism" env:"OUTPUT_KAFKA_SASL_MECHANISM"`
+	// Username SASL username
+	Username string `yaml:"username" json:"username" mapstructure:"username" env:"OUTPUT_KAFKA_SASL_USERNAME"`
+	// Password SASL password
+	Password string `yaml:"password" json:"password" mapstructure:"password" env:"OUTPUT_KAFKA_SASL_PASSWORD"`
+}
+
+// KafkaTLSConfig Encryption of the broker connections
+type KafkaTLSConfig struct {
+	// Enabled Whether to connect with TLS
+	Enabled bool `yaml:"enabled" json:"enabled" mapstructure:"enabled" env:"OUTPUT_KAFKA_TLS_ENABLED"`
+	// CAFile PEM file of the CAs that sign the broker certificates, empty uses the system pool
+	CAFile string `yaml:"ca_file" json:"ca_file" mapstructure:"ca_file" env:"OUTPUT_KAFKA_TLS_CA_FILE"`
+	// CertFile PEM client certificate, for brokers requiring mutual TLS
+	CertFile string `yaml:"cert_file" json:"cert_file" mapstructure:"cert_file" env:"OUTPUT_KAFKA_TLS_CERT_FILE"`
+	// KeyFile PEM private key of the client certificate
+	KeyFile string `yaml:"key_file" json:"key_file" mapstructure:"key_file" env:"OUTPUT_KAFKA_TLS_KEY_FILE"`
+	// ServerName Name verified against the broker certificates, defaults to the broker host
+	ServerName string `yaml:"server_name" json:"server_name" mapstructure:"server_name" env:"OUTPUT_KAFKA_TLS_SERVER_NAME"`
+	// InsecureSkipVerify Whether to accept any broker certificate, for testing only
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify" mapstructure:"insecure_skip_verify" env:"OUTPUT_KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// kafkaTransport Creates the transport of the writer and the admin client
+func kafkaTransport(cfg KafkaConfig) (*kafka.Transport, error) {
+	mechanism, err := kafkaSASLMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		DialTimeout: kafkaDialTimeout,
+		SASL:        mechanism,
+		TLS:         tlsConfig,
+	}, nil
+}
+
+// kafkaDialer Creates the dialer of a reader, with the same security settings as the writer
+func kafkaDialer(cfg KafkaConfig) (*kafka.Dialer, error) {
+	mechanism, err := kafkaSASLMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       kafkaDialTimeout,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsConfig,
+	}, nil
+}
+
+// kafkaSASLMechanism Creates the SASL mechanism, nil when SASL is disabled
+func kafkaSASLMechanism(cfg KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "":
+		return nil, nil
+	case KafkaSASLPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case KafkaSASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case KafkaSASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("unsupported kafka sasl mechanism: %s", cfg.Mechanism)
+	}
+}
+
+// kafkaTLSConfig Loads the CA and client certificates, nil when TLS is disabled
+func kafkaTLSConfig(cfg KafkaTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kafka ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in kafka ca file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// kafkaCompression Resolves the compression codec by name, 0 disables compression
+func kafkaCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka compression: %s", name)
+	}
+}
+
+// kafkaRequiredAcks Resolves the acknowledgements a write waits for
+func kafkaRequiredAcks(name string) (kafka.RequiredAcks, error) {
+	switch name {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka required acks: %s", name)
+	}
+}
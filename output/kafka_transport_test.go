@@ -0,0 +1,120 @@
+package output
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert Writes a self-signed certificate and its key as PEM files
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dbxgo-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestKafkaSASLMechanism(t *testing.T) {
+	m, err := kafkaSASLMechanism(KafkaSASLConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	for mechanism, name := range map[string]string{
+		KafkaSASLPlain:       "PLAIN",
+		KafkaSASLScramSHA256: "SCRAM-SHA-256",
+		KafkaSASLScramSHA512: "SCRAM-SHA-512",
+	} {
+		m, err := kafkaSASLMechanism(KafkaSASLConfig{Mechanism: mechanism, Username: "dbxgo", Password: "secret"})
+		assert.NoError(t, err)
+		assert.Equal(t, name, m.Name())
+	}
+
+	_, err = kafkaSASLMechanism(KafkaSASLConfig{Mechanism: "gssapi"})
+	assert.Error(t, err)
+}
+
+func TestKafkaTLSConfig(t *testing.T) {
+	c, err := kafkaTLSConfig(KafkaTLSConfig{CAFile: "/does/not/exist"})
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	certFile, keyFile := writeTestCert(t)
+	c, err = kafkaTLSConfig(KafkaTLSConfig{
+		Enabled:    true,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "kafka.internal",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, c.RootCAs)
+	assert.Len(t, c.Certificates, 1)
+	assert.Equal(t, "kafka.internal", c.ServerName)
+
+	_, err = kafkaTLSConfig(KafkaTLSConfig{Enabled: true, CAFile: keyFile})
+	assert.Error(t, err)
+
+	_, err = kafkaTLSConfig(KafkaTLSConfig{Enabled: true, CertFile: certFile})
+	assert.Error(t, err)
+}
+
+func TestKafkaOutput_ProducerSettings(t *testing.T) {
+	k, err := NewKafkaOutput(KafkaConfig{
+		SASL:         KafkaSASLConfig{Mechanism: KafkaSASLScramSHA512, Username: "dbxgo", Password: "secret"},
+		TLS:          KafkaTLSConfig{Enabled: true},
+		Compression:  "zstd",
+		RequiredAcks: "one",
+		BatchSize:    500,
+		BatchTimeout: 10,
+		WriteTimeout: 5000,
+	})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.Equal(t, kafka.Zstd, k.writer.Compression)
+	assert.Equal(t, kafka.RequireOne, k.writer.RequiredAcks)
+	assert.Equal(t, 500, k.writer.BatchSize)
+	assert.Equal(t, 10*time.Millisecond, k.writer.BatchTimeout)
+	assert.Equal(t, 5*time.Second, k.writer.WriteTimeout)
+	assert.Equal(t, "SCRAM-SHA-512", k.transport.SASL.Name())
+	assert.NotNil(t, k.transport.TLS)
+
+	k, err = NewKafkaOutput(KafkaConfig{})
+	assert.NoError(t, err)
+	defer k.Close()
+	assert.Equal(t, kafka.Compression(0), k.writer.Compression)
+	assert.Equal(t, kafka.RequireAll, k.writer.RequiredAcks)
+
+	_, err = NewKafkaOutput(KafkaConfig{Compression: "brotli"})
+	assert.Error(t, err)
+
+	_, err = NewKafkaOutput(KafkaConfig{RequiredAcks: "two"})
+	assert.Error(t, err)
+}
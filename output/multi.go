@@ -0,0 +1,183 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+)
+
+// MultiPolicy Decides when a fan-out send counts as delivered
+type MultiPolicy string
+
+const (
+	// MultiPolicyAll Every child output must accept the event
+	MultiPolicyAll MultiPolicy = "all"
+	// MultiPolicyBestEffort Child failures are logged, the send never fails
+	MultiPolicyBestEffort MultiPolicy = "best_effort"
+	// MultiPolicyQuorum At least Quorum child outputs must accept the event
+	MultiPolicyQuorum MultiPolicy = "quorum"
+)
+
+// MultiConfig Sends every event to several outputs
+type MultiConfig struct {
+	// Outputs Child outputs, each created through the output registry
+	Outputs []Config `yaml:"outputs" json:"outputs" mapstructure:"outputs"`
+	// Policy Delivery policy: all / best_effort / quorum
+	Policy MultiPolicy `yaml:"policy" json:"policy" mapstructure:"policy" env:"OUTPUT_MULTI_POLICY" envDefault:"all"`
+	// Quorum Successful children required by the quorum policy, defaults to a majority
+	Quorum int `yaml:"quorum" json:"quorum" mapstructure:"quorum" env:"OUTPUT_MULTI_QUORUM"`
+}
+
+// ChildError Failure of one child output of a fan-out send
+type ChildError struct {
+	// Index Position of the child in MultiConfig.Outputs
+	Index int
+	// Type Output type of the child
+	Type OutputType
+	Err  error
+}
+
+// Error Names the failing child
+func (e *ChildError) Error() string {
+	return fmt.Sprintf("outputs[%d] (%s): %v", e.Index, e.Type, e.Err)
+}
+
+// Unwrap Returns the error of the child
+func (e *ChildError) Unwrap() error {
+	return e.Err
+}
+
+// multiChild A child output with the type it was created from
+type multiChild struct {
+	output IOutput
+	typ    OutputType
+}
+
+// MultiOutput Sends every event to all child outputs concurrently
+// Retrying a failed send resends to every child, children that already accepted the event receive it again.
+type MultiOutput struct {
+	children []multiChild
+	policy   MultiPolicy
+	quorum   int
+}
+
+// NewMultiOutput Creates the child outputs
+// cfg: Fan-out configuration
+// Returns: Fan-out output and an error when the policy is unknown or a child cannot be created
+func NewMultiOutput(cfg MultiConfig) (*MultiOutput, error) {
+	if len(cfg.Outputs) == 0 {
+		return nil, fmt.Errorf("multi output has no child outputs")
+	}
+	children := make([]multiChild, 0, len(cfg.Outputs))
+	for i, oc := range cfg.Outputs {
+		o, err := NewOutput(oc)
+		if err != nil {
+			closeChildren(children)
+			return nil, fmt.Errorf("failed to create outputs[%d]: %w", i, err)
+		}
+		children = append(children, multiChild{output: o, typ: oc.Type})
+	}
+	m, err := newMultiOutput(children, cfg.Policy, cfg.Quorum)
+	if err != nil {
+		closeChildren(children)
+		return nil, err
+	}
+	return m, nil
+}
+
+// newMultiOutput Validates the policy against already created children
+func newMultiOutput(children []multiChild, policy MultiPolicy, quorum int) (*MultiOutput, error) {
+	switch policy {
+	case "":
+		policy = MultiPolicyAll
+	case MultiPolicyAll, MultiPolicyBestEffort:
+	case MultiPolicyQuorum:
+		if quorum <= 0 {
+			quorum = len(children)/2 + 1
+		}
+		if quorum > len(children) {
+			return nil, fmt.Errorf("quorum %d exceeds the %d child outputs", quorum, len(children))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported multi output policy: %s", policy)
+	}
+	return &MultiOutput{children: children, policy: policy, quorum: quorum}, nil
+}
+
+// Send Sends the event to every child and applies the delivery policy
+// The returned error joins a *ChildError per failed child
+func (m *MultiOutput) Send(ctx context.Context, event types.EventData) error {
+	errs := make([]error, len(m.children))
+	var wg sync.WaitGroup
+	for i, c := range m.children {
+		wg.Add(1)
+		go func(i int, c multiChild) {
+			defer wg.Done()
+			if err := c.output.Send(ctx, event); err != nil {
+				errs[i] = &ChildError{Index: i, Type: c.typ, Err: err}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%d of %d outputs failed: %w", failed, len(m.children), errors.Join(errs...))
+	switch m.policy {
+	case MultiPolicyBestEffort:
+		logx.Warn("multi output delivered with failures: %v", err)
+		return nil
+	case MultiPolicyQuorum:
+		if len(m.children)-failed >= m.quorum {
+			logx.Warn("multi output reached its quorum with failures: %v", err)
+			return nil
+		}
+	}
+	return err
+}
+
+// IsPermanent Reports whether every failed child failed permanently
+func (m *MultiOutput) IsPermanent(err error) bool {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return isPermanentDefault(err)
+	}
+	found := false
+	for _, e := range joined.Unwrap() {
+		var childErr *ChildError
+		if !errors.As(e, &childErr) || childErr.Index >= len(m.children) {
+			continue
+		}
+		if !IsPermanent(m.children[childErr.Index].output, childErr.Err) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// Close Closes every child output
+func (m *MultiOutput) Close() error {
+	return closeChildren(m.children)
+}
+
+// closeChildren Closes child outputs and returns the first error
+func closeChildren(children []multiChild) error {
+	var firstErr error
+	for i, c := range children {
+		if err := c.output.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close outputs[%d]: %w", i, err)
+		}
+	}
+	return firstErr
+}
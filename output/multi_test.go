@@ -0,0 +1,88 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// failOutput Rejects every event
+type failOutput struct{}
+
+func (failOutput) Send(ctx context.Context, event types.EventData) error {
+	return fmt.Errorf("broker unavailable")
+}
+
+func (failOutput) Close() error { return nil }
+
+func newMultiChildren(outputs ...IOutput) []multiChild {
+	children := make([]multiChild, len(outputs))
+	for i, o := range outputs {
+		children[i] = multiChild{output: o, typ: OutputTypeStdout}
+	}
+	return children
+}
+
+func TestMultiOutput_AllDeliversToEveryChild(t *testing.T) {
+	a, b := &recordOutput{}, &recordOutput{}
+	m, err := newMultiOutput(newMultiChildren(a, b), "", 0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Send(context.Background(), routeEvent("orders", types.InsertEventRowType)))
+	assert.Equal(t, []string{"orders"}, a.tables)
+	assert.Equal(t, []string{"orders"}, b.tables)
+
+	assert.NoError(t, m.Close())
+	assert.True(t, a.closed && b.closed)
+}
+
+func TestMultiOutput_AllReportsChildErrors(t *testing.T) {
+	a := &recordOutput{}
+	m, err := newMultiOutput(newMultiChildren(a, failOutput{}), MultiPolicyAll, 0)
+	assert.NoError(t, err)
+
+	err = m.Send(context.Background(), routeEvent("orders", types.InsertEventRowType))
+	assert.ErrorContains(t, err, "1 of 2 outputs failed")
+	var childErr *ChildError
+	assert.True(t, errors.As(err, &childErr))
+	assert.Equal(t, 1, childErr.Index)
+	assert.Equal(t, []string{"orders"}, a.tables)
+}
+
+func TestMultiOutput_BestEffort(t *testing.T) {
+	m, err := newMultiOutput(newMultiChildren(failOutput{}, failOutput{}), MultiPolicyBestEffort, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Send(context.Background(), routeEvent("orders", types.InsertEventRowType)))
+}
+
+func TestMultiOutput_Quorum(t *testing.T) {
+	event := routeEvent("orders", types.InsertEventRowType)
+	// Majority of three is two
+	m, err := newMultiOutput(newMultiChildren(&recordOutput{}, &recordOutput{}, failOutput{}), MultiPolicyQuorum, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Send(context.Background(), event))
+
+	m, err = newMultiOutput(newMultiChildren(&recordOutput{}, failOutput{}, failOutput{}), MultiPolicyQuorum, 0)
+	assert.NoError(t, err)
+	assert.Error(t, m.Send(context.Background(), event))
+
+	_, err = newMultiOutput(newMultiChildren(&recordOutput{}), MultiPolicyQuorum, 2)
+	assert.Error(t, err)
+	_, err = newMultiOutput(newMultiChildren(&recordOutput{}), "some", 0)
+	assert.Error(t, err)
+}
+
+func TestNewMultiOutput_FromRegistry(t *testing.T) {
+	o, err := NewOutput(Config{Type: OutputTypeMulti, Multi: MultiConfig{
+		Outputs: []Config{{Type: OutputTypeStdout}, {Type: OutputTypeStdout}},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, o.Close())
+
+	_, err = NewMultiOutput(MultiConfig{})
+	assert.Error(t, err)
+}
@@ -3,7 +3,6 @@ package output
 import (
 	"context"
 	"github.com/chihqiang/dbxgo/types"
-	"time"
 )
 
 type OutputType string
@@ -15,6 +14,9 @@ var (
 	OutputTypeRabbitMQ OutputType = "rabbitmq"
 	OutputTypeRocketMQ OutputType = "rocketmq"
 	OutputTypePulsar   OutputType = "pulsar"
+	OutputTypeRouter   OutputType = "router"
+	OutputTypeMulti    OutputType = "multi"
+	OutputTypeFile     OutputType = "file"
 	outputs                       = map[OutputType]func(Config) (IOutput, error){}
 )
 
@@ -37,6 +39,15 @@ func init() {
 	Register(OutputTypePulsar, func(cfg Config) (IOutput, error) {
 		return NewPulsarOutput(cfg.Pulsar)
 	})
+	Register(OutputTypeRouter, func(cfg Config) (IOutput, error) {
+		return NewRouterOutput(cfg.Router)
+	})
+	Register(OutputTypeMulti, func(cfg Config) (IOutput, error) {
+		return NewMultiOutput(cfg.Multi)
+	})
+	Register(OutputTypeFile, func(cfg Config) (IOutput, error) {
+		return NewFileOutput(cfg.File)
+	})
 }
 
 func Register(outputType OutputType, fn func(Config) (IOutput, error)) {
@@ -50,6 +61,13 @@ type Config struct {
 	RabbitMQ RabbitMQConfig `yaml:"rabbitmq" json:"rabbitmq" mapstructure:"rabbitmq"`
 	RocketMQ RocketMQConfig `yaml:"rocketmq" json:"rocketmq" mapstructure:"rocketmq"`
 	Pulsar   PulsarConfig   `yaml:"pulsar" json:"pulsar" mapstructure:"pulsar"`
+	Router   RouterConfig   `yaml:"router" json:"router" mapstructure:"router"`
+	Multi    MultiConfig    `yaml:"multi" json:"multi" mapstructure:"multi"`
+	File     FileConfig     `yaml:"file" json:"file" mapstructure:"file"`
+	// Retry Retry policy of failed sends, only applied to the top-level output of a source or pipeline
+	Retry RetryConfig `yaml:"retry" json:"retry" mapstructure:"retry"`
+	// Breaker Circuit breaker pausing sends while the output is down, only applied to the top-level output
+	Breaker BreakerConfig `yaml:"breaker" json:"breaker" mapstructure:"breaker"`
 }
 
 // IOutput Defines the event output interface
@@ -70,19 +88,3 @@ func NewOutput(cfg Config) (IOutput, error) {
 	// Call the constructor function to create the output instance
 	return creator(cfg)
 }
-
-// SendWithRetry Sends with retry functionality
-func SendWithRetry(ctx context.Context, output IOutput, event types.EventData, maxRetries int) error {
-	var lastErr error
-	for i := 0; i <= maxRetries; i++ {
-		if err := output.Send(ctx, event); err == nil {
-			return nil
-		} else {
-			lastErr = err
-			if i < maxRetries {
-				time.Sleep(time.Duration(i+1) * 100 * time.Millisecond)
-			}
-		}
-	}
-	return lastErr
-}
@@ -6,6 +6,7 @@ import (
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/chihqiang/dbxgo/pkg/structx"
 	"github.com/chihqiang/dbxgo/types"
+	"sync"
 	"time"
 )
 
@@ -73,6 +74,44 @@ func (p *PulsarOutput) Send(ctx context.Context, event types.EventData) error {
 	return err
 }
 
+// SendBatch sends the events asynchronously and waits until Pulsar confirmed all of them
+// The producer groups the pending messages into batches itself
+func (p *PulsarOutput) SendBatch(ctx context.Context, events []types.EventData) error {
+	payloads := make([][]byte, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, payload)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	wg.Add(len(payloads))
+	for _, payload := range payloads {
+		p.producer.SendAsync(ctx, &pulsar.ProducerMessage{Payload: payload}, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			defer wg.Done()
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	flushErr := p.producer.FlushWithCtx(ctx)
+	// Every callback runs eventually, at the latest when the send timeout expires
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return flushErr
+}
+
 // Close closes the producer and client
 func (p *PulsarOutput) Close() error {
 	if p.producer != nil {
@@ -170,3 +170,18 @@ func TestPulsarOutput_Close(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestPulsarOutput_SendBatch(t *testing.T) {
+	mp := &mockPulsarProducer{}
+	pout := &PulsarOutput{client: &mockClient{producer: mp}, producer: mp}
+
+	events := []types.EventData{
+		{Row: types.EventRowData{Table: "orders"}},
+		{Row: types.EventRowData{Table: "users"}},
+	}
+	assert.NoError(t, pout.SendBatch(context.Background(), events))
+	assert.Len(t, mp.sentMessages, 2)
+
+	mp.returnError = true
+	assert.Error(t, pout.SendBatch(context.Background(), events))
+}
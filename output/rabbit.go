@@ -89,6 +89,36 @@ func (r *RabbitMQOutput) Send(ctx context.Context, event types.EventData) error
 	)
 }
 
+// SendBatch Serializes the events and publishes them back to back on the channel
+// Publishing does not wait for the broker, so a batch costs no round trip per event
+func (r *RabbitMQOutput) SendBatch(ctx context.Context, events []types.EventData) error {
+	bodies := make([][]byte, 0, len(events))
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		bodies = append(bodies, body)
+	}
+	for _, body := range bodies {
+		err := r.ch.PublishWithContext(ctx,
+			r.config.Exchange,
+			r.config.Queue,
+			false,
+			false,
+			amqp091.Publishing{
+				ContentType: "application/json",
+				Body:        body,
+				Timestamp:   time.Now(),
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Close Closes the RabbitMQ connection
 func (r *RabbitMQOutput) Close() error {
 	if r.ch != nil {
@@ -3,11 +3,13 @@ package output
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/chihqiang/dbxgo/pkg/redisx"
 	"github.com/chihqiang/dbxgo/pkg/structx"
 	"github.com/chihqiang/dbxgo/types"
 	"github.com/redis/go-redis/v9"
+	"strings"
 )
 
 // RedisConfig Redis configuration entity
@@ -60,6 +62,41 @@ func (r *RedisOutput) Send(ctx context.Context, event types.EventData) error {
 	return nil
 }
 
+// SendBatch Pushes the events to the list in one pipelined round trip
+func (r *RedisOutput) SendBatch(ctx context.Context, events []types.EventData) error {
+	values := make([][]byte, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, data := range values {
+			pipe.LPush(ctx, r.key, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push events to Redis: %w", err)
+	}
+	return nil
+}
+
+// IsPermanent Reports whether Redis refused the command for good, e.g. the key holds another type
+// Connection errors and replies such as LOADING or READONLY are transient.
+func (r *RedisOutput) IsPermanent(err error) bool {
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		if strings.HasPrefix(msg, "WRONGTYPE") || strings.HasPrefix(msg, "NOPERM") {
+			return true
+		}
+	}
+	return isPermanentDefault(err)
+}
+
 // Close Closes the Redis client
 func (r *RedisOutput) Close() error {
 	return r.rdb.Close()
@@ -112,3 +112,28 @@ func TestRedisOutput_Send_InvalidJSON(t *testing.T) {
 	err = rout.Send(ctx, event)
 	assert.Error(t, err, "should return error for invalid JSON")
 }
+
+func TestRedisOutput_SendBatch(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	rout, err := NewRedisOutput(RedisConfig{Addr: mr.Addr(), Key: "batch-events"})
+	assert.NoError(t, err)
+	defer rout.Close()
+
+	events := []types.EventData{
+		{Row: types.EventRowData{Table: "orders"}},
+		{Row: types.EventRowData{Table: "users"}},
+	}
+	assert.NoError(t, rout.SendBatch(context.Background(), events))
+
+	// LPUSH keeps the newest event at the head, as with single sends
+	items, err := mr.List("batch-events")
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		var head types.EventData
+		assert.NoError(t, json.Unmarshal([]byte(items[0]), &head))
+		assert.Equal(t, "users", head.Row.Table)
+	}
+}
@@ -0,0 +1,230 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+)
+
+const (
+	// defaultMaxAttempts Send attempts of an event when none are configured
+	defaultMaxAttempts = 4
+	// defaultInitialInterval Delay before the first retry
+	defaultInitialInterval = 100 * time.Millisecond
+	// defaultMaxInterval Upper limit of the retry delay
+	defaultMaxInterval = 10 * time.Second
+	// defaultMultiplier Growth factor of the retry delay
+	defaultMultiplier = 2
+)
+
+// RetryConfig Defines how a failed send is retried
+// The delay starts at InitialInterval and grows by Multiplier up to MaxInterval,
+// each delay is randomized by ±Jitter to avoid retrying in lockstep.
+type RetryConfig struct {
+	// MaxAttempts Send attempts per event including the first one, defaults to 4; negative retries until shutdown
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts" mapstructure:"max_attempts" env:"OUTPUT_RETRY_MAX_ATTEMPTS"`
+	// InitialInterval Delay before the first retry in milliseconds, defaults to 100
+	InitialInterval int `yaml:"initial_interval" json:"initial_interval" mapstructure:"initial_interval" env:"OUTPUT_RETRY_INITIAL_INTERVAL"`
+	// MaxInterval Upper limit of the delay in milliseconds, defaults to 10000
+	MaxInterval int `yaml:"max_interval" json:"max_interval" mapstructure:"max_interval" env:"OUTPUT_RETRY_MAX_INTERVAL"`
+	// Multiplier Growth factor of the delay, defaults to 2
+	Multiplier float64 `yaml:"multiplier" json:"multiplier" mapstructure:"multiplier" env:"OUTPUT_RETRY_MULTIPLIER"`
+	// Jitter Random fraction (0-1) added to or removed from every delay, 0 disables it
+	Jitter float64 `yaml:"jitter" json:"jitter" mapstructure:"jitter" env:"OUTPUT_RETRY_JITTER"`
+}
+
+// PermanentError Marks an error that retrying cannot fix, e.g. an event the downstream rejects
+type PermanentError struct {
+	Err error
+}
+
+// Error Returns the message of the wrapped error
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap Returns the wrapped error
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent Marks an error as permanent, nil stays nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// ErrorClassifier Implemented by outputs that know which of their errors are permanent
+type ErrorClassifier interface {
+	// IsPermanent Reports whether retrying the send cannot fix the error
+	IsPermanent(err error) bool
+}
+
+// IsPermanent Reports whether an error of an output is permanent
+// Outputs implementing ErrorClassifier decide themselves, otherwise errors marked with
+// Permanent and events that cannot be encoded are permanent.
+func IsPermanent(output IOutput, err error) bool {
+	if c, ok := output.(ErrorClassifier); ok {
+		return c.IsPermanent(err)
+	}
+	return isPermanentDefault(err)
+}
+
+// isPermanentDefault Classifies errors every output shares
+func isPermanentDefault(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var (
+		permanent  *PermanentError
+		typeErr    *json.UnsupportedTypeError
+		valueErr   *json.UnsupportedValueError
+		marshalErr *json.MarshalerError
+	)
+	return errors.As(err, &permanent) || errors.As(err, &typeErr) || errors.As(err, &valueErr) || errors.As(err, &marshalErr)
+}
+
+// Retrier Sends events to an output following a retry policy and a circuit breaker
+// It is safe for concurrent use, the breaker is shared by every caller.
+type Retrier struct {
+	output      IOutput
+	breaker     *Breaker
+	maxAttempts int
+	initial     time.Duration
+	maxInterval time.Duration
+	multiplier  float64
+	jitter      float64
+	// sleep Waits between attempts, replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetrier Creates a retrier with the defaults applied to unset options
+// output: Output the events are sent to
+// retry: Retry policy
+// breaker: Circuit breaker settings, a zero failure threshold disables the breaker
+func NewRetrier(output IOutput, retry RetryConfig, breaker BreakerConfig) *Retrier {
+	r := &Retrier{
+		output:      output,
+		breaker:     NewBreaker(breaker),
+		maxAttempts: retry.MaxAttempts,
+		initial:     time.Duration(retry.InitialInterval) * time.Millisecond,
+		maxInterval: time.Duration(retry.MaxInterval) * time.Millisecond,
+		multiplier:  retry.Multiplier,
+		jitter:      min(max(retry.Jitter, 0), 1),
+		sleep:       sleepContext,
+	}
+	if r.maxAttempts == 0 {
+		r.maxAttempts = defaultMaxAttempts
+	}
+	if r.initial <= 0 {
+		r.initial = defaultInitialInterval
+	}
+	if r.maxInterval <= 0 {
+		r.maxInterval = defaultMaxInterval
+	}
+	if r.multiplier < 1 {
+		r.multiplier = defaultMultiplier
+	}
+	return r
+}
+
+// Output Returns the output the retrier sends to
+func (r *Retrier) Output() IOutput {
+	return r.output
+}
+
+// Send Sends the event, retrying transient errors
+// While the breaker is open it waits instead of spending attempts, pausing the caller until the
+// downstream recovers; failures that open the breaker and failed probes do not count against
+// the attempt limit. Permanent errors and ctx cancellation end the send immediately.
+// Returns: Attempts made and the last error, nil once the event was delivered
+func (r *Retrier) Send(ctx context.Context, event types.EventData) (int, error) {
+	return r.do(ctx, func(ctx context.Context) error {
+		return r.output.Send(ctx, event)
+	})
+}
+
+// SendBatch Sends the events as one batch with the same policy as Send
+// A failed batch is retried as a whole; outputs without BatchOutput get the events one by one.
+func (r *Retrier) SendBatch(ctx context.Context, events []types.EventData) (int, error) {
+	return r.do(ctx, func(ctx context.Context) error {
+		return SendBatch(ctx, r.output, events)
+	})
+}
+
+// do Runs send until it succeeds, following the retry policy and the breaker
+func (r *Retrier) do(ctx context.Context, send func(context.Context) error) (int, error) {
+	// spent Attempts counted against maxAttempts, made while the breaker was closed
+	attempts, spent := 0, 0
+	delay := r.initial
+	var lastErr error
+	for {
+		if err := r.breaker.Wait(ctx); err != nil {
+			if lastErr == nil {
+				lastErr = err
+			}
+			return attempts, lastErr
+		}
+		attempts++
+		err := send(ctx)
+		if err == nil {
+			r.breaker.Success()
+			return attempts, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			r.breaker.Release()
+			return attempts, err
+		}
+		if IsPermanent(r.output, err) {
+			// The downstream answered, it is up even though it rejected the event
+			r.breaker.Success()
+			return attempts, Permanent(err)
+		}
+		if r.breaker.Failure() {
+			// The downstream is down, the breaker paces the next attempt
+			continue
+		}
+		spent++
+		if r.maxAttempts > 0 && spent >= r.maxAttempts {
+			return attempts, err
+		}
+		if err := r.sleep(ctx, r.jittered(delay)); err != nil {
+			return attempts, lastErr
+		}
+		delay = min(time.Duration(float64(delay)*r.multiplier), r.maxInterval)
+	}
+}
+
+// jittered Randomizes a delay by ±jitter
+func (r *Retrier) jittered(d time.Duration) time.Duration {
+	if r.jitter == 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + r.jitter*(2*rand.Float64()-1)))
+}
+
+// sleepContext Sleeps for d, returning early with the error of ctx once it is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendWithRetry Sends with retry functionality
+// maxRetries: Retries after the first attempt, with exponential backoff and no circuit breaker
+func SendWithRetry(ctx context.Context, output IOutput, event types.EventData, maxRetries int) error {
+	_, err := NewRetrier(output, RetryConfig{MaxAttempts: maxRetries + 1}, BreakerConfig{}).Send(ctx, event)
+	return err
+}
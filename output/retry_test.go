@@ -0,0 +1,123 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyOutput Fails with err until failures sends have been made
+type flakyOutput struct {
+	err      error
+	failures int
+	sends    int
+}
+
+func (o *flakyOutput) Send(ctx context.Context, event types.EventData) error {
+	o.sends++
+	if o.failures < 0 || o.sends <= o.failures {
+		return o.err
+	}
+	return nil
+}
+
+func (o *flakyOutput) Close() error { return nil }
+
+// newTestRetrier Creates a retrier recording its delays instead of sleeping
+func newTestRetrier(o IOutput, retry RetryConfig, breaker BreakerConfig) (*Retrier, *[]time.Duration) {
+	r := NewRetrier(o, retry, breaker)
+	delays := &[]time.Duration{}
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return ctx.Err()
+	}
+	return r, delays
+}
+
+func TestRetrier_ExponentialBackoff(t *testing.T) {
+	o := &flakyOutput{err: fmt.Errorf("connection refused"), failures: 4}
+	r, delays := newTestRetrier(o, RetryConfig{MaxAttempts: 5, InitialInterval: 100, MaxInterval: 300}, BreakerConfig{})
+
+	attempts, err := r.Send(context.Background(), types.EventData{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, attempts)
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 300 * ms, 300 * ms}, *delays)
+}
+
+func TestRetrier_GivesUpAfterMaxAttempts(t *testing.T) {
+	o := &flakyOutput{err: fmt.Errorf("connection refused"), failures: -1}
+	r, _ := newTestRetrier(o, RetryConfig{}, BreakerConfig{})
+
+	attempts, err := r.Send(context.Background(), types.EventData{})
+	assert.Error(t, err)
+	assert.Equal(t, defaultMaxAttempts, attempts)
+	assert.Equal(t, defaultMaxAttempts, o.sends)
+}
+
+func TestRetrier_Jitter(t *testing.T) {
+	o := &flakyOutput{err: fmt.Errorf("connection refused"), failures: 20}
+	r, delays := newTestRetrier(o, RetryConfig{MaxAttempts: 21, InitialInterval: 1000, MaxInterval: 1000, Jitter: 0.5}, BreakerConfig{})
+
+	_, err := r.Send(context.Background(), types.EventData{})
+	assert.NoError(t, err)
+	for _, d := range *delays {
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+}
+
+func TestRetrier_UntilContextDone(t *testing.T) {
+	o := &flakyOutput{err: fmt.Errorf("connection refused"), failures: -1}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRetrier(o, RetryConfig{MaxAttempts: -1}, BreakerConfig{})
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		if o.sends == 50 {
+			cancel()
+		}
+		return ctx.Err()
+	}
+
+	attempts, err := r.Send(ctx, types.EventData{})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 50, attempts)
+}
+
+func TestRetrier_PermanentErrorIsNotRetried(t *testing.T) {
+	o := &flakyOutput{err: Permanent(fmt.Errorf("message rejected")), failures: -1}
+	r, delays := newTestRetrier(o, RetryConfig{}, BreakerConfig{})
+
+	attempts, err := r.Send(context.Background(), types.EventData{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, *delays)
+}
+
+func TestIsPermanent(t *testing.T) {
+	_, marshalErr := json.Marshal(map[string]any{"ch": make(chan int)})
+	assert.True(t, IsPermanent(&StdoutOutput{}, marshalErr))
+	assert.False(t, IsPermanent(&StdoutOutput{}, fmt.Errorf("connection refused")))
+	assert.False(t, IsPermanent(&StdoutOutput{}, context.Canceled))
+
+	k := &KafkaOutput{}
+	assert.True(t, k.IsPermanent(fmt.Errorf("write: %w", kafka.MessageSizeTooLarge)))
+	assert.False(t, k.IsPermanent(kafka.LeaderNotAvailable))
+	assert.True(t, k.IsPermanent(kafka.WriteErrors{kafka.InvalidTopic}))
+	assert.False(t, k.IsPermanent(kafka.WriteErrors{kafka.InvalidTopic, kafka.NotEnoughReplicas}))
+
+	// A fan-out failure is permanent only when every failed child failed permanently
+	rejected := &flakyOutput{err: Permanent(fmt.Errorf("message rejected")), failures: -1}
+	down := &flakyOutput{err: fmt.Errorf("connection refused"), failures: -1}
+	m, err := newMultiOutput(newMultiChildren(rejected, &recordOutput{}), MultiPolicyAll, 0)
+	assert.NoError(t, err)
+	assert.True(t, IsPermanent(m, m.Send(context.Background(), types.EventData{})))
+	m, err = newMultiOutput(newMultiChildren(rejected, down), MultiPolicyAll, 0)
+	assert.NoError(t, err)
+	assert.False(t, IsPermanent(m, m.Send(context.Background(), types.EventData{})))
+}
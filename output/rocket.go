@@ -91,6 +91,23 @@ func (r *RocketMQOutput) Send(ctx context.Context, event types.EventData) error
 	return err
 }
 
+// SendBatch Serializes the events and sends them to RocketMQ as one batch message
+func (r *RocketMQOutput) SendBatch(ctx context.Context, events []types.EventData) error {
+	msgs := make([]*primitive.Message, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &primitive.Message{
+			Topic: r.cfg.Topic,
+			Body:  data,
+		})
+	}
+	_, err := r.producer.SendSync(ctx, msgs...)
+	return err
+}
+
 // Close Closes the RocketMQ producer
 func (r *RocketMQOutput) Close() error {
 	return r.producer.Shutdown()
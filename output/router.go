@@ -0,0 +1,153 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chihqiang/dbxgo/filter"
+	"github.com/chihqiang/dbxgo/types"
+)
+
+// RouterConfig Routes events to named outputs
+type RouterConfig struct {
+	// Outputs Named output instances, each created through the output registry
+	Outputs map[string]Config `yaml:"outputs" json:"outputs" mapstructure:"outputs"`
+	// Routes Routing rules, checked in order; the first matching rule wins
+	Routes []RouteConfig `yaml:"routes" json:"routes" mapstructure:"routes"`
+	// Default Output of the events that match no rule, empty drops them
+	Default string `yaml:"default" json:"default" mapstructure:"default" env:"OUTPUT_ROUTER_DEFAULT"`
+}
+
+// RouteConfig Maps events matching database/table regexes and event types to a named output
+type RouteConfig struct {
+	filter.Config `yaml:",inline" mapstructure:",squash"`
+	// Output Name of the output in RouterConfig.Outputs
+	Output string `yaml:"output" json:"output" mapstructure:"output"`
+}
+
+// route A compiled routing rule
+type route struct {
+	filter *filter.Filter
+	name   string
+}
+
+// RouteError Failure of the named output an event was routed to
+type RouteError struct {
+	// Output Name of the output in RouterConfig.Outputs
+	Output string
+	Err    error
+}
+
+// Error Names the failing output
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("output %s: %v", e.Output, e.Err)
+}
+
+// Unwrap Returns the error of the output
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// RouterOutput Sends every event to the output of the first matching route
+type RouterOutput struct {
+	routes  []route
+	outputs map[string]IOutput
+	// fallback Name of the output of unmatched events, empty drops them
+	fallback string
+}
+
+// NewRouterOutput Creates the named outputs and compiles the routing rules
+// cfg: Router configuration
+// Returns: Router output and an error when a rule is invalid or an output cannot be created
+func NewRouterOutput(cfg RouterConfig) (*RouterOutput, error) {
+	outputs := make(map[string]IOutput, len(cfg.Outputs))
+	for name, oc := range cfg.Outputs {
+		if oc.Type == OutputTypeRouter {
+			closeOutputs(outputs)
+			return nil, fmt.Errorf("output %s: routers cannot be nested", name)
+		}
+		o, err := NewOutput(oc)
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, fmt.Errorf("failed to create output %s: %w", name, err)
+		}
+		outputs[name] = o
+	}
+	r, err := newRouterOutput(cfg.Routes, outputs, cfg.Default)
+	if err != nil {
+		closeOutputs(outputs)
+		return nil, err
+	}
+	return r, nil
+}
+
+// newRouterOutput Compiles the routing rules against already created outputs
+func newRouterOutput(routes []RouteConfig, outputs map[string]IOutput, fallback string) (*RouterOutput, error) {
+	r := &RouterOutput{outputs: outputs}
+	for i, rc := range routes {
+		if _, ok := outputs[rc.Output]; !ok {
+			return nil, fmt.Errorf("routes[%d] refers to unknown output %q", i, rc.Output)
+		}
+		f, err := filter.New(rc.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid routes[%d]: %w", i, err)
+		}
+		r.routes = append(r.routes, route{filter: f, name: rc.Output})
+	}
+	if fallback != "" {
+		if _, ok := outputs[fallback]; !ok {
+			return nil, fmt.Errorf("default refers to unknown output %q", fallback)
+		}
+		r.fallback = fallback
+	}
+	return r, nil
+}
+
+// Send Sends the event to the output of the first matching route, or to the default output
+// The returned error is a *RouteError naming the output that failed
+func (r *RouterOutput) Send(ctx context.Context, event types.EventData) error {
+	name := r.fallback
+	for _, rt := range r.routes {
+		if rt.filter.Match(event) {
+			name = rt.name
+			break
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	if err := r.outputs[name].Send(ctx, event); err != nil {
+		return &RouteError{Output: name, Err: err}
+	}
+	return nil
+}
+
+// IsPermanent Reports whether the output that produced the error classifies it as permanent
+func (r *RouterOutput) IsPermanent(err error) bool {
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) {
+		return isPermanentDefault(err)
+	}
+	o, ok := r.outputs[routeErr.Output]
+	if !ok {
+		return isPermanentDefault(err)
+	}
+	return IsPermanent(o, routeErr.Err)
+}
+
+// Close Closes every named output
+func (r *RouterOutput) Close() error {
+	return closeOutputs(r.outputs)
+}
+
+// closeOutputs Closes outputs and returns the first error
+func closeOutputs(outputs map[string]IOutput) error {
+	var firstErr error
+	for name, o := range outputs {
+		if err := o.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close output %s: %w", name, err)
+		}
+	}
+	return firstErr
+}
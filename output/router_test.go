@@ -0,0 +1,139 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/filter"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordOutput Records the tables of the events it receives
+type recordOutput struct {
+	tables []string
+	closed bool
+}
+
+func (o *recordOutput) Send(ctx context.Context, event types.EventData) error {
+	o.tables = append(o.tables, event.Row.Table)
+	return nil
+}
+
+func (o *recordOutput) Close() error {
+	o.closed = true
+	return nil
+}
+
+func routeEvent(table string, rowType types.EventRowType) types.EventData {
+	return types.EventData{Row: types.EventRowData{Database: "shop", Table: table, Type: rowType}}
+}
+
+func TestRouterOutput_Send(t *testing.T) {
+	kafka, redis, audit := &recordOutput{}, &recordOutput{}, &recordOutput{}
+	r, err := newRouterOutput([]RouteConfig{
+		{Config: filter.Config{IncludeTableRegex: []string{"shop\\.orders"}}, Output: "kafka"},
+		{Config: filter.Config{IncludeTableRegex: []string{"shop\\.sessions"}, Types: []types.EventRowType{types.InsertEventRowType}}, Output: "redis"},
+	}, map[string]IOutput{"kafka": kafka, "redis": redis, "audit": audit}, "audit")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, r.Send(ctx, routeEvent("orders", types.UpdateEventRowType)))
+	assert.NoError(t, r.Send(ctx, routeEvent("sessions", types.InsertEventRowType)))
+	assert.NoError(t, r.Send(ctx, routeEvent("sessions", types.DeleteEventRowType)))
+	assert.NoError(t, r.Send(ctx, routeEvent("audit_log", types.InsertEventRowType)))
+
+	assert.Equal(t, []string{"orders"}, kafka.tables)
+	assert.Equal(t, []string{"sessions"}, redis.tables)
+	assert.Equal(t, []string{"sessions", "audit_log"}, audit.tables)
+
+	assert.NoError(t, r.Close())
+	assert.True(t, kafka.closed && redis.closed && audit.closed)
+}
+
+func TestRouterOutput_NoDefaultDrops(t *testing.T) {
+	kafka := &recordOutput{}
+	r, err := newRouterOutput([]RouteConfig{
+		{Config: filter.Config{IncludeTableRegex: []string{"shop\\.orders"}}, Output: "kafka"},
+	}, map[string]IOutput{"kafka": kafka}, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Send(context.Background(), routeEvent("users", types.InsertEventRowType)))
+	assert.Empty(t, kafka.tables)
+}
+
+func TestRouterOutput_UnknownOutput(t *testing.T) {
+	outputs := map[string]IOutput{"kafka": &recordOutput{}}
+	_, err := newRouterOutput([]RouteConfig{{Output: "redis"}}, outputs, "")
+	assert.ErrorContains(t, err, fmt.Sprintf("unknown output %q", "redis"))
+
+	_, err = newRouterOutput(nil, outputs, "audit")
+	assert.ErrorContains(t, err, "default refers to unknown output")
+}
+
+func TestNewRouterOutput_FromRegistry(t *testing.T) {
+	o, err := NewOutput(Config{Type: OutputTypeRouter, Router: RouterConfig{
+		Outputs: map[string]Config{"console": {Type: OutputTypeStdout}},
+		Default: "console",
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, o.Close())
+
+	_, err = NewRouterOutput(RouterConfig{Outputs: map[string]Config{"nested": {Type: OutputTypeRouter}}})
+	assert.Error(t, err)
+}
+
+// classifyOutput Fails every send with err and treats the errors it lists as permanent
+type classifyOutput struct {
+	recordOutput
+	err       error
+	permanent []error
+}
+
+func (o *classifyOutput) Send(ctx context.Context, event types.EventData) error {
+	return o.err
+}
+
+func (o *classifyOutput) IsPermanent(err error) bool {
+	for _, p := range o.permanent {
+		if errors.Is(err, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRouterOutput_IsPermanent(t *testing.T) {
+	tooLarge := fmt.Errorf("message too large")
+	unavailable := fmt.Errorf("broker unavailable")
+	tests := []struct {
+		name  string
+		table string
+		want  bool
+	}{
+		{name: "permanent for the output that failed", table: "orders", want: true},
+		{name: "permanent only for another output", table: "sessions", want: false},
+		{name: "default output", table: "audit_log", want: false},
+	}
+	kafka := &classifyOutput{err: tooLarge, permanent: []error{tooLarge}}
+	redis := &classifyOutput{err: tooLarge}
+	audit := &classifyOutput{err: unavailable, permanent: []error{tooLarge}}
+	r, err := newRouterOutput([]RouteConfig{
+		{Config: filter.Config{IncludeTableRegex: []string{"shop\\.orders"}}, Output: "kafka"},
+		{Config: filter.Config{IncludeTableRegex: []string{"shop\\.sessions"}}, Output: "redis"},
+	}, map[string]IOutput{"kafka": kafka, "redis": redis, "audit": audit}, "audit")
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Send(context.Background(), routeEvent(tt.table, types.InsertEventRowType))
+			var routeErr *RouteError
+			assert.ErrorAs(t, err, &routeErr)
+			assert.Equal(t, tt.want, IsPermanent(r, err))
+		})
+	}
+	assert.True(t, IsPermanent(r, Permanent(unavailable)))
+	assert.False(t, IsPermanent(r, unavailable))
+}
@@ -0,0 +1,547 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/dbxgo/pkg/structx"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// errReplayStopped Returned from the parser callback when a stop bound is reached
+var errReplayStopped = errors.New("binlog replay reached its stop bound")
+
+// BinlogFileConfig Offline binlog file replay configuration
+// Filtering, value conversion, column metadata, transaction markers and buffering are
+// taken from the mysql section, so a replay emits the same events as the live source.
+type BinlogFileConfig struct {
+	// Files Binlog files replayed in order, glob patterns are expanded and sorted
+	Files []string `yaml:"files" json:"files" mapstructure:"files" env:"SOURCE_BINLOGFILE_FILES"`
+	// SchemaFile SQL file with the CREATE TABLE statements of the replayed tables, e.g. mysqldump --no-data
+	// When empty, table definitions are read from the server of the mysql section
+	SchemaFile string `yaml:"schema_file" json:"schema_file" mapstructure:"schema_file" env:"SOURCE_BINLOGFILE_SCHEMA_FILE"`
+	// StartPosition Offset in the first file to start from, it must be the start of an event
+	StartPosition uint32 `yaml:"start_position" json:"start_position" mapstructure:"start_position" env:"SOURCE_BINLOGFILE_START_POSITION" envDefault:"0"`
+	// StopPosition Offset in the last file at which the replay stops, 0 reads to the end
+	StopPosition uint32 `yaml:"stop_position" json:"stop_position" mapstructure:"stop_position" env:"SOURCE_BINLOGFILE_STOP_POSITION" envDefault:"0"`
+	// StartTime Events written before this time are skipped, RFC3339 or "2006-01-02 15:04:05" (UTC)
+	StartTime string `yaml:"start_time" json:"start_time" mapstructure:"start_time" env:"SOURCE_BINLOGFILE_START_TIME"`
+	// StopTime The replay stops at the first event written at or after this time
+	StopTime string `yaml:"stop_time" json:"stop_time" mapstructure:"stop_time" env:"SOURCE_BINLOGFILE_STOP_TIME"`
+}
+
+// BinlogFileSource Replays local binlog files without a running replication stream
+// Run returns nil once the files are exhausted or a stop bound is reached, after closing the event channel
+type BinlogFileSource struct {
+	// mu Mutex used to ensure concurrency safety
+	mu sync.Mutex
+	// store Storage interface for persisting or reading offsets
+	store store.IStore
+	// cfg Replay configuration
+	cfg BinlogFileConfig
+	// mysql Settings shared with the MySQL source
+	mysql MysqlConfig
+	// files Expanded file list
+	files []string
+	// start Events before this time are skipped, zero when unset
+	start time.Time
+	// stop Replay stops at this time, zero when unset
+	stop time.Time
+	// registry Table definitions from the schema file, the server and replayed DDL
+	registry *schemaRegistry
+	// conn Connection the table definitions are read from, nil when a schema file is used
+	conn *client.Conn
+	// missing Tables without a definition, reported once
+	missing map[string]bool
+	// filter Include/exclude table filter
+	filter *tableFilter
+	// converter Converts raw column values into their event representation
+	converter *valueConverter
+	// eventDataChan Event data output channel
+	eventDataChan chan types.EventData
+	// emitter Delivers events into eventDataChan according to the overflow policy
+	emitter *emitter
+	// checkpoint Tracks delivered events and persists the lowest fully acknowledged position
+	checkpoint *Checkpointer[MysqlPosition]
+	// tx Binlog transaction the current events belong to
+	tx transaction
+	// file Base name of the file being replayed
+	file string
+	// synced Position after the last replayed commit
+	synced mysql.Position
+	// running Indicates whether the datasource is running
+	running bool
+	// cancel Stops a running replay
+	cancel context.CancelFunc
+	// done Closed when Run returns
+	done chan struct{}
+	// finish Closes the event channel exactly once
+	finish sync.Once
+}
+
+// NewBinlogFileSource Creates a binlog file replay source
+// cfg: Replay configuration
+// mysqlCfg: MySQL source configuration, provides filters, conversion and buffering settings
+// Returns: BinlogFileSource instance and possible errors
+func NewBinlogFileSource(cfg BinlogFileConfig, mysqlCfg MysqlConfig) (*BinlogFileSource, error) {
+	var err error
+	mysqlCfg, err = structx.MergeWithDefaults[MysqlConfig](mysqlCfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(mysqlCfg.ExcludeTableRegex) == 0 {
+		mysqlCfg.ExcludeTableRegex = DefaultMysqlExcludeTableRegex
+	}
+	files, err := expandBinlogFiles(cfg.Files)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeOption(cfg.StartTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_time: %w", err)
+	}
+	stop, err := parseTimeOption(cfg.StopTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stop_time: %w", err)
+	}
+	registry := newSchemaRegistry()
+	if cfg.SchemaFile != "" {
+		if registry, err = loadSchemaFile(cfg.SchemaFile); err != nil {
+			return nil, err
+		}
+	}
+	filter, err := newTableFilter(mysqlCfg.IncludeTableRegex, mysqlCfg.ExcludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	converter, err := newValueConverter(mysqlCfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &BinlogFileSource{
+		cfg:       cfg,
+		mysql:     mysqlCfg,
+		files:     files,
+		start:     start,
+		stop:      stop,
+		registry:  registry,
+		missing:   make(map[string]bool),
+		filter:    filter,
+		converter: converter,
+		done:      make(chan struct{}),
+	}
+	s.checkpoint = NewCheckpointer[MysqlPosition](s.savePosition)
+	s.emitter, err = newEmitter(mysqlCfg.BufferSize, mysqlCfg.OverflowPolicy, mysqlCfg.SpillDir, func(event types.EventData) {
+		// A discarded event is never delivered, acknowledge it so the checkpoint is not held back
+		_ = s.checkpoint.Ack(event.Token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.eventDataChan = s.emitter.ch
+	return s, nil
+}
+
+// expandBinlogFiles Expands glob patterns, files of each pattern are sorted by name
+// patterns: File names or glob patterns
+// Returns: File list and an error when nothing matches
+func expandBinlogFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid binlog file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no binlog file matches %q", pattern)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no binlog files configured")
+	}
+	return files, nil
+}
+
+// WithStore Sets the store for the replay source
+func (s *BinlogFileSource) WithStore(store store.IStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+// Run Replays the binlog files
+// ctx: Context to control cancellation
+// Returns: nil once every event up to the end or stop bound has been emitted, otherwise the error
+func (s *BinlogFileSource) Run(ctx context.Context) error {
+	if s.store == nil {
+		return fmt.Errorf("store is not initialized, cannot run BinlogFileSource")
+	}
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("it is already running")
+	}
+	s.running = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+	defer close(s.done)
+
+	if s.cfg.SchemaFile == "" {
+		conn, err := client.Connect(s.mysql.Addr, s.mysql.User, s.mysql.Password, "")
+		if err != nil {
+			return fmt.Errorf("connect schema server error: %w", err)
+		}
+		defer conn.Close()
+		s.conn = conn
+	}
+	index, offset, err := s.startPosition()
+	if err != nil {
+		return err
+	}
+	parser := replication.NewBinlogParser()
+	parser.SetFlavor(s.mysql.Flavor)
+	// TIMESTAMP values are decoded in UTC and rendered in the configured zone by the converter
+	parser.SetTimestampStringLocation(time.UTC)
+	for ; index < len(s.files); index++ {
+		s.file = filepath.Base(s.files[index])
+		logx.Info("binlog file source replaying %s from %d", s.files[index], offset)
+		err := parser.ParseFile(s.files[index], offset, func(e *replication.BinlogEvent) error {
+			return s.handleEvent(ctx, index == len(s.files)-1, e)
+		})
+		offset = 0
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errReplayStopped) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("replay %s error: %w", s.files[index], err)
+		}
+	}
+	if err := s.emitter.flush(ctx); err != nil {
+		return err
+	}
+	logx.Info("binlog file source finished at %s:%d", s.synced.Name, s.synced.Pos)
+	s.closeChannel()
+	return nil
+}
+
+// GetChanEventData Returns event channel for external reading
+// The channel is closed once the replay is complete
+func (s *BinlogFileSource) GetChanEventData() <-chan types.EventData {
+	return s.eventDataChan
+}
+
+// Ack Acknowledges a delivered event so that its position can be checkpointed
+// event: Event that has been sent downstream
+// Returns: Possible errors while saving the position
+func (s *BinlogFileSource) Ack(event types.EventData) error {
+	return s.checkpoint.Ack(event.Token)
+}
+
+// Close Stops the replay and releases resources
+// The emitter is released even if Run was never called or has already returned
+// Returns: Possible errors
+func (s *BinlogFileSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Only a running source has a replay to stop
+	if s.running {
+		s.cancel()
+		<-s.done
+	}
+	s.closeChannel()
+	s.running = false
+	return nil
+}
+
+// closeChannel Stops the spill queue and closes the event channel, only the first call has an effect
+func (s *BinlogFileSource) closeChannel() {
+	s.finish.Do(func() {
+		if err := s.emitter.close(); err != nil {
+			logx.Warn("failed to remove spill queue: %v", err)
+		}
+		if dropped := s.emitter.Dropped(); dropped > 0 {
+			logx.Warn("binlog file source discarded %d events because the event channel was full", dropped)
+		}
+		close(s.eventDataChan)
+	})
+}
+
+// startPosition Picks the file and offset the replay starts from
+// A saved replay position inside one of the files takes precedence over start_position,
+// the position of a live MySQL source sharing the store is never used
+// Returns: File index, offset and possible errors
+func (s *BinlogFileSource) startPosition() (int, int64, error) {
+	positionBytes, err := s.store.Get(StoreKeyBinlogFilePosition)
+	if err == nil && len(positionBytes) > 0 {
+		var pos MysqlPosition
+		if err := json.Unmarshal(positionBytes, &pos); err != nil {
+			return 0, 0, fmt.Errorf("unmarshal position error: %w", err)
+		}
+		for i, file := range s.files {
+			if filepath.Base(file) == pos.File && pos.Pos > 0 {
+				logx.Info("binlog file source resuming from %s:%d", pos.File, pos.Pos)
+				s.synced = mysql.Position{Name: pos.File, Pos: pos.Pos}
+				return i, int64(pos.Pos), nil
+			}
+		}
+	}
+	offset := s.cfg.StartPosition
+	// The first event follows the 4 byte file header
+	if offset < uint32(len(replication.BinLogFileHeader)) {
+		offset = uint32(len(replication.BinLogFileHeader))
+	}
+	s.synced = mysql.Position{Name: filepath.Base(s.files[0]), Pos: offset}
+	return 0, int64(offset), nil
+}
+
+// handleEvent Handles a single binlog event
+// ctx: Cancels a blocked send
+// last: Whether the event is read from the last file, where stop_position applies
+// e: Binlog event
+// Returns: errReplayStopped at a stop bound, or possible errors
+func (s *BinlogFileSource) handleEvent(ctx context.Context, last bool, e *replication.BinlogEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	h := e.Header
+	// Artificial events (e.g. the format description read when seeking) carry no timestamp
+	if h.Timestamp > 0 {
+		if last && s.cfg.StopPosition > 0 && h.LogPos-h.EventSize >= s.cfg.StopPosition {
+			return errReplayStopped
+		}
+		if !s.stop.IsZero() && int64(h.Timestamp) >= s.stop.Unix() {
+			return errReplayStopped
+		}
+	}
+	skip := !s.start.IsZero() && int64(h.Timestamp) < s.start.Unix()
+	switch ev := e.Event.(type) {
+	case *replication.GTIDEvent:
+		return s.onGTID(ev)
+	case *replication.MariadbGTIDEvent:
+		return s.onGTID(ev)
+	case *replication.RowsEvent:
+		return s.handleRows(ctx, h, ev, skip)
+	case *replication.TransactionPayloadEvent:
+		// Compressed transactions carry their events inside the payload
+		for _, sub := range ev.Events {
+			if err := s.handleEvent(ctx, last, sub); err != nil {
+				return err
+			}
+		}
+	case *replication.XIDEvent:
+		return s.commit(ctx, h)
+	case *replication.QueryEvent:
+		return s.handleQuery(ctx, h, ev, skip)
+	}
+	return nil
+}
+
+// onGTID Remembers the GTID of the transaction that follows
+func (s *BinlogFileSource) onGTID(gtidEvent mysql.BinlogGTIDEvent) error {
+	set, err := gtidEvent.GTIDNext()
+	if err != nil {
+		return fmt.Errorf("read gtid error: %w", err)
+	}
+	s.tx.gtid = set.String()
+	return nil
+}
+
+// handleRows Emits one event per changed row, the same way MySQLSource.OnRow does
+func (s *BinlogFileSource) handleRows(ctx context.Context, h *replication.EventHeader, ev *replication.RowsEvent, skip bool) error {
+	database, name := string(ev.Table.Schema), string(ev.Table.Table)
+	if skip || !s.filter.Match(database, name) {
+		return nil
+	}
+	var action string
+	switch h.EventType {
+	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2, replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		action = canal.InsertAction
+	case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2, replication.MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		action = canal.DeleteAction
+	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2, replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		action = canal.UpdateAction
+	default:
+		return nil
+	}
+	table, nullable, err := s.table(database, name)
+	if err != nil || table == nil {
+		return err
+	}
+	if err := s.beginTransaction(ctx, h); err != nil {
+		return err
+	}
+	rowsEvent := &canal.RowsEvent{Table: table, Action: action, Rows: ev.Rows, Header: h}
+	for i := 0; i < len(rowsEvent.Rows); i++ {
+		event := s.newEvent(h, database, name)
+		event.TxSeq = s.tx.next()
+		i = fillRow(&event, rowsEvent, i, s.converter)
+		fillPrimaryKey(&event, table)
+		if s.mysql.ColumnMetadata {
+			event.Row.Columns = describeColumns(table, nullable)
+		}
+		if err := s.emitter.emit(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleQuery Handles statements logged as queries
+// COMMIT ends transactions of non-transactional tables, table DDL updates the schema and is emitted
+func (s *BinlogFileSource) handleQuery(ctx context.Context, h *replication.EventHeader, ev *replication.QueryEvent, skip bool) error {
+	query := string(ev.Query)
+	if strings.EqualFold(strings.TrimSpace(query), "COMMIT") {
+		return s.commit(ctx, h)
+	}
+	if !isTableDDL(query) {
+		return nil
+	}
+	changed, err := s.registry.apply(query, string(ev.Schema))
+	if err != nil {
+		// Like canal, statements the parser does not understand are skipped
+		logx.Warn("failed to parse query, skipping: %s, error: %v", query, err)
+		return nil
+	}
+	if !skip {
+		// A DDL statement commits on its own, it is never wrapped in transaction markers
+		s.tx.begin(s.synced)
+		for _, ref := range changed {
+			if !s.filter.Match(ref.database, ref.table) {
+				continue
+			}
+			event := s.newEvent(h, ref.database, ref.table)
+			event.TxSeq = s.tx.next()
+			event.Row.Type = types.DDLEventRowType
+			event.Row.SQL = query
+			// A dropped table has no definition left and is emitted without columns
+			if table, nullable, err := s.table(ref.database, ref.table); err == nil && table != nil {
+				event.Row.PrimaryKey = primaryKeyColumns(table)
+				event.Row.Columns = describeColumns(table, nullable)
+			}
+			if err := s.emitter.emit(ctx, event); err != nil {
+				return err
+			}
+		}
+		s.tx.end()
+	}
+	return s.mark(h)
+}
+
+// commit Closes the transaction, emits the commit marker when enabled and records the position
+func (s *BinlogFileSource) commit(ctx context.Context, h *replication.EventHeader) error {
+	id, gtid := s.tx.id, s.tx.gtid
+	open, count := s.tx.end()
+	if open && s.mysql.TransactionMarkers {
+		event := s.newEvent(h, "", "")
+		event.GTID = gtid
+		event.TxID = id
+		event.Row.Type = types.CommitEventRowType
+		event.Row.Data = map[string]any{"events": count}
+		if err := s.emitter.emit(ctx, event); err != nil {
+			return err
+		}
+	}
+	return s.mark(h)
+}
+
+// beginTransaction Opens the transaction for an event about to be emitted
+// A begin marker is emitted first when transaction markers are enabled
+func (s *BinlogFileSource) beginTransaction(ctx context.Context, h *replication.EventHeader) error {
+	if !s.tx.begin(s.synced) || !s.mysql.TransactionMarkers {
+		return nil
+	}
+	event := s.newEvent(h, "", "")
+	event.Row.Type = types.BeginEventRowType
+	return s.emitter.emit(ctx, event)
+}
+
+// mark Hands the position after an event to the checkpointer
+func (s *BinlogFileSource) mark(h *replication.EventHeader) error {
+	s.synced = mysql.Position{Name: s.file, Pos: h.LogPos}
+	return s.checkpoint.Mark(MysqlPosition{File: s.file, Pos: h.LogPos})
+}
+
+// newEvent Creates an event with the binlog header and transaction information filled in
+func (s *BinlogFileSource) newEvent(h *replication.EventHeader, database, table string) types.EventData {
+	var event types.EventData
+	event.Time = time.Now()
+	event.Pos = int64(h.LogPos)
+	event.ServerID = int64(h.ServerID)
+	event.File = s.file
+	event.GTID = s.tx.gtid
+	event.TxID = s.tx.id
+	event.Token = s.checkpoint.Track()
+	event.Row.Time = int64(h.Timestamp)
+	event.Row.Database = database
+	event.Row.Table = table
+	return event
+}
+
+// table Returns the definition of a table, reading it from the server when no schema file is used
+// Returns: Table and column nullability, nil when the table is unknown, and possible errors
+func (s *BinlogFileSource) table(database, name string) (*schema.Table, map[string]bool, error) {
+	if table, nullable, ok := s.registry.table(database, name); ok {
+		return table, nullable, nil
+	}
+	key := database + "." + name
+	if s.conn == nil {
+		if !s.missing[key] {
+			s.missing[key] = true
+			logx.Warn("table %s is not defined in the schema file, its rows are skipped", key)
+		}
+		return nil, nil, nil
+	}
+	table, err := schema.NewTable(s.conn, database, name)
+	if err != nil {
+		if errors.Is(err, schema.ErrTableNotExist) {
+			if !s.missing[key] {
+				s.missing[key] = true
+				logx.Warn("table %s does not exist on the schema server, its rows are skipped", key)
+			}
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("read table %s error: %w", key, err)
+	}
+	nullable := make(map[string]bool, len(table.Columns))
+	rr, err := s.conn.Execute("SELECT COLUMN_NAME, IS_NULLABLE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", database, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read column nullability of %s error: %w", key, err)
+	}
+	for i := 0; i < rr.RowNumber(); i++ {
+		column, _ := rr.GetString(i, 0)
+		isNullable, _ := rr.GetString(i, 1)
+		nullable[column] = isNullable == "YES"
+	}
+	s.registry.put(table, nullable)
+	return table, nullable, nil
+}
+
+// savePosition Saves the acknowledged replay position
+// pos: Position to save
+// Returns: Possible errors
+func (s *BinlogFileSource) savePosition(pos MysqlPosition) error {
+	positionBytes, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("marshal position error: %w", err)
+	}
+	return s.store.Set(StoreKeyBinlogFilePosition, positionBytes)
+}
@@ -0,0 +1,191 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBinlogFileSource(t *testing.T, cfg BinlogFileConfig) (*BinlogFileSource, store.IStore) {
+	dir := t.TempDir()
+	cfg.SchemaFile = filepath.Join(dir, "schema.sql")
+	assert.NoError(t, os.WriteFile(cfg.SchemaFile, []byte("CREATE TABLE shop.orders (id bigint unsigned PRIMARY KEY, status enum('new','paid') NOT NULL, total decimal(10,2));"), 0o644))
+	cfg.Files = []string{filepath.Join(dir, "mysql-bin.000001")}
+	assert.NoError(t, os.WriteFile(cfg.Files[0], replication.BinLogFileHeader, 0o644))
+	s, err := NewBinlogFileSource(cfg, MysqlConfig{BufferSize: 16})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = s.emitter.close() })
+	st, err := store.NewFileStore(store.FileConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	s.WithStore(st)
+	_, _, err = s.startPosition()
+	assert.NoError(t, err)
+	s.file = "mysql-bin.000001"
+	return s, st
+}
+
+func binlogEvent(eventType replication.EventType, timestamp, logPos uint32, event replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{Timestamp: timestamp, EventType: eventType, ServerID: 7, LogPos: logPos, EventSize: 40},
+		Event:  event,
+	}
+}
+
+func ordersRows(rows ...[]any) *replication.RowsEvent {
+	return &replication.RowsEvent{Table: &replication.TableMapEvent{Schema: []byte("shop"), Table: []byte("orders")}, Rows: rows}
+}
+
+func TestBinlogFileSource_ReplaysTransaction(t *testing.T) {
+	s, st := newTestBinlogFileSource(t, BinlogFileConfig{})
+	ctx := context.Background()
+	for _, e := range []*replication.BinlogEvent{
+		binlogEvent(replication.QUERY_EVENT, 1760497200, 200, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		binlogEvent(replication.WRITE_ROWS_EVENTv2, 1760497200, 300, ordersRows([]any{int64(-1), int64(1), "12.30"})),
+		binlogEvent(replication.UPDATE_ROWS_EVENTv2, 1760497200, 400, ordersRows([]any{int64(-1), int64(1), "12.30"}, []any{int64(-1), int64(2), "12.30"})),
+		binlogEvent(replication.XID_EVENT, 1760497200, 500, &replication.XIDEvent{XID: 9}),
+	} {
+		assert.NoError(t, s.handleEvent(ctx, true, e))
+	}
+	if !assert.Len(t, s.eventDataChan, 2) {
+		return
+	}
+	insert, update := <-s.eventDataChan, <-s.eventDataChan
+
+	assert.Equal(t, types.InsertEventRowType, insert.Row.Type)
+	assert.Equal(t, "shop", insert.Row.Database)
+	assert.Equal(t, "orders", insert.Row.Table)
+	assert.Equal(t, "mysql-bin.000001", insert.File)
+	assert.Equal(t, int64(300), insert.Pos)
+	assert.Equal(t, "mysql-bin.000001:4", insert.TxID)
+	assert.Equal(t, 1, insert.TxSeq)
+	assert.Equal(t, map[string]any{"id": uint64(18446744073709551615)}, insert.Row.Key)
+	assert.Equal(t, "new", insert.Row.Data["status"])
+	assert.Equal(t, "12.30", insert.Row.Data["total"])
+
+	assert.Equal(t, types.UpdateEventRowType, update.Row.Type)
+	assert.Equal(t, "new", update.Row.Old["status"])
+	assert.Equal(t, "paid", update.Row.Data["status"])
+	assert.Equal(t, 2, update.TxSeq)
+
+	assert.False(t, st.Has(StoreKeyBinlogFilePosition))
+	assert.NoError(t, s.Ack(update))
+	assert.NoError(t, s.Ack(insert))
+	raw, err := st.Get(StoreKeyBinlogFilePosition)
+	assert.NoError(t, err)
+	var pos MysqlPosition
+	assert.NoError(t, json.Unmarshal(raw, &pos))
+	assert.Equal(t, MysqlPosition{File: "mysql-bin.000001", Pos: 500}, pos)
+}
+
+func TestBinlogFileSource_TimeBounds(t *testing.T) {
+	s, _ := newTestBinlogFileSource(t, BinlogFileConfig{StartTime: "2025-10-15 03:00:00", StopTime: "2025-10-15T04:00:00Z"})
+	ctx := context.Background()
+	start := uint32(time.Date(2025, 10, 15, 3, 0, 0, 0, time.UTC).Unix())
+
+	assert.NoError(t, s.handleEvent(ctx, true, binlogEvent(replication.WRITE_ROWS_EVENTv2, start-1, 300, ordersRows([]any{int64(1), int64(1), nil}))))
+	assert.Len(t, s.eventDataChan, 0)
+	assert.NoError(t, s.handleEvent(ctx, true, binlogEvent(replication.WRITE_ROWS_EVENTv2, start, 400, ordersRows([]any{int64(2), int64(1), nil}))))
+	assert.Len(t, s.eventDataChan, 1)
+
+	err := s.handleEvent(ctx, true, binlogEvent(replication.WRITE_ROWS_EVENTv2, start+3600, 500, ordersRows([]any{int64(3), int64(1), nil})))
+	assert.ErrorIs(t, err, errReplayStopped)
+	assert.Len(t, s.eventDataChan, 1)
+}
+
+func TestBinlogFileSource_DDLUpdatesSchema(t *testing.T) {
+	s, _ := newTestBinlogFileSource(t, BinlogFileConfig{StopPosition: 1000})
+	ctx := context.Background()
+	assert.NoError(t, s.handleEvent(ctx, true, binlogEvent(replication.QUERY_EVENT, 1760497200, 300,
+		&replication.QueryEvent{Schema: []byte("shop"), Query: []byte("ALTER TABLE orders ADD COLUMN note varchar(16)")})))
+	if !assert.Len(t, s.eventDataChan, 1) {
+		return
+	}
+	ddl := <-s.eventDataChan
+	assert.Equal(t, types.DDLEventRowType, ddl.Row.Type)
+	assert.Equal(t, "ALTER TABLE orders ADD COLUMN note varchar(16)", ddl.Row.SQL)
+	assert.Len(t, ddl.Row.Columns, 4)
+
+	assert.NoError(t, s.handleEvent(ctx, true, binlogEvent(replication.WRITE_ROWS_EVENTv2, 1760497200, 400, ordersRows([]any{int64(1), int64(1), nil, "hi"}))))
+	insert := <-s.eventDataChan
+	assert.Equal(t, "hi", insert.Row.Data["note"])
+
+	// stop_position applies to the start of an event in the last file
+	err := s.handleEvent(ctx, true, binlogEvent(replication.WRITE_ROWS_EVENTv2, 1760497200, 1040, ordersRows([]any{int64(2), int64(1), nil, nil})))
+	assert.ErrorIs(t, err, errReplayStopped)
+	assert.NoError(t, s.handleEvent(ctx, false, binlogEvent(replication.WRITE_ROWS_EVENTv2, 1760497200, 1040, ordersRows([]any{int64(2), int64(1), nil, nil}))))
+}
+
+func TestBinlogFileSource_StartPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		stored     MysqlPosition
+		wantOffset int64
+	}{
+		{name: "nothing stored", wantOffset: 4},
+		{name: "saved replay position", key: StoreKeyBinlogFilePosition, stored: MysqlPosition{File: "mysql-bin.000001", Pos: 500}, wantOffset: 500},
+		{name: "replay position of another file", key: StoreKeyBinlogFilePosition, stored: MysqlPosition{File: "mysql-bin.000009", Pos: 500}, wantOffset: 4},
+		{name: "live source position is ignored", key: StoreKeyPosition, stored: MysqlPosition{File: "mysql-bin.000001", Pos: 500}, wantOffset: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, st := newTestBinlogFileSource(t, BinlogFileConfig{})
+			if tt.key != "" {
+				raw, err := json.Marshal(tt.stored)
+				assert.NoError(t, err)
+				assert.NoError(t, st.Set(tt.key, raw))
+			}
+			index, offset, err := s.startPosition()
+			assert.NoError(t, err)
+			assert.Equal(t, 0, index)
+			assert.Equal(t, tt.wantOffset, offset)
+		})
+	}
+}
+
+func TestBinlogFileSource_CloseReleasesEmitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+	}{
+		{name: "never run or run returned", running: false},
+		{name: "running", running: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := t.TempDir()
+			cfg := BinlogFileConfig{SchemaFile: filepath.Join(files, "schema.sql"), Files: []string{filepath.Join(files, "mysql-bin.000001")}}
+			assert.NoError(t, os.WriteFile(cfg.SchemaFile, []byte("CREATE TABLE shop.orders (id bigint PRIMARY KEY);"), 0o644))
+			assert.NoError(t, os.WriteFile(cfg.Files[0], replication.BinLogFileHeader, 0o644))
+			dir := t.TempDir()
+			s, err := NewBinlogFileSource(cfg, MysqlConfig{BufferSize: 1, OverflowPolicy: OverflowPolicySpill, SpillDir: dir})
+			assert.NoError(t, err)
+			if tt.running {
+				// Run has returned, its replay is done
+				s.running = true
+				s.cancel = func() {}
+				close(s.done)
+			}
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, s.emitter.emit(context.Background(), types.EventData{Token: uint64(i + 1)}))
+			}
+
+			assert.NoError(t, s.Close())
+			assert.NoError(t, s.Close())
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Empty(t, entries, "the spill file must be removed")
+			for range s.eventDataChan {
+			}
+			assert.False(t, s.running)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// errStopBound Returned from the canal handlers once a stop bound is reached
+var errStopBound = errors.New("stop bound reached")
+
+// stopBound Where a bounded MySQL source stops streaming
+// Bounds are checked between transactions, a transaction is never cut in half.
+type stopBound struct {
+	// position Stop before the first transaction starting at or after it, nil when unset
+	position *mysql.Position
+	// gtid Stop once this GTID set has been executed, nil when unset
+	gtid mysql.GTIDSet
+	// time Stop before the first transaction written at or after it, zero when unset
+	time time.Time
+}
+
+// parseStopBound Parses the stop options of a MySQL source
+// cfg: MySQL datasource configuration
+// Returns: Stop bound and possible errors
+func parseStopBound(cfg MysqlConfig) (stopBound, error) {
+	var b stopBound
+	if cfg.StopPosition != "" {
+		pos, err := parsePosition(cfg.StopPosition)
+		if err != nil {
+			return b, fmt.Errorf("invalid stop_position: %w", err)
+		}
+		b.position = &pos
+	}
+	if cfg.StopGTID != "" {
+		set, err := mysql.ParseGTIDSet(cfg.Flavor, cfg.StopGTID)
+		if err != nil {
+			return b, fmt.Errorf("invalid stop_gtid: %w", err)
+		}
+		b.gtid = set
+	}
+	var err error
+	if b.time, err = parseTimeOption(cfg.StopTime); err != nil {
+		return b, fmt.Errorf("invalid stop_time: %w", err)
+	}
+	return b, nil
+}
+
+// parsePosition Parses a "file:pos" binlog position
+func parsePosition(value string) (mysql.Position, error) {
+	i := strings.LastIndexByte(value, ':')
+	if i <= 0 {
+		return mysql.Position{}, fmt.Errorf("%q is not file:pos", value)
+	}
+	pos, err := strconv.ParseUint(value[i+1:], 10, 32)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("%q is not file:pos: %w", value, err)
+	}
+	return mysql.Position{Name: value[:i], Pos: uint32(pos)}, nil
+}
+
+// enabled Reports whether any bound is configured
+func (b stopBound) enabled() bool {
+	return b.position != nil || b.gtid != nil || !b.time.IsZero()
+}
+
+// reached Reports whether a transaction starting at a position and time lies beyond the bound
+// start: Position the transaction starts at
+// timestamp: Timestamp of its first event, 0 when unknown
+func (b stopBound) reached(start mysql.Position, timestamp uint32) bool {
+	if b.position != nil && start.Name != "" && start.Compare(*b.position) >= 0 {
+		return true
+	}
+	return !b.time.IsZero() && timestamp > 0 && int64(timestamp) >= b.time.Unix()
+}
+
+// executed Reports whether the GTID bound is contained in an executed GTID set
+func (b stopBound) executed(set mysql.GTIDSet) bool {
+	return b.gtid != nil && set != nil && set.Contain(b.gtid)
+}
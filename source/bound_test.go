@@ -0,0 +1,52 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStopBound(t *testing.T) {
+	b, err := parseStopBound(MysqlConfig{})
+	assert.NoError(t, err)
+	assert.False(t, b.enabled())
+
+	b, err = parseStopBound(MysqlConfig{Flavor: "mysql", StopPosition: "mysql-bin.000003:1234", StopGTID: "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5", StopTime: "2026-10-15 04:00:00"})
+	assert.NoError(t, err)
+	assert.True(t, b.enabled())
+	assert.Equal(t, &mysql.Position{Name: "mysql-bin.000003", Pos: 1234}, b.position)
+	assert.Equal(t, time.Date(2026, 10, 15, 4, 0, 0, 0, time.UTC), b.time)
+
+	_, err = parseStopBound(MysqlConfig{StopPosition: "1234"})
+	assert.Error(t, err)
+	_, err = parseStopBound(MysqlConfig{Flavor: "mysql", StopGTID: "not-a-gtid"})
+	assert.Error(t, err)
+}
+
+func TestStopBound_Reached(t *testing.T) {
+	b, err := parseStopBound(MysqlConfig{StopPosition: "mysql-bin.000003:1234", StopTime: "2026-10-15T04:00:00Z"})
+	assert.NoError(t, err)
+	before := uint32(time.Date(2026, 10, 15, 3, 59, 59, 0, time.UTC).Unix())
+
+	assert.False(t, b.reached(mysql.Position{Name: "mysql-bin.000003", Pos: 1000}, before))
+	assert.True(t, b.reached(mysql.Position{Name: "mysql-bin.000003", Pos: 1234}, before))
+	assert.True(t, b.reached(mysql.Position{Name: "mysql-bin.000004", Pos: 4}, before))
+	assert.True(t, b.reached(mysql.Position{Name: "mysql-bin.000002", Pos: 4}, before+1))
+	// Artificial events carry no timestamp
+	assert.False(t, b.reached(mysql.Position{Name: "mysql-bin.000002", Pos: 4}, 0))
+}
+
+func TestStopBound_Executed(t *testing.T) {
+	b, err := parseStopBound(MysqlConfig{Flavor: "mysql", StopGTID: "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5"})
+	assert.NoError(t, err)
+	executed := func(gtid string) bool {
+		set, err := mysql.ParseGTIDSet("mysql", gtid)
+		assert.NoError(t, err)
+		return b.executed(set)
+	}
+	assert.False(t, executed("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-4"))
+	assert.True(t, executed("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-7"))
+	assert.False(t, b.executed(nil))
+}
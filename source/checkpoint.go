@@ -0,0 +1,127 @@
+package source
+
+import (
+	"errors"
+	"sync"
+)
+
+// Checkpointer Tracks in-flight events and commits the lowest fully acknowledged position
+// Every emitted event receives a monotonically increasing token. Positions reported by the
+// source are attached to the token boundary at which they were reached, and are only handed
+// to the commit function once every event before that boundary has been acknowledged.
+type Checkpointer[P any] struct {
+	mu sync.Mutex
+	// next The next token to hand out
+	next uint64
+	// low Every token below low has been acknowledged
+	low uint64
+	// acked Acknowledged tokens at or above low
+	acked map[uint64]struct{}
+	// marks Pending positions, ordered by their boundary
+	marks []checkpointMark[P]
+	// commit Persists a position that is safe to resume from
+	commit func(position P) error
+}
+
+// checkpointMark A position waiting for its preceding events to be acknowledged
+type checkpointMark[P any] struct {
+	// bound The position is safe once every token below bound is acknowledged
+	bound    uint64
+	position P
+	// apply Progress recorded with Defer, set instead of a position
+	apply func() error
+}
+
+// NewCheckpointer Creates a Checkpointer that persists positions with the given commit function
+func NewCheckpointer[P any](commit func(position P) error) *Checkpointer[P] {
+	return &Checkpointer[P]{
+		next:   1,
+		low:    1,
+		acked:  make(map[uint64]struct{}),
+		commit: commit,
+	}
+}
+
+// Track Assigns a token to a newly emitted event
+// Returns: The token that must be passed to Ack once the event is delivered
+func (c *Checkpointer[P]) Track() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token := c.next
+	c.next++
+	return token
+}
+
+// Mark Records a position reached after all events tracked so far
+// The position is committed immediately if nothing is in flight
+func (c *Checkpointer[P]) Mark(position P) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marks = append(c.marks, checkpointMark[P]{bound: c.next, position: position})
+	return c.flush()
+}
+
+// Defer Runs fn once every event tracked so far has been acknowledged
+// It persists progress other than the position, e.g. of a snapshot, with the same guarantee.
+// Deferred functions run in the order they were recorded, right away if nothing is in flight.
+func (c *Checkpointer[P]) Defer(fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marks = append(c.marks, checkpointMark[P]{bound: c.next, apply: fn})
+	return c.flush()
+}
+
+// Ack Acknowledges the event identified by token
+// Tokens of zero or already acknowledged tokens are ignored
+func (c *Checkpointer[P]) Ack(token uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if token == 0 || token < c.low || token >= c.next {
+		return nil
+	}
+	c.acked[token] = struct{}{}
+	for {
+		if _, ok := c.acked[c.low]; !ok {
+			break
+		}
+		delete(c.acked, c.low)
+		c.low++
+	}
+	return c.flush()
+}
+
+// Pending Returns the number of tracked events that have not been acknowledged
+func (c *Checkpointer[P]) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.next-c.low) - len(c.acked)
+}
+
+// flush Runs the deferred functions and commits the newest position whose events have all been acknowledged
+// Must be called with mu held
+func (c *Checkpointer[P]) flush() error {
+	ready := 0
+	for ready < len(c.marks) && c.marks[ready].bound <= c.low {
+		ready++
+	}
+	if ready == 0 {
+		return nil
+	}
+	marks := c.marks[:ready]
+	c.marks = c.marks[ready:]
+	var (
+		errs     []error
+		position *P
+	)
+	for _, mark := range marks {
+		if mark.apply != nil {
+			errs = append(errs, mark.apply())
+			continue
+		}
+		position = &mark.position
+	}
+	if position != nil {
+		errs = append(errs, c.commit(*position))
+	}
+	return errors.Join(errs...)
+}
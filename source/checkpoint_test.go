@@ -0,0 +1,92 @@
+package source
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointer_CommitsWhenNothingInFlight(t *testing.T) {
+	var committed []int
+	c := NewCheckpointer[int](func(position int) error {
+		committed = append(committed, position)
+		return nil
+	})
+	assert.NoError(t, c.Mark(10))
+	assert.Equal(t, []int{10}, committed)
+}
+
+func TestCheckpointer_WaitsForLowestAck(t *testing.T) {
+	var committed []int
+	c := NewCheckpointer[int](func(position int) error {
+		committed = append(committed, position)
+		return nil
+	})
+	t1 := c.Track()
+	t2 := c.Track()
+	assert.NoError(t, c.Mark(100))
+	t3 := c.Track()
+	assert.NoError(t, c.Mark(200))
+	assert.Equal(t, 3, c.Pending())
+
+	// Out of order acknowledgements must not move the checkpoint past t1
+	assert.NoError(t, c.Ack(t2))
+	assert.NoError(t, c.Ack(t3))
+	assert.Empty(t, committed)
+
+	// Once t1 is acknowledged the newest safe position is committed
+	assert.NoError(t, c.Ack(t1))
+	assert.Equal(t, []int{200}, committed)
+	assert.Equal(t, 0, c.Pending())
+}
+
+func TestCheckpointer_IgnoresUnknownTokens(t *testing.T) {
+	c := NewCheckpointer[int](func(position int) error { return nil })
+	tk := c.Track()
+	assert.NoError(t, c.Ack(0))
+	assert.NoError(t, c.Ack(tk+10))
+	assert.NoError(t, c.Ack(tk))
+	assert.NoError(t, c.Ack(tk))
+	assert.Equal(t, 0, c.Pending())
+}
+
+func TestCheckpointer_CommitError(t *testing.T) {
+	c := NewCheckpointer[int](func(position int) error { return errors.New("store down") })
+	tk := c.Track()
+	assert.NoError(t, c.Mark(1))
+	assert.Error(t, c.Ack(tk))
+}
+
+func TestCheckpointer_DeferRunsAfterAck(t *testing.T) {
+	var committed []int
+	var deferred []string
+	c := NewCheckpointer[int](func(position int) error {
+		committed = append(committed, position)
+		return nil
+	})
+	assert.NoError(t, c.Defer(func() error {
+		deferred = append(deferred, "idle")
+		return nil
+	}))
+	assert.Equal(t, []string{"idle"}, deferred)
+
+	t1 := c.Track()
+	assert.NoError(t, c.Defer(func() error {
+		deferred = append(deferred, "first")
+		return nil
+	}))
+	assert.NoError(t, c.Mark(100))
+	t2 := c.Track()
+	assert.NoError(t, c.Defer(func() error {
+		deferred = append(deferred, "second")
+		return nil
+	}))
+
+	assert.NoError(t, c.Ack(t1))
+	assert.Equal(t, []string{"idle", "first"}, deferred)
+	assert.Equal(t, []int{100}, committed)
+
+	assert.NoError(t, c.Ack(t2))
+	assert.Equal(t, []string{"idle", "first", "second"}, deferred)
+}
@@ -0,0 +1,467 @@
+package source
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// DecimalMode Defines how DECIMAL columns are represented
+type DecimalMode string
+
+const (
+	// DecimalModeString Exact decimal text, e.g. "12.30" (default)
+	DecimalModeString DecimalMode = "string"
+	// DecimalModeFloat float64, convenient but may lose precision
+	DecimalModeFloat DecimalMode = "float"
+)
+
+// BinaryMode Defines how BINARY, VARBINARY, BLOB and spatial columns are encoded
+type BinaryMode string
+
+const (
+	// BinaryModeBase64 Standard base64 (default)
+	BinaryModeBase64 BinaryMode = "base64"
+	// BinaryModeHex Lowercase hexadecimal
+	BinaryModeHex BinaryMode = "hex"
+)
+
+// JSONMode Defines how JSON columns are represented
+type JSONMode string
+
+const (
+	// JSONModeObject Embedded as a nested JSON value (default)
+	JSONModeObject JSONMode = "object"
+	// JSONModeString Kept as the JSON text
+	JSONModeString JSONMode = "string"
+)
+
+// BigintMode Defines how BIGINT columns are represented
+type BigintMode string
+
+const (
+	// BigintModeNumber JSON number (default)
+	BigintModeNumber BigintMode = "number"
+	// BigintModeString Decimal text, for consumers that parse numbers as float64
+	BigintModeString BigintMode = "string"
+)
+
+const (
+	// DefaultTimeZone Default zone TIMESTAMP columns are rendered in
+	DefaultTimeZone = "UTC"
+)
+
+// valueConverter Converts raw column values from binlog rows and snapshot queries
+// into a lossless, source independent representation.
+// Binlog and snapshot rows carry different Go types for the same column (e.g. int64 vs []byte
+// for BIT, an index vs the label for ENUM), so every type accepts both forms.
+type valueConverter struct {
+	decimal  DecimalMode
+	binary   BinaryMode
+	json     JSONMode
+	bigint   BigintMode
+	location *time.Location
+}
+
+// newValueConverter Creates a converter from the source configuration
+// cfg: MySQL datasource configuration
+// Returns: Converter and possible errors for unknown modes or time zones
+func newValueConverter(cfg MysqlConfig) (*valueConverter, error) {
+	c := &valueConverter{
+		decimal: cfg.DecimalMode,
+		binary:  cfg.BinaryMode,
+		json:    cfg.JSONMode,
+		bigint:  cfg.BigintMode,
+	}
+	switch c.decimal {
+	case "":
+		c.decimal = DecimalModeString
+	case DecimalModeString, DecimalModeFloat:
+	default:
+		return nil, fmt.Errorf("unsupported decimal mode: %s", c.decimal)
+	}
+	switch c.binary {
+	case "":
+		c.binary = BinaryModeBase64
+	case BinaryModeBase64, BinaryModeHex:
+	default:
+		return nil, fmt.Errorf("unsupported binary mode: %s", c.binary)
+	}
+	switch c.json {
+	case "":
+		c.json = JSONModeObject
+	case JSONModeObject, JSONModeString:
+	default:
+		return nil, fmt.Errorf("unsupported json mode: %s", c.json)
+	}
+	switch c.bigint {
+	case "":
+		c.bigint = BigintModeNumber
+	case BigintModeNumber, BigintModeString:
+	default:
+		return nil, fmt.Errorf("unsupported bigint mode: %s", c.bigint)
+	}
+	zone := cfg.TimeZone
+	if zone == "" {
+		zone = DefaultTimeZone
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("load time zone %q error: %w", zone, err)
+	}
+	c.location = location
+	return c, nil
+}
+
+// row Converts a row to a column name to value map
+// row: Row values in column order
+// table: Table schema information
+// Returns: Mapping of column names to converted values
+func (c *valueConverter) row(row []any, table *schema.Table) map[string]any {
+	m := make(map[string]any, len(table.Columns))
+	for i := range table.Columns {
+		// Rows written before a column was added are shorter than the current schema
+		if i >= len(row) {
+			break
+		}
+		m[table.Columns[i].Name] = c.value(&table.Columns[i], row[i])
+	}
+	return m
+}
+
+// value Converts a single column value
+// col: Column schema information
+// raw: Value read from the binlog or a snapshot query
+// Returns: Converted value, nil for NULL
+func (c *valueConverter) value(col *schema.TableColumn, raw any) any {
+	if raw == nil {
+		return nil
+	}
+	switch col.Type {
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT:
+		return c.integer(col, raw)
+	case schema.TYPE_FLOAT:
+		return floatValue(col, raw)
+	case schema.TYPE_DECIMAL:
+		text := textValue(raw)
+		if c.decimal == DecimalModeFloat {
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f
+			}
+		}
+		return text
+	case schema.TYPE_BIT:
+		return bitValue(col, raw)
+	case schema.TYPE_DATETIME:
+		if t, ok := raw.(time.Time); ok {
+			return t.Format(dateTimeLayout(col))
+		}
+		return adjustFraction(textValue(raw), fractionDigits(col))
+	case schema.TYPE_TIMESTAMP:
+		return c.timestamp(col, raw)
+	case schema.TYPE_DATE:
+		if t, ok := raw.(time.Time); ok {
+			return t.Format(time.DateOnly)
+		}
+		return textValue(raw)
+	case schema.TYPE_TIME:
+		return adjustFraction(textValue(raw), fractionDigits(col))
+	case schema.TYPE_ENUM:
+		return enumValue(col, raw)
+	case schema.TYPE_SET:
+		return setValue(col, raw)
+	case schema.TYPE_JSON:
+		text := textValue(raw)
+		if c.json == JSONModeObject && json.Valid([]byte(text)) {
+			return json.RawMessage(text)
+		}
+		return text
+	case schema.TYPE_BINARY, schema.TYPE_POINT:
+		return c.bytes(col, raw)
+	case schema.TYPE_STRING:
+		if isBinaryString(col) {
+			return c.bytes(col, raw)
+		}
+		return textValue(raw)
+	default:
+		if b, ok := raw.([]byte); ok {
+			return string(b)
+		}
+		return raw
+	}
+}
+
+// integer Converts an integer column to int64 or uint64
+// Negative values of unsigned columns are wrapped to the column width, since the binlog
+// only stores the bits and does not know about signedness.
+func (c *valueConverter) integer(col *schema.TableColumn, raw any) any {
+	var value any
+	switch v := raw.(type) {
+	case int8:
+		value = int64(v)
+	case int16:
+		value = int64(v)
+	case int32:
+		value = int64(v)
+	case int64:
+		value = v
+	case int:
+		value = int64(v)
+	case uint8:
+		value = uint64(v)
+	case uint16:
+		value = uint64(v)
+	case uint32:
+		value = uint64(v)
+	case uint64:
+		value = v
+	case uint:
+		value = uint64(v)
+	case []byte, string:
+		text := textValue(v)
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			value = n
+		} else if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			value = n
+		} else {
+			return text
+		}
+	default:
+		return raw
+	}
+	if n, ok := value.(int64); ok && col.IsUnsigned {
+		bits := integerBits(col.RawType)
+		if n < 0 && bits < 64 {
+			n += 1 << bits
+		}
+		value = uint64(n)
+	}
+	if c.bigint == BigintModeString && strings.HasPrefix(col.RawType, "bigint") {
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+// timestamp Renders a TIMESTAMP column in the configured zone
+// Binlog and snapshot values are read in UTC, zero dates are kept as text.
+func (c *valueConverter) timestamp(col *schema.TableColumn, raw any) any {
+	digits := fractionDigits(col)
+	layout := "2006-01-02T15:04:05" + fractionLayout(digits) + "Z07:00"
+	if t, ok := raw.(time.Time); ok {
+		return t.In(c.location).Format(layout)
+	}
+	text := adjustFraction(textValue(raw), digits)
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", text, time.UTC)
+	if err != nil {
+		return text
+	}
+	return t.In(c.location).Format(layout)
+}
+
+// bytes Encodes a binary column
+// BINARY(n) values lose their trailing zero bytes in the binlog, they are padded back to n.
+func (c *valueConverter) bytes(col *schema.TableColumn, raw any) any {
+	var data []byte
+	switch v := raw.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return raw
+	}
+	if col.Type == schema.TYPE_BINARY && col.FixedSize > 0 && uint(len(data)) < col.FixedSize {
+		padded := make([]byte, col.FixedSize)
+		copy(padded, data)
+		data = padded
+	}
+	if c.binary == BinaryModeHex {
+		return hex.EncodeToString(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// floatValue Converts FLOAT and DOUBLE columns to float64
+// FLOAT is single precision, it is widened through its shortest decimal form so that
+// 0.1 stays 0.1 instead of becoming 0.10000000149011612.
+func floatValue(col *schema.TableColumn, raw any) any {
+	single := strings.HasPrefix(col.RawType, "float")
+	switch v := raw.(type) {
+	case float32:
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		return f
+	case float64:
+		if single {
+			f, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', -1, 32), 64)
+			return f
+		}
+		return v
+	case []byte, string:
+		text := textValue(v)
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+		return text
+	default:
+		return raw
+	}
+}
+
+// bitValue Converts a BIT column, BIT(1) becomes a bool and wider columns an unsigned integer
+// The binlog carries an int64, snapshot queries the big-endian bytes.
+func bitValue(col *schema.TableColumn, raw any) any {
+	var n uint64
+	switch v := raw.(type) {
+	case int64:
+		n = uint64(v)
+	case uint64:
+		n = v
+	case []byte:
+		var buf [8]byte
+		if len(v) > len(buf) {
+			v = v[len(v)-len(buf):]
+		}
+		copy(buf[len(buf)-len(v):], v)
+		n = binary.BigEndian.Uint64(buf[:])
+	default:
+		return raw
+	}
+	if col.RawType == "bit" || col.RawType == "bit(1)" {
+		return n != 0
+	}
+	return n
+}
+
+// enumValue Converts an ENUM column to its label
+// The binlog carries the 1-based index, 0 being the empty value stored for invalid input.
+func enumValue(col *schema.TableColumn, raw any) any {
+	index, ok := indexValue(raw)
+	if !ok {
+		return textValue(raw)
+	}
+	if index == 0 {
+		return ""
+	}
+	if int(index) > len(col.EnumValues) {
+		return strconv.FormatUint(index, 10)
+	}
+	return col.EnumValues[index-1]
+}
+
+// setValue Converts a SET column to its comma separated members
+// The binlog carries a bitmask over the declared members.
+func setValue(col *schema.TableColumn, raw any) any {
+	mask, ok := indexValue(raw)
+	if !ok {
+		return textValue(raw)
+	}
+	var members []string
+	for i, member := range col.SetValues {
+		if i < 64 && mask&(1<<uint(i)) != 0 {
+			members = append(members, member)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// indexValue Returns the numeric form of an ENUM or SET value read from the binlog
+func indexValue(raw any) (uint64, bool) {
+	switch v := raw.(type) {
+	case int64:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int:
+		return uint64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// textValue Returns the text form of a value
+func textValue(raw any) string {
+	switch v := raw.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isBinaryString Reports whether a column classified as TYPE_STRING holds raw bytes
+// canal maps BLOB and non-point spatial types to TYPE_STRING.
+func isBinaryString(col *schema.TableColumn) bool {
+	if strings.Contains(col.RawType, "blob") {
+		return true
+	}
+	switch col.RawType {
+	case "geometry", "linestring", "polygon", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return true
+	}
+	return false
+}
+
+// integerBits Returns the storage width of an integer type
+func integerBits(rawType string) uint {
+	switch {
+	case strings.HasPrefix(rawType, "tinyint"):
+		return 8
+	case strings.HasPrefix(rawType, "smallint"):
+		return 16
+	case strings.HasPrefix(rawType, "mediumint"):
+		return 24
+	case strings.HasPrefix(rawType, "bigint"):
+		return 64
+	default:
+		return 32
+	}
+}
+
+// fractionDigits Returns the fractional seconds precision of a temporal type, e.g. 3 for datetime(3)
+func fractionDigits(col *schema.TableColumn) int {
+	start := strings.IndexByte(col.RawType, '(')
+	end := strings.IndexByte(col.RawType, ')')
+	if start < 0 || end <= start {
+		return 0
+	}
+	digits, err := strconv.Atoi(col.RawType[start+1 : end])
+	if err != nil || digits < 0 || digits > 6 {
+		return 0
+	}
+	return digits
+}
+
+// fractionLayout Returns the time layout suffix for a number of fractional digits
+func fractionLayout(digits int) string {
+	if digits == 0 {
+		return ""
+	}
+	return "." + strings.Repeat("0", digits)
+}
+
+// dateTimeLayout Returns the DATETIME layout matching the column precision
+func dateTimeLayout(col *schema.TableColumn) string {
+	return time.DateTime + fractionLayout(fractionDigits(col))
+}
+
+// adjustFraction Pads or truncates the fractional seconds of a temporal value to the column precision
+// Snapshot queries always return six digits, the binlog returns exactly the declared precision.
+func adjustFraction(text string, digits int) string {
+	base, fraction, _ := strings.Cut(text, ".")
+	if digits == 0 {
+		return base
+	}
+	if len(fraction) > digits {
+		fraction = fraction[:digits]
+	}
+	return base + "." + fraction + strings.Repeat("0", digits-len(fraction))
+}
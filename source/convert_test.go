@@ -0,0 +1,114 @@
+package source
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConverter(t *testing.T, cfg MysqlConfig) *valueConverter {
+	c, err := newValueConverter(cfg)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestValueConverter_Types(t *testing.T) {
+	c := newTestConverter(t, MysqlConfig{TimeZone: "Asia/Shanghai"})
+	tests := []struct {
+		name     string
+		rawType  string
+		typ      int
+		raw      any
+		expected any
+	}{
+		{"number", "int", schema.TYPE_NUMBER, int32(-7), int64(-7)},
+		{"number snapshot", "int", schema.TYPE_NUMBER, []byte("42"), int64(42)},
+		{"number unsigned from canal", "int unsigned", schema.TYPE_NUMBER, uint32(4294967295), uint64(4294967295)},
+		{"number unsigned overflow", "tinyint unsigned", schema.TYPE_NUMBER, int8(-1), uint64(255)},
+		{"bigint unsigned", "bigint unsigned", schema.TYPE_NUMBER, int64(-1), uint64(18446744073709551615)},
+		{"year", "year", schema.TYPE_NUMBER, int(2024), int64(2024)},
+		{"medium int unsigned overflow", "mediumint unsigned", schema.TYPE_MEDIUM_INT, int32(-1), uint64(16777215)},
+		{"float", "float", schema.TYPE_FLOAT, float32(0.1), 0.1},
+		{"float snapshot", "float", schema.TYPE_FLOAT, float64(float32(0.1)), 0.1},
+		{"double", "double", schema.TYPE_FLOAT, 0.1, 0.1},
+		{"decimal", "decimal(30,10)", schema.TYPE_DECIMAL, "12345678901234567890.0123456789", "12345678901234567890.0123456789"},
+		{"decimal snapshot", "decimal(10,2)", schema.TYPE_DECIMAL, []byte("12.30"), "12.30"},
+		{"enum index", "enum('a','b','c')", schema.TYPE_ENUM, int64(2), "b"},
+		{"enum empty", "enum('a','b','c')", schema.TYPE_ENUM, int64(0), ""},
+		{"enum snapshot", "enum('a','b','c')", schema.TYPE_ENUM, []byte("c"), "c"},
+		{"set bitmask", "set('a','b','c')", schema.TYPE_SET, int64(5), "a,c"},
+		{"set snapshot", "set('a','b','c')", schema.TYPE_SET, []byte("a,b"), "a,b"},
+		{"string", "varchar(255)", schema.TYPE_STRING, "héllo", "héllo"},
+		{"text", "text", schema.TYPE_STRING, []byte("hello"), "hello"},
+		{"blob", "blob", schema.TYPE_STRING, []byte{0xff, 0x00}, "/wA="},
+		{"datetime", "datetime", schema.TYPE_DATETIME, "2024-01-02 03:04:05", "2024-01-02 03:04:05"},
+		{"datetime fraction", "datetime(3)", schema.TYPE_DATETIME, "2024-01-02 03:04:05.120", "2024-01-02 03:04:05.120"},
+		{"datetime snapshot fraction", "datetime(3)", schema.TYPE_DATETIME, []byte("2024-01-02 03:04:05.120000"), "2024-01-02 03:04:05.120"},
+		{"datetime zero", "datetime", schema.TYPE_DATETIME, "0000-00-00 00:00:00", "0000-00-00 00:00:00"},
+		{"timestamp", "timestamp", schema.TYPE_TIMESTAMP, "2024-01-02 03:04:05", "2024-01-02T11:04:05+08:00"},
+		{"timestamp fraction", "timestamp(6)", schema.TYPE_TIMESTAMP, []byte("2024-01-02 03:04:05.000001"), "2024-01-02T11:04:05.000001+08:00"},
+		{"timestamp zero", "timestamp", schema.TYPE_TIMESTAMP, "0000-00-00 00:00:00", "0000-00-00 00:00:00"},
+		{"date", "date", schema.TYPE_DATE, "2024-01-02", "2024-01-02"},
+		{"time", "time", schema.TYPE_TIME, "-838:59:59", "-838:59:59"},
+		{"time fraction", "time(2)", schema.TYPE_TIME, []byte("12:00:00.500000"), "12:00:00.50"},
+		{"bit", "bit(1)", schema.TYPE_BIT, int64(1), true},
+		{"bit snapshot", "bit(1)", schema.TYPE_BIT, []byte{0}, false},
+		{"bit wide", "bit(16)", schema.TYPE_BIT, []byte{0x01, 0x02}, uint64(258)},
+		{"json", "json", schema.TYPE_JSON, []byte(`{"a":[1,2]}`), json.RawMessage(`{"a":[1,2]}`)},
+		{"json invalid", "json", schema.TYPE_JSON, []byte(`{`), "{"},
+		{"binary padded", "binary(4)", schema.TYPE_BINARY, "\x01\x02", "AQIAAA=="},
+		{"varbinary", "varbinary(16)", schema.TYPE_BINARY, []byte{0xde, 0xad}, "3q0="},
+		{"point", "point", schema.TYPE_POINT, []byte{0x01, 0x01}, "AQE="},
+		{"null", "int", schema.TYPE_NUMBER, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &schema.Table{}
+			table.AddColumn("c", tt.rawType, "", "")
+			assert.Equal(t, tt.typ, table.Columns[0].Type)
+			assert.Equal(t, tt.expected, c.value(&table.Columns[0], tt.raw))
+		})
+	}
+}
+
+func TestValueConverter_Modes(t *testing.T) {
+	c := newTestConverter(t, MysqlConfig{
+		DecimalMode: DecimalModeFloat,
+		BinaryMode:  BinaryModeHex,
+		JSONMode:    JSONModeString,
+		BigintMode:  BigintModeString,
+	})
+	table := &schema.Table{}
+	table.AddColumn("amount", "decimal(10,2)", "", "")
+	table.AddColumn("data", "varbinary(16)", "", "")
+	table.AddColumn("doc", "json", "", "")
+	table.AddColumn("id", "bigint unsigned", "", "")
+	table.AddColumn("ts", "timestamp", "", "")
+
+	row := c.row([]any{"12.30", []byte{0xde, 0xad}, []byte(`{"a":1}`), uint64(18446744073709551615), "2024-01-02 03:04:05"}, table)
+	assert.Equal(t, map[string]any{
+		"amount": 12.3,
+		"data":   "dead",
+		"doc":    `{"a":1}`,
+		"id":     "18446744073709551615",
+		"ts":     "2024-01-02T03:04:05Z",
+	}, row)
+}
+
+func TestValueConverter_RowShorterThanSchema(t *testing.T) {
+	c := newTestConverter(t, MysqlConfig{})
+	table := &schema.Table{}
+	table.AddColumn("id", "int", "", "")
+	table.AddColumn("added", "int", "", "")
+
+	assert.Equal(t, map[string]any{"id": int64(1)}, c.row([]any{int32(1)}, table))
+}
+
+func TestValueConverter_InvalidConfig(t *testing.T) {
+	_, err := newValueConverter(MysqlConfig{DecimalMode: "exact"})
+	assert.Error(t, err)
+	_, err = newValueConverter(MysqlConfig{TimeZone: "Nowhere/City"})
+	assert.Error(t, err)
+}
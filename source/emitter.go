@@ -0,0 +1,190 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+)
+
+// OverflowPolicy Defines what a source does when its event channel is full
+type OverflowPolicy string
+
+const (
+	// OverflowPolicyBlock Waits for free space, stalling the binlog reader (default)
+	OverflowPolicyBlock OverflowPolicy = "block"
+	// OverflowPolicyDrop Discards the event and increments the dropped counter
+	OverflowPolicyDrop OverflowPolicy = "drop"
+	// OverflowPolicySpill Writes the event to a disk queue that is drained in order
+	OverflowPolicySpill OverflowPolicy = "spill"
+)
+
+const (
+	// DefaultBufferSize Default capacity of the source event channel
+	DefaultBufferSize = 10240
+)
+
+// emitter Delivers events into the source channel according to the overflow policy
+type emitter struct {
+	// ch Event channel read by the workers
+	ch chan types.EventData
+	// policy Behavior when ch is full
+	policy OverflowPolicy
+	// onDrop Called for every discarded event, used to acknowledge it
+	onDrop func(event types.EventData)
+	// dropped Number of events discarded under OverflowPolicyDrop
+	dropped atomic.Uint64
+	// spill Disk queue used under OverflowPolicySpill
+	spill *spillQueue
+	// mu Serializes direct sends against the spill queue so ordering is preserved
+	mu sync.Mutex
+	// cancel Stops the spill drain goroutine
+	cancel context.CancelFunc
+	// wg Waits for the spill drain goroutine
+	wg sync.WaitGroup
+}
+
+// newEmitter Creates an emitter with a channel of the given size
+// size: Channel capacity, DefaultBufferSize when not positive
+// policy: Overflow policy, OverflowPolicyBlock when empty
+// spillDir: Directory for the disk queue, only used by OverflowPolicySpill
+// onDrop: Called for every discarded event
+func newEmitter(size int, policy OverflowPolicy, spillDir string, onDrop func(event types.EventData)) (*emitter, error) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	if policy == "" {
+		policy = OverflowPolicyBlock
+	}
+	e := &emitter{
+		ch:     make(chan types.EventData, size),
+		policy: policy,
+		onDrop: onDrop,
+		cancel: func() {},
+	}
+	switch policy {
+	case OverflowPolicyBlock, OverflowPolicyDrop:
+	case OverflowPolicySpill:
+		spill, err := newSpillQueue(spillDir)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		e.spill = spill
+		e.cancel = cancel
+		e.wg.Add(1)
+		go e.drain(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported overflow policy: %s", policy)
+	}
+	return e, nil
+}
+
+// emit Delivers an event according to the overflow policy
+// ctx: Cancels a blocked send
+// Returns: Possible errors
+func (e *emitter) emit(ctx context.Context, event types.EventData) error {
+	switch e.policy {
+	case OverflowPolicyDrop:
+		select {
+		case e.ch <- event:
+		default:
+			dropped := e.dropped.Add(1)
+			logx.Warn("Event channel is full, discarding event, db: %s, table: %s, dropped: %d", event.Row.Database, event.Row.Table, dropped)
+			if e.onDrop != nil {
+				e.onDrop(event)
+			}
+		}
+		return nil
+	case OverflowPolicySpill:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		// Once anything is spilled, later events queue behind it to keep the order
+		if e.spill.Len() == 0 {
+			select {
+			case e.ch <- event:
+				return nil
+			default:
+			}
+		}
+		return e.spill.Push(event)
+	default:
+		select {
+		case e.ch <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// drain Moves spilled events back into the channel in order
+func (e *emitter) drain(ctx context.Context) {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.spill.Ready():
+		}
+		for e.spill.Len() > 0 {
+			event, err := e.spill.Peek()
+			if err != nil {
+				logx.Error("failed to read spilled event: %v", err)
+				return
+			}
+			select {
+			case e.ch <- event:
+			case <-ctx.Done():
+				return
+			}
+			e.mu.Lock()
+			err = e.spill.Pop()
+			e.mu.Unlock()
+			if err != nil {
+				logx.Error("failed to advance spill queue: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// flush Waits until every spilled event has been moved back into the channel
+// Used by finite sources before they close the channel
+// ctx: Cancels the wait
+// Returns: Possible errors
+func (e *emitter) flush(ctx context.Context) error {
+	if e.spill == nil {
+		return nil
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for e.spill.Len() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Dropped Returns the number of events discarded under OverflowPolicyDrop
+func (e *emitter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// close Stops the spill drain goroutine and removes the disk queue
+// It must be called before the channel is closed
+func (e *emitter) close() error {
+	e.cancel()
+	e.wg.Wait()
+	if e.spill != nil {
+		return e.spill.Close()
+	}
+	return nil
+}
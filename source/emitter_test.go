@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmitter_DropCountsAndAcks(t *testing.T) {
+	var dropped []uint64
+	e, err := newEmitter(1, OverflowPolicyDrop, "", func(event types.EventData) {
+		dropped = append(dropped, event.Token)
+	})
+	assert.NoError(t, err)
+	defer e.close()
+
+	assert.NoError(t, e.emit(context.Background(), types.EventData{Token: 1}))
+	assert.NoError(t, e.emit(context.Background(), types.EventData{Token: 2}))
+	assert.Equal(t, uint64(1), e.Dropped())
+	assert.Equal(t, []uint64{2}, dropped)
+}
+
+func TestEmitter_BlockHonorsContext(t *testing.T) {
+	e, err := newEmitter(1, OverflowPolicyBlock, "", nil)
+	assert.NoError(t, err)
+	defer e.close()
+
+	assert.NoError(t, e.emit(context.Background(), types.EventData{Token: 1}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, e.emit(ctx, types.EventData{Token: 2}), context.DeadlineExceeded)
+}
+
+func TestEmitter_SpillPreservesOrder(t *testing.T) {
+	e, err := newEmitter(2, OverflowPolicySpill, t.TempDir(), nil)
+	assert.NoError(t, err)
+	defer e.close()
+
+	for i := uint64(1); i <= 50; i++ {
+		event := types.EventData{Token: i, Row: types.EventRowData{Data: map[string]any{"id": int64(i)}}}
+		assert.NoError(t, e.emit(context.Background(), event))
+	}
+	for i := uint64(1); i <= 50; i++ {
+		select {
+		case event := <-e.ch:
+			assert.Equal(t, i, event.Token)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+	assert.Eventually(t, func() bool { return e.spill.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestEmitter_SpillKeepsPartitionKey(t *testing.T) {
+	e, err := newEmitter(1, OverflowPolicySpill, t.TempDir(), nil)
+	assert.NoError(t, err)
+	defer e.close()
+
+	// The lane of an event is picked from its table and partition key, both must survive the spill file
+	var sent []types.EventData
+	for i := uint64(1); i <= 5; i++ {
+		event := types.EventData{Token: i, PartitionKey: fmt.Sprintf("%d", i*10)}
+		event.Row.Database = "shop"
+		event.Row.Table = "orders"
+		sent = append(sent, event)
+		assert.NoError(t, e.emit(context.Background(), event))
+	}
+	assert.Positive(t, e.spill.Len(), "events beyond the channel capacity must be spilled")
+	for _, want := range sent {
+		select {
+		case event := <-e.ch:
+			assert.Equal(t, want.Token, event.Token)
+			assert.Equal(t, want.PartitionKey, event.PartitionKey)
+			assert.Equal(t, want.Row.Database, event.Row.Database)
+			assert.Equal(t, want.Row.Table, event.Row.Table)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event %d", want.Token)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package source
+
+import "github.com/chihqiang/dbxgo/filter"
+
+// tableFilter Matches "database.table" names against include and exclude regexes
+// It follows the same rules as canal: a table must match an include regex (if any)
+// and must not match any exclude regex
+type tableFilter = filter.Tables
+
+// newTableFilter Compiles the include and exclude regexes
+func newTableFilter(include, exclude []string) (*tableFilter, error) {
+	return filter.NewTables(include, exclude)
+}
@@ -0,0 +1,29 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFilter_Match(t *testing.T) {
+	f, err := newTableFilter([]string{"dbxgo\\..*"}, []string{"dbxgo\\.tmp_.*"})
+	assert.NoError(t, err)
+
+	assert.True(t, f.Match("dbxgo", "users"))
+	assert.False(t, f.Match("dbxgo", "tmp_users"))
+	assert.False(t, f.Match("other", "users"))
+}
+
+func TestTableFilter_EmptyIncludeMatchesAll(t *testing.T) {
+	f, err := newTableFilter(nil, DefaultMysqlExcludeTableRegex)
+	assert.NoError(t, err)
+
+	assert.True(t, f.Match("shop", "orders"))
+	assert.False(t, f.Match("mysql", "user"))
+}
+
+func TestTableFilter_InvalidRegex(t *testing.T) {
+	_, err := newTableFilter([]string{"("}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,446 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// Signal types written to the signal table
+// The table is expected to look like:
+//
+//	CREATE TABLE dbxgo_signal (
+//	  id   VARCHAR(64) PRIMARY KEY,
+//	  type VARCHAR(32) NOT NULL,
+//	  data TEXT NULL
+//	);
+//
+// A snapshot is requested with:
+//
+//	INSERT INTO dbxgo_signal (id, type, data) VALUES ('1', 'execute-snapshot', '{"tables":["shop.orders"]}');
+const (
+	// SignalExecuteSnapshot Requests an incremental snapshot of the tables listed in data
+	SignalExecuteSnapshot = "execute-snapshot"
+	// signalWindowOpen Low watermark written before a chunk is read
+	signalWindowOpen = "snapshot-window-open"
+	// signalWindowClose High watermark written after a chunk is read
+	signalWindowClose = "snapshot-window-close"
+)
+
+// incrementalSignal Payload of an execute-snapshot signal
+type incrementalSignal struct {
+	// Tables Tables to snapshot, as "database.table"
+	Tables []string `json:"tables"`
+}
+
+// incrementalState Progress of the incremental snapshot, persisted in the store
+type incrementalState struct {
+	// Tables Remaining tables, the first one is in progress
+	Tables []string `json:"tables"`
+	// LastPK Primary key values of the last row emitted for the first table
+	LastPK []any `json:"last_pk,omitempty"`
+}
+
+// advance Moves past a chunk
+// pk: Primary key values of the last row of the chunk
+// tableDone: Whether the table in progress is finished
+func (st *incrementalState) advance(pk []any, tableDone bool) {
+	if tableDone {
+		if len(st.Tables) > 0 {
+			st.Tables = st.Tables[1:]
+		}
+		st.LastPK = nil
+		return
+	}
+	st.LastPK = pk
+}
+
+// snapshotWindow A chunk being read between a low and a high watermark
+type snapshotWindow struct {
+	// id Window identifier, used to match the watermark rows
+	id string
+	// table Table the chunk belongs to
+	table *schema.Table
+	// open Whether the low watermark has been seen in the binlog
+	open bool
+	// keys Primary keys changed in the binlog while the window is open
+	keys map[string]struct{}
+	// rows Chunk rows, set before the high watermark is written
+	rows [][]any
+	// done Closed once the chunk has been emitted
+	done chan struct{}
+}
+
+// incrementalSnapshot Runs DBLog style incremental snapshots alongside binlog streaming
+// Each chunk is read between two watermark rows written to the signal table. Rows of the chunk
+// that change in the binlog between the watermarks are dropped from the chunk, since the binlog
+// already carries a newer version. The remaining rows are emitted when the high watermark is
+// read, so they are always ordered correctly against concurrent changes.
+type incrementalSnapshot struct {
+	mu  sync.Mutex
+	src *MySQLSource
+	// signal Signal table
+	signal tableRef
+	// state Snapshot progress, ahead of saved while emitted chunks are not acknowledged yet
+	state incrementalState
+	// saved Progress of the acknowledged chunks, the one persisted in the store
+	saved incrementalState
+	// window Chunk in progress
+	window *snapshotWindow
+	// wake Signaled when new tables are queued
+	wake chan struct{}
+}
+
+// newIncrementalSnapshot Creates an incremental snapshot for a "database.table" signal table
+func newIncrementalSnapshot(src *MySQLSource, signalTable string) (*incrementalSnapshot, error) {
+	database, table, ok := strings.Cut(signalTable, ".")
+	if !ok || database == "" || table == "" {
+		return nil, fmt.Errorf("signal table must be in the form database.table: %q", signalTable)
+	}
+	return &incrementalSnapshot{
+		src:    src,
+		signal: tableRef{database: database, table: table},
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// isSignalTable Reports whether a table is the signal table
+func (i *incrementalSnapshot) isSignalTable(database, table string) bool {
+	return i.signal.database == database && i.signal.table == table
+}
+
+// load Restores the progress saved by a previous run
+func (i *incrementalSnapshot) load() error {
+	data, err := i.src.store.Get(StoreKeyIncrementalSnapshot)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var state incrementalState
+	if err := decoder.Decode(&state); err != nil {
+		return fmt.Errorf("decode incremental snapshot state error: %w", err)
+	}
+	for idx, v := range state.LastPK {
+		if n, ok := v.(json.Number); ok {
+			state.LastPK[idx] = numberValue(n)
+		}
+	}
+	i.mu.Lock()
+	i.state = state
+	i.saved = incrementalState{Tables: slices.Clone(state.Tables), LastPK: state.LastPK}
+	i.mu.Unlock()
+	if len(state.Tables) > 0 {
+		logx.Info("MySQL incremental snapshot resuming, tables: %v", state.Tables)
+	}
+	return nil
+}
+
+// save Persists the progress of the acknowledged chunks
+// Must be called with mu held
+func (i *incrementalSnapshot) save() error {
+	data, err := json.Marshal(i.saved)
+	if err != nil {
+		return fmt.Errorf("marshal incremental snapshot state error: %w", err)
+	}
+	return i.src.store.Set(StoreKeyIncrementalSnapshot, data)
+}
+
+// observe Records primary keys changed while a window is open
+// rowsEvent: Row change event read from the binlog
+func (i *incrementalSnapshot) observe(rowsEvent *canal.RowsEvent) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	w := i.window
+	if w == nil || !w.open || w.table.Schema != rowsEvent.Table.Schema || w.table.Name != rowsEvent.Table.Name {
+		return
+	}
+	// Both images of an update are recorded, a changed primary key invalidates either row
+	for _, row := range rowsEvent.Rows {
+		w.keys[primaryKeyString(rowsEvent.Table, row)] = struct{}{}
+	}
+}
+
+// onSignal Handles rows inserted into the signal table
+// ctx: Context of the binlog stream, cancels emitting a chunk
+// rowsEvent: Row change event on the signal table
+// Returns: Possible errors
+func (i *incrementalSnapshot) onSignal(ctx context.Context, rowsEvent *canal.RowsEvent) error {
+	if rowsEvent.Action != canal.InsertAction {
+		return nil
+	}
+	for _, row := range rowsEvent.Rows {
+		m := i.src.rowToMap(row, rowsEvent.Table)
+		id := textValue(m["id"])
+		data := textValue(m["data"])
+		switch textValue(m["type"]) {
+		case SignalExecuteSnapshot:
+			if err := i.enqueue(id, data); err != nil {
+				logx.Error("invalid incremental snapshot signal, id: %s, error: %v", id, err)
+			}
+		case signalWindowOpen:
+			i.mu.Lock()
+			if i.window != nil && id == i.window.id+"-open" {
+				i.window.open = true
+			}
+			i.mu.Unlock()
+		case signalWindowClose:
+			if err := i.closeWindow(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueue Queues the tables of an execute-snapshot signal
+// id: Signal id
+// data: Signal payload
+// Returns: Possible errors
+func (i *incrementalSnapshot) enqueue(id, data string) error {
+	var signal incrementalSignal
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, name := range signal.Tables {
+		database, table, ok := strings.Cut(name, ".")
+		if !ok || !i.src.filter.Match(database, table) || i.isSignalTable(database, table) {
+			logx.Warn("incremental snapshot skips table not captured by this source: %s", name)
+			continue
+		}
+		// A signal replayed after a restart must not queue the same table twice
+		if slices.Contains(i.state.Tables, name) {
+			continue
+		}
+		i.state.Tables = append(i.state.Tables, name)
+		i.saved.Tables = append(i.saved.Tables, name)
+	}
+	logx.Info("MySQL incremental snapshot requested, id: %s, tables: %v", id, signal.Tables)
+	if err := i.save(); err != nil {
+		return err
+	}
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// closeWindow Emits the chunk rows that were not changed while the window was open
+// ctx: Context of the binlog stream, cancels emitting the chunk
+// id: Id of the high watermark row
+// Returns: Possible errors
+func (i *incrementalSnapshot) closeWindow(ctx context.Context, id string) error {
+	i.mu.Lock()
+	w := i.window
+	if w == nil || !w.open || id != w.id+"-close" {
+		i.mu.Unlock()
+		return nil
+	}
+	i.window = nil
+	i.mu.Unlock()
+	defer close(w.done)
+	startedAt := time.Now()
+	for _, row := range w.rows {
+		if _, changed := w.keys[primaryKeyString(w.table, row)]; changed {
+			continue
+		}
+		if err := i.src.emitter.emit(ctx, i.src.newSnapshotEvent(w.table, row, startedAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run Processes queued tables chunk by chunk until the context is canceled
+// ctx: Context to control cancellation
+func (i *incrementalSnapshot) run(ctx context.Context) {
+	var conn *client.Conn
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+	for {
+		i.mu.Lock()
+		idle := len(i.state.Tables) == 0
+		i.mu.Unlock()
+		if idle {
+			select {
+			case <-ctx.Done():
+				return
+			case <-i.wake:
+				continue
+			}
+		}
+		if conn == nil {
+			var err error
+			conn, err = i.src.connect()
+			if err != nil {
+				logx.Error("incremental snapshot connect error: %v", err)
+				if !sleepContext(ctx, 5*time.Second) {
+					return
+				}
+				continue
+			}
+		}
+		if err := i.nextChunk(ctx, conn); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logx.Error("incremental snapshot chunk error: %v", err)
+			_ = conn.Close()
+			conn = nil
+			if !sleepContext(ctx, 5*time.Second) {
+				return
+			}
+		}
+	}
+}
+
+// nextChunk Reads and emits the next chunk of the table in progress
+// ctx: Context to control cancellation
+// conn: Connection used for the watermarks and the chunk query
+// Returns: Possible errors
+func (i *incrementalSnapshot) nextChunk(ctx context.Context, conn *client.Conn) error {
+	i.mu.Lock()
+	name := i.state.Tables[0]
+	lastPK := i.state.LastPK
+	i.mu.Unlock()
+
+	database, tableName, _ := strings.Cut(name, ".")
+	table, err := i.src.canal.GetTable(database, tableName)
+	if err != nil || len(table.PKColumns) == 0 {
+		logx.Warn("incremental snapshot skips table without primary key or metadata: %s, error: %v", name, err)
+		return i.advance(nil, true)
+	}
+
+	w := &snapshotWindow{
+		id:    strconv.FormatInt(time.Now().UnixNano(), 10),
+		table: table,
+		keys:  make(map[string]struct{}),
+		done:  make(chan struct{}),
+	}
+	i.mu.Lock()
+	i.window = w
+	i.mu.Unlock()
+	defer func() {
+		i.mu.Lock()
+		if i.window == w {
+			i.window = nil
+		}
+		i.mu.Unlock()
+	}()
+
+	if err := i.writeSignal(conn, w.id+"-open", signalWindowOpen, name); err != nil {
+		return err
+	}
+	chunkSize := i.src.snapshotChunkSize()
+	rows, err := selectChunk(conn, table, lastPK, chunkSize)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	w.rows = rows
+	i.mu.Unlock()
+	if err := i.writeSignal(conn, w.id+"-close", signalWindowClose, name); err != nil {
+		return err
+	}
+	// The binlog reader emits the chunk when it reaches the high watermark
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-w.done:
+			waiting = false
+		case <-ticker.C:
+			logx.Warn("incremental snapshot still waiting for the high watermark of %s, make sure the signal table is captured by the binlog", name)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if _, err := conn.Execute(fmt.Sprintf("DELETE FROM %s.%s WHERE id IN (?, ?)",
+		quoteIdentifier(i.signal.database), quoteIdentifier(i.signal.table)), w.id+"-open", w.id+"-close"); err != nil {
+		logx.Warn("incremental snapshot failed to remove watermarks: %v", err)
+	}
+	if len(rows) < chunkSize {
+		logx.Info("MySQL incremental snapshot table done: %s", name)
+		return i.advance(nil, true)
+	}
+	pk, err := table.GetPKValues(rows[len(rows)-1])
+	if err != nil {
+		return err
+	}
+	return i.advance(pk, false)
+}
+
+// advance Moves to the next chunk and saves the progress once the chunk is delivered
+// The saved progress only moves past rows that were acknowledged, so a crash before delivery
+// reads the chunk again after a restart instead of losing it.
+// pk: Primary key values of the last row read
+// tableDone: Whether the table in progress is finished
+// Returns: Possible errors
+func (i *incrementalSnapshot) advance(pk []any, tableDone bool) error {
+	for idx, v := range pk {
+		// Byte values would be saved as base64, keep them readable and comparable
+		if b, ok := v.([]byte); ok {
+			pk[idx] = string(b)
+		}
+	}
+	i.mu.Lock()
+	i.state.advance(pk, tableDone)
+	i.mu.Unlock()
+	return i.src.checkpoint.Defer(func() error {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.saved.advance(pk, tableDone)
+		return i.save()
+	})
+}
+
+// writeSignal Inserts a watermark row into the signal table
+func (i *incrementalSnapshot) writeSignal(conn *client.Conn, id, signalType, data string) error {
+	_, err := conn.Execute(fmt.Sprintf("INSERT INTO %s.%s (id, type, data) VALUES (?, ?, ?)",
+		quoteIdentifier(i.signal.database), quoteIdentifier(i.signal.table)), id, signalType, data)
+	if err != nil {
+		return fmt.Errorf("write %s watermark error: %w", signalType, err)
+	}
+	return nil
+}
+
+// numberValue Converts a JSON number back to an integer when possible
+func numberValue(n json.Number) any {
+	if v, err := n.Int64(); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return v
+	}
+	return n.String()
+}
+
+// sleepContext Waits for the duration or until the context is canceled
+// Returns: false if the context was canceled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
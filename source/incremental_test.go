@@ -0,0 +1,248 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// signalTable Schema of the shop.dbxgo_signal table
+func signalTable() *schema.Table {
+	return &schema.Table{
+		Schema: "shop",
+		Name:   "dbxgo_signal",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_STRING},
+			{Name: "type", Type: schema.TYPE_STRING},
+			{Name: "data", Type: schema.TYPE_STRING},
+		},
+		PKColumns: []int{0},
+	}
+}
+
+// signalRow Builds the binlog event of a row inserted into the signal table
+func signalRow(id, signalType, data string) *canal.RowsEvent {
+	return &canal.RowsEvent{Table: signalTable(), Action: canal.InsertAction, Rows: [][]any{{id, signalType, data}}}
+}
+
+func newTestIncrementalSnapshot(t *testing.T) (*incrementalSnapshot, *MySQLSource, store.IStore) {
+	s, st := newTestMySQLSource(t, MysqlConfig{SignalTable: "shop.dbxgo_signal"})
+	i, err := newIncrementalSnapshot(s, s.cfg.SignalTable)
+	assert.NoError(t, err)
+	s.incremental = i
+	return i, s, st
+}
+
+// savedState Reads the progress persisted in the store
+func savedState(t *testing.T, st store.IStore) incrementalState {
+	data, err := st.Get(StoreKeyIncrementalSnapshot)
+	assert.NoError(t, err)
+	var state incrementalState
+	if len(data) > 0 {
+		assert.NoError(t, json.Unmarshal(data, &state))
+	}
+	return state
+}
+
+// drainIDs Returns the id column of every emitted snapshot event
+func drainIDs(s *MySQLSource) []any {
+	var ids []any
+	for len(s.eventDataChan) > 0 {
+		event := <-s.eventDataChan
+		if event.Row.Type == types.SnapshotEventRowType {
+			ids = append(ids, event.Row.Data["id"])
+		}
+	}
+	return ids
+}
+
+func TestIncrementalSnapshot_WindowDedupe(t *testing.T) {
+	chunk := [][]any{{int64(1), "new"}, {int64(2), "new"}, {int64(3), "new"}}
+	other := ordersTable()
+	other.Name = "customers"
+	tests := []struct {
+		name string
+		// beforeOpen Binlog changes read before the low watermark
+		beforeOpen []*canal.RowsEvent
+		// inWindow Binlog changes read between the watermarks
+		inWindow []*canal.RowsEvent
+		closeID  string
+		want     []any
+	}{
+		{
+			name:    "no concurrent changes",
+			closeID: "w-close",
+			want:    []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "row updated inside the window is dropped",
+			inWindow: []*canal.RowsEvent{{Table: ordersTable(), Action: canal.UpdateAction, Rows: [][]any{{int64(2), "new"}, {int64(2), "paid"}}}},
+			closeID:  "w-close",
+			want:     []any{int64(1), int64(3)},
+		},
+		{
+			name:     "primary key change drops both images",
+			inWindow: []*canal.RowsEvent{{Table: ordersTable(), Action: canal.UpdateAction, Rows: [][]any{{int64(1), "new"}, {int64(3), "new"}}}},
+			closeID:  "w-close",
+			want:     []any{int64(2)},
+		},
+		{
+			name:     "deleted row is dropped",
+			inWindow: []*canal.RowsEvent{{Table: ordersTable(), Action: canal.DeleteAction, Rows: [][]any{{int64(3), "new"}}}},
+			closeID:  "w-close",
+			want:     []any{int64(1), int64(2)},
+		},
+		{
+			name:       "change before the low watermark is kept",
+			beforeOpen: []*canal.RowsEvent{{Table: ordersTable(), Action: canal.UpdateAction, Rows: [][]any{{int64(1), "new"}, {int64(1), "paid"}}}},
+			closeID:    "w-close",
+			want:       []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "change of another table is kept",
+			inWindow: []*canal.RowsEvent{{Table: other, Action: canal.DeleteAction, Rows: [][]any{{int64(2), "new"}}}},
+			closeID:  "w-close",
+			want:     []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:    "foreign high watermark is ignored",
+			closeID: "other-close",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, s, _ := newTestIncrementalSnapshot(t)
+			ctx := context.Background()
+			w := &snapshotWindow{id: "w", table: ordersTable(), keys: map[string]struct{}{}, rows: chunk, done: make(chan struct{})}
+			i.window = w
+			for _, e := range tt.beforeOpen {
+				i.observe(e)
+			}
+			assert.NoError(t, i.onSignal(ctx, signalRow("w-open", signalWindowOpen, "shop.orders")))
+			for _, e := range tt.inWindow {
+				i.observe(e)
+			}
+			assert.NoError(t, i.onSignal(ctx, signalRow(tt.closeID, signalWindowClose, "shop.orders")))
+
+			assert.Equal(t, tt.want, drainIDs(s))
+			if tt.want != nil {
+				assert.Nil(t, i.window)
+				select {
+				case <-w.done:
+				default:
+					t.Fatal("closing the window must release the chunk reader")
+				}
+			}
+		})
+	}
+}
+
+func TestIncrementalSnapshot_SavesProgressAfterAck(t *testing.T) {
+	i, s, st := newTestIncrementalSnapshot(t)
+	ctx := context.Background()
+	assert.NoError(t, i.onSignal(ctx, signalRow("1", SignalExecuteSnapshot, `{"tables":["shop.orders","shop.customers"]}`)))
+	assert.Equal(t, []string{"shop.orders", "shop.customers"}, savedState(t, st).Tables)
+
+	// A chunk is emitted and the snapshot moves on before the workers delivered it
+	i.window = &snapshotWindow{id: "w", table: ordersTable(), keys: map[string]struct{}{}, open: true,
+		rows: [][]any{{int64(1), "new"}, {int64(2), "new"}}, done: make(chan struct{})}
+	assert.NoError(t, i.closeWindow(ctx, "w-close"))
+	events := []types.EventData{<-s.eventDataChan, <-s.eventDataChan}
+	assert.NoError(t, i.advance([]any{int64(2)}, false))
+	assert.Equal(t, []any{int64(2)}, i.state.LastPK)
+	assert.Nil(t, savedState(t, st).LastPK, "progress must not be saved before the chunk is delivered")
+
+	// A table queued meanwhile is saved right away, the unacknowledged progress is not
+	assert.NoError(t, i.onSignal(ctx, signalRow("2", SignalExecuteSnapshot, `{"tables":["shop.items"]}`)))
+	saved := savedState(t, st)
+	assert.Equal(t, []string{"shop.orders", "shop.customers", "shop.items"}, saved.Tables)
+	assert.Nil(t, saved.LastPK)
+
+	assert.NoError(t, s.Ack(events[0]))
+	assert.Nil(t, savedState(t, st).LastPK)
+	assert.NoError(t, s.Ack(events[1]))
+	saved = savedState(t, st)
+	assert.Equal(t, []any{float64(2)}, saved.LastPK)
+	assert.Equal(t, []string{"shop.orders", "shop.customers", "shop.items"}, saved.Tables)
+
+	// Finishing a table with nothing in flight is saved immediately
+	assert.NoError(t, i.advance(nil, true))
+	saved = savedState(t, st)
+	assert.Equal(t, []string{"shop.customers", "shop.items"}, saved.Tables)
+	assert.Nil(t, saved.LastPK)
+}
+
+func TestIncrementalSnapshot_Resume(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     string
+		wantTables []string
+		wantPK     []any
+	}{
+		{
+			name: "nothing stored",
+		},
+		{
+			name:       "integer key",
+			stored:     `{"tables":["shop.orders","shop.items"],"last_pk":[42]}`,
+			wantTables: []string{"shop.orders", "shop.items"},
+			wantPK:     []any{int64(42)},
+		},
+		{
+			name:       "unsigned key beyond int64",
+			stored:     `{"tables":["shop.orders"],"last_pk":[18446744073709551615]}`,
+			wantTables: []string{"shop.orders"},
+			wantPK:     []any{uint64(18446744073709551615)},
+		},
+		{
+			name:       "composite key",
+			stored:     `{"tables":["shop.items"],"last_pk":["eu",7]}`,
+			wantTables: []string{"shop.items"},
+			wantPK:     []any{"eu", int64(7)},
+		},
+		{
+			name:       "table not started",
+			stored:     `{"tables":["shop.orders"]}`,
+			wantTables: []string{"shop.orders"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, _, st := newTestIncrementalSnapshot(t)
+			if tt.stored != "" {
+				assert.NoError(t, st.Set(StoreKeyIncrementalSnapshot, []byte(tt.stored)))
+			}
+			assert.NoError(t, i.load())
+			assert.Equal(t, tt.wantTables, i.state.Tables)
+			assert.Equal(t, tt.wantPK, i.state.LastPK)
+			assert.Equal(t, i.state, i.saved)
+
+			// A replayed signal does not queue a resumed table twice
+			assert.NoError(t, i.onSignal(context.Background(), signalRow("1", SignalExecuteSnapshot, `{"tables":["shop.orders"]}`)))
+			assert.Equal(t, 1, countOf(i.state.Tables, "shop.orders"))
+		})
+	}
+
+	_, _, st := newTestIncrementalSnapshot(t)
+	assert.NoError(t, st.Set(StoreKeyIncrementalSnapshot, []byte("{")))
+	i, err := newIncrementalSnapshot(&MySQLSource{store: st}, "shop.dbxgo_signal")
+	assert.NoError(t, err)
+	assert.Error(t, i.load())
+}
+
+// countOf Counts the occurrences of a value
+func countOf(values []string, value string) int {
+	n := 0
+	for _, v := range values {
+		if v == value {
+			n++
+		}
+	}
+	return n
+}
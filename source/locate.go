@@ -0,0 +1,202 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chihqiang/logx"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// parseTimeOption Parses a time option, RFC3339 or "2006-01-02 15:04:05" in UTC
+// value: Option value, empty means unset
+// Returns: Parsed time, zero when unset
+func parseTimeOption(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateTime, value, time.UTC)
+}
+
+// locatePosition Finds the binlog position of the first transaction with an event at or after a time
+// The binlog files are listed with SHOW BINARY LOGS, the file holding the time is picked by the
+// timestamps of their format description events and its event headers are scanned from the start.
+// ctx: Cancels the scan
+// at: Time to start from
+// Returns: Position at a transaction boundary and possible errors
+func (s *MySQLSource) locatePosition(ctx context.Context, at time.Time) (MysqlPosition, error) {
+	files, err := s.binaryLogs()
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	end, err := s.canal.GetMasterPos()
+	if err != nil {
+		return MysqlPosition{}, fmt.Errorf("read master position error: %w", err)
+	}
+	index, err := searchFiles(files, at, func(file string) (time.Time, error) {
+		return s.fileStart(ctx, file)
+	})
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	if index < 0 {
+		logx.Warn("start time %s is before the oldest binlog file %s, starting from its beginning", at.Format(time.RFC3339), files[0])
+		index = 0
+	}
+	syncer, streamer, err := s.openSyncer(mysql.Position{Name: files[index], Pos: 4})
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	defer syncer.Close()
+	pos, err := scanForTime(func() (*replication.BinlogEvent, error) { return streamer.GetEvent(ctx) }, files[index], at, end)
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	logx.Info("MySQL source located start time %s at binlog position %s:%d", at.Format(time.RFC3339), pos.Name, pos.Pos)
+	return MysqlPosition{File: pos.Name, Pos: pos.Pos}, nil
+}
+
+// searchFiles Returns the index of the last file that starts at or before a time
+// files: Binlog files in order
+// at: Time to look for
+// start: Returns the time a file was started
+// Returns: Index, -1 when every file starts after the time
+func searchFiles(files []string, at time.Time, start func(file string) (time.Time, error)) (int, error) {
+	var searchErr error
+	// Index of the first file that starts after the time
+	after := sort.Search(len(files), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		t, err := start(files[i])
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return t.After(at)
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	return after - 1, nil
+}
+
+// scanForTime Reads events until the first one written at or after a time
+// Transactions are never split, the position returned is the boundary before the event.
+// next: Returns the next binlog event
+// file: File the events are read from
+// at: Time to look for
+// end: Current master position, the scan stops there when no event is late enough
+// Returns: Position at a transaction boundary and possible errors
+func scanForTime(next func() (*replication.BinlogEvent, error), file string, at time.Time, end mysql.Position) (mysql.Position, error) {
+	boundary := mysql.Position{Name: file, Pos: 4}
+	current := file
+	for {
+		if current == end.Name && boundary.Pos >= end.Pos {
+			return end, nil
+		}
+		e, err := next()
+		if err != nil {
+			return mysql.Position{}, fmt.Errorf("scan binlog error: %w", err)
+		}
+		switch ev := e.Event.(type) {
+		case *replication.RotateEvent:
+			current = string(ev.NextLogName)
+			// The artificial rotate at the start of a stream names the file being read
+			if e.Header.Timestamp == 0 || e.Header.LogPos == 0 {
+				continue
+			}
+			boundary = mysql.Position{Name: current, Pos: uint32(ev.Position)}
+			continue
+		case *replication.FormatDescriptionEvent, *replication.PreviousGTIDsEvent:
+			continue
+		}
+		if int64(e.Header.Timestamp) >= at.Unix() {
+			return boundary, nil
+		}
+		switch ev := e.Event.(type) {
+		case *replication.XIDEvent:
+			boundary = mysql.Position{Name: current, Pos: e.Header.LogPos}
+		case *replication.QueryEvent:
+			// Every query but BEGIN ends a transaction (DDL, or COMMIT of non-transactional tables)
+			if string(ev.Query) != "BEGIN" {
+				boundary = mysql.Position{Name: current, Pos: e.Header.LogPos}
+			}
+		}
+		// Nothing after the master position has been written yet, waiting would block forever
+		if current == end.Name && e.Header.LogPos >= end.Pos {
+			return end, nil
+		}
+	}
+}
+
+// binaryLogs Lists the binlog files of the server in order
+func (s *MySQLSource) binaryLogs() ([]string, error) {
+	rr, err := s.canal.Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, fmt.Errorf("show binary logs error: %w", err)
+	}
+	files := make([]string, 0, rr.RowNumber())
+	for i := 0; i < rr.RowNumber(); i++ {
+		name, _ := rr.GetString(i, 0)
+		files = append(files, name)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("the server has no binlog files")
+	}
+	return files, nil
+}
+
+// fileStart Reads the time a binlog file was started from its format description event
+func (s *MySQLSource) fileStart(ctx context.Context, file string) (time.Time, error) {
+	syncer, streamer, err := s.openSyncer(mysql.Position{Name: file, Pos: 4})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer syncer.Close()
+	for {
+		e, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("read binlog %s error: %w", file, err)
+		}
+		if _, ok := e.Event.(*replication.FormatDescriptionEvent); ok {
+			return time.Unix(int64(e.Header.Timestamp), 0), nil
+		}
+	}
+}
+
+// openSyncer Starts a separate replication stream used to read event headers
+func (s *MySQLSource) openSyncer(pos mysql.Position) (*replication.BinlogSyncer, *replication.BinlogStreamer, error) {
+	host, portText, err := net.SplitHostPort(s.cfg.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid address %q: %w", s.cfg.Addr, err)
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid port in address %q: %w", s.cfg.Addr, err)
+	}
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		// A server ID different from canal's, the server drops replicas that reuse an ID
+		ServerID: 1001 + rand.Uint32N(1<<30),
+		Flavor:   s.cfg.Flavor,
+		Host:     host,
+		Port:     uint16(port),
+		User:     s.cfg.User,
+		Password: s.cfg.Password,
+	})
+	streamer, err := syncer.StartSync(pos)
+	if err != nil {
+		syncer.Close()
+		return nil, nil, fmt.Errorf("start binlog stream at %s:%d error: %w", pos.Name, pos.Pos, err)
+	}
+	return syncer, streamer, nil
+}
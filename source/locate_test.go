@@ -0,0 +1,91 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeOption(t *testing.T) {
+	at, err := parseTimeOption("2026-10-15 03:00:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC), at)
+
+	at, err = parseTimeOption("2026-10-15T03:00:00+08:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 14, 19, 0, 0, 0, time.UTC), at.UTC())
+
+	at, err = parseTimeOption("")
+	assert.NoError(t, err)
+	assert.True(t, at.IsZero())
+
+	_, err = parseTimeOption("15/10/2026")
+	assert.Error(t, err)
+}
+
+func TestSearchFiles(t *testing.T) {
+	files := []string{"bin.000001", "bin.000002", "bin.000003"}
+	starts := map[string]time.Time{
+		"bin.000001": time.Unix(100, 0),
+		"bin.000002": time.Unix(200, 0),
+		"bin.000003": time.Unix(300, 0),
+	}
+	start := func(file string) (time.Time, error) { return starts[file], nil }
+	for at, want := range map[int64]int{50: -1, 100: 0, 250: 1, 300: 2, 900: 2} {
+		index, err := searchFiles(files, time.Unix(at, 0), start)
+		assert.NoError(t, err)
+		assert.Equal(t, want, index, "at %d", at)
+	}
+
+	_, err := searchFiles(files, time.Unix(250, 0), func(string) (time.Time, error) { return time.Time{}, fmt.Errorf("boom") })
+	assert.Error(t, err)
+}
+
+// eventsOf Returns a next function replaying events
+func eventsOf(events ...*replication.BinlogEvent) func() (*replication.BinlogEvent, error) {
+	return func() (*replication.BinlogEvent, error) {
+		if len(events) == 0 {
+			return nil, fmt.Errorf("no more events")
+		}
+		e := events[0]
+		events = events[1:]
+		return e, nil
+	}
+}
+
+func TestScanForTime_StopsAtTransactionBoundary(t *testing.T) {
+	events := []*replication.BinlogEvent{
+		binlogEvent(replication.ROTATE_EVENT, 0, 0, &replication.RotateEvent{Position: 4, NextLogName: []byte("bin.000001")}),
+		binlogEvent(replication.FORMAT_DESCRIPTION_EVENT, 90, 120, &replication.FormatDescriptionEvent{}),
+		binlogEvent(replication.QUERY_EVENT, 100, 200, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		binlogEvent(replication.WRITE_ROWS_EVENTv2, 100, 300, &replication.RowsEvent{}),
+		binlogEvent(replication.XID_EVENT, 100, 330, &replication.XIDEvent{}),
+		binlogEvent(replication.ROTATE_EVENT, 110, 380, &replication.RotateEvent{Position: 4, NextLogName: []byte("bin.000002")}),
+		binlogEvent(replication.QUERY_EVENT, 119, 200, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		// The transaction started before the time, it is kept whole
+		binlogEvent(replication.WRITE_ROWS_EVENTv2, 121, 300, &replication.RowsEvent{}),
+		binlogEvent(replication.XID_EVENT, 121, 330, &replication.XIDEvent{}),
+	}
+	end := mysql.Position{Name: "bin.000002", Pos: 330}
+
+	pos, err := scanForTime(eventsOf(events...), "bin.000001", time.Unix(100, 0), end)
+	assert.NoError(t, err)
+	assert.Equal(t, mysql.Position{Name: "bin.000001", Pos: 4}, pos)
+
+	pos, err = scanForTime(eventsOf(events...), "bin.000001", time.Unix(105, 0), end)
+	assert.NoError(t, err)
+	assert.Equal(t, mysql.Position{Name: "bin.000002", Pos: 4}, pos)
+
+	pos, err = scanForTime(eventsOf(events...), "bin.000001", time.Unix(120, 0), end)
+	assert.NoError(t, err)
+	assert.Equal(t, mysql.Position{Name: "bin.000002", Pos: 4}, pos)
+
+	// Nothing is late enough, the scan ends at the master position instead of waiting
+	pos, err = scanForTime(eventsOf(events...), "bin.000001", time.Unix(500, 0), end)
+	assert.NoError(t, err)
+	assert.Equal(t, end, pos)
+}
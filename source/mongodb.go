@@ -0,0 +1,429 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/dbxgo/pkg/structx"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoConfig MongoDB configuration entity
+// The change stream scope follows Database and Collection: both empty watches the whole cluster,
+// only Database watches one database, both watch one collection.
+// Table filtering follows the MySQL rules, matched against "database.collection".
+type MongoConfig struct {
+	URI string `yaml:"uri" json:"uri" mapstructure:"uri" env:"SOURCE_MONGODB_URI" envDefault:"mongodb://127.0.0.1:27017"`
+	// Database Database to watch, empty watches the whole cluster
+	Database string `yaml:"database" json:"database" mapstructure:"database" env:"SOURCE_MONGODB_DATABASE"`
+	// Collection Collection to watch, requires Database
+	Collection string `yaml:"collection" json:"collection" mapstructure:"collection" env:"SOURCE_MONGODB_COLLECTION"`
+	// FullDocument Post-image of update events: updateLookup / whenAvailable / required
+	FullDocument string `yaml:"full_document" json:"full_document" mapstructure:"full_document" env:"SOURCE_MONGODB_FULL_DOCUMENT" envDefault:"updateLookup"`
+	// PreImages Fill Old of update, replace and delete events from pre-images, the collections need
+	// changeStreamPreAndPostImages enabled
+	PreImages         bool     `yaml:"pre_images" json:"pre_images" mapstructure:"pre_images" env:"SOURCE_MONGODB_PRE_IMAGES" envDefault:"false"`
+	ExcludeTableRegex []string `yaml:"exclude_table_regex" json:"exclude_table_regex" mapstructure:"exclude_table_regex" env:"SOURCE_MONGODB_EXCLUDE_TABLE_REGEX"`
+	IncludeTableRegex []string `yaml:"include_table_regex" json:"include_table_regex" mapstructure:"include_table_regex" env:"SOURCE_MONGODB_INCLUDE_TABLE_REGEX"`
+	// BufferSize Capacity of the event channel between the change stream and the workers
+	BufferSize int `yaml:"buffer_size" json:"buffer_size" mapstructure:"buffer_size" env:"SOURCE_MONGODB_BUFFER_SIZE" envDefault:"10240"`
+	// OverflowPolicy What to do when the event channel is full: block / drop / spill
+	OverflowPolicy OverflowPolicy `yaml:"overflow_policy" json:"overflow_policy" mapstructure:"overflow_policy" env:"SOURCE_MONGODB_OVERFLOW_POLICY" envDefault:"block"`
+	// SpillDir Directory of the disk queue used by the spill policy, defaults to the system temp directory
+	SpillDir string `yaml:"spill_dir" json:"spill_dir" mapstructure:"spill_dir" env:"SOURCE_MONGODB_SPILL_DIR"`
+}
+
+// errStreamInvalidated Returned by handleChange for an invalidate event, after which the
+// change stream has to be reopened with startAfter
+var errStreamInvalidated = errors.New("change stream invalidated")
+
+// MongoPosition MongoDB change stream position
+// Used to save and restore sync positions
+type MongoPosition struct {
+	// ResumeToken Resume token of the last fully acknowledged change, raw BSON
+	ResumeToken []byte `json:"resume_token"`
+	// StartAfter ResumeToken belongs to an invalidate event, which resumeAfter rejects
+	StartAfter bool `json:"start_after,omitempty"`
+}
+
+// mongoChange Fields of a change event that are translated into an event
+type mongoChange struct {
+	OperationType string         `bson:"operationType"`
+	ClusterTime   bson.Timestamp `bson:"clusterTime"`
+	NS            struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey              bson.D `bson:"documentKey"`
+	FullDocument             bson.D `bson:"fullDocument"`
+	FullDocumentBeforeChange bson.D `bson:"fullDocumentBeforeChange"`
+	UpdateDescription        struct {
+		UpdatedFields bson.D `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+	TxnNumber *int64 `bson:"txnNumber"`
+	// LSID Logical session of a transaction, its txnNumber only counts within the session
+	LSID struct {
+		ID bson.Binary `bson:"id"`
+	} `bson:"lsid"`
+}
+
+// MongoSource MongoDB datasource specific implementation
+// Responsible for tailing a change stream and converting changes to the unified event format
+type MongoSource struct {
+	// mu Mutex used to ensure concurrency safety
+	mu sync.Mutex
+	// store Storage interface for persisting or reading offsets and states
+	store store.IStore
+	// cfg Datasource configuration information
+	cfg MongoConfig
+	// eventDataChan Event data output channel
+	eventDataChan chan types.EventData
+	// emitter Delivers events into eventDataChan according to the overflow policy
+	emitter *emitter
+	// checkpoint Tracks delivered events and persists the resume token of the lowest fully acknowledged change
+	checkpoint *Checkpointer[MongoPosition]
+	// filter Include/exclude collection filter
+	filter *tableFilter
+	// running Indicates whether the datasource is running
+	running bool
+	// cancel Stops the change stream loop started by Run
+	cancel context.CancelFunc
+	// done Closed once the change stream loop has returned
+	done chan struct{}
+	// finish Closes the event channel exactly once
+	finish sync.Once
+}
+
+// NewMongoSource Creates a MongoDB datasource instance
+// No connection is made until Run is called
+// cfg: MongoDB datasource configuration information
+// Returns: MongoSource instance that implements the ISource interface and potential errors
+func NewMongoSource(cfg MongoConfig) (*MongoSource, error) {
+	var err error
+	cfg, err = structx.MergeWithDefaults[MongoConfig](cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Collection != "" && cfg.Database == "" {
+		return nil, fmt.Errorf("mongodb collection %s requires a database", cfg.Collection)
+	}
+	filter, err := newTableFilter(cfg.IncludeTableRegex, cfg.ExcludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	source := &MongoSource{
+		cfg:    cfg,
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+	source.checkpoint = NewCheckpointer[MongoPosition](source.savePosition)
+	source.emitter, err = newEmitter(cfg.BufferSize, cfg.OverflowPolicy, cfg.SpillDir, func(event types.EventData) {
+		// A discarded event is never delivered, acknowledge it so the checkpoint is not held back
+		_ = source.checkpoint.Ack(event.Token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	source.eventDataChan = source.emitter.ch
+	return source, nil
+}
+
+// WithStore Sets the store for the MongoDB source
+func (s *MongoSource) WithStore(store store.IStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+// Run Opens the change stream and tails it
+// ctx: Context to control cancellation and timeout
+// Returns: Possible errors
+func (s *MongoSource) Run(ctx context.Context) error {
+	if s.store == nil {
+		return fmt.Errorf("store is not initialized, cannot run MongoSource")
+	}
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("it is already running")
+	}
+	s.running = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+	defer close(s.done)
+
+	client, err := mongo.Connect(options.Client().ApplyURI(s.cfg.URI))
+	if err != nil {
+		return fmt.Errorf("connect error: %w", err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	pos := s.loadPosition()
+	for {
+		pos, err = s.tail(ctx, client, pos)
+		if !errors.Is(err, errStreamInvalidated) {
+			return err
+		}
+		// The watched collection or database was dropped or renamed, watch on from after the event
+		logx.Warn("MongoDB change stream invalidated, reopening it after the invalidate event")
+	}
+}
+
+// tail Opens the change stream at a position and translates its changes
+// client: Connected client
+// pos: Position to resume from, an empty token starts at the current time
+// Returns: Position of the invalidate event with errStreamInvalidated, otherwise the error that ended the stream
+func (s *MongoSource) tail(ctx context.Context, client *mongo.Client, pos MongoPosition) (MongoPosition, error) {
+	stream, err := s.watch(ctx, client, pos)
+	if err != nil {
+		return pos, fmt.Errorf("open change stream error: %w", err)
+	}
+	defer func() { _ = stream.Close(context.Background()) }()
+	for stream.Next(ctx) {
+		pos = MongoPosition{ResumeToken: append([]byte(nil), stream.ResumeToken()...)}
+		err := s.handleChange(ctx, stream.Current)
+		if errors.Is(err, errStreamInvalidated) {
+			pos.StartAfter = true
+		} else if err != nil {
+			return pos, err
+		}
+		// The token is committed once every event emitted so far is acknowledged
+		if markErr := s.checkpoint.Mark(pos); markErr != nil {
+			return pos, markErr
+		}
+		if err != nil {
+			return pos, err
+		}
+	}
+	if ctx.Err() != nil {
+		return pos, ctx.Err()
+	}
+	return pos, fmt.Errorf("change stream error: %w", stream.Err())
+}
+
+// watch Opens the change stream at the configured scope, resuming after pos
+// client: Connected client
+// pos: Position to resume from, an empty token starts at the current time
+// Returns: Change stream and possible errors
+func (s *MongoSource) watch(ctx context.Context, client *mongo.Client, pos MongoPosition) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream()
+	if s.cfg.FullDocument != "" {
+		opts.SetFullDocument(options.FullDocument(s.cfg.FullDocument))
+	}
+	if s.cfg.PreImages {
+		opts.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	if token := bson.Raw(pos.ResumeToken); len(token) > 0 {
+		logx.Info("MongoDB source resuming after token: %s", token.String())
+		if pos.StartAfter {
+			opts.SetStartAfter(token)
+		} else {
+			opts.SetResumeAfter(token)
+		}
+	}
+	pipeline := mongo.Pipeline{}
+	switch {
+	case s.cfg.Collection != "":
+		return client.Database(s.cfg.Database).Collection(s.cfg.Collection).Watch(ctx, pipeline, opts)
+	case s.cfg.Database != "":
+		return client.Database(s.cfg.Database).Watch(ctx, pipeline, opts)
+	default:
+		return client.Watch(ctx, pipeline, opts)
+	}
+}
+
+// GetChanEventData Returns event channel for external reading
+func (s *MongoSource) GetChanEventData() <-chan types.EventData {
+	return s.eventDataChan
+}
+
+// Ack Acknowledges a delivered event so that its resume token can be checkpointed
+// event: Event that has been sent downstream
+// Returns: Possible errors while saving the position
+func (s *MongoSource) Ack(event types.EventData) error {
+	return s.checkpoint.Ack(event.Token)
+}
+
+// Close Stops the change stream and releases resources
+// The emitter is released even if Run was never called or has already returned
+// Returns: Possible errors
+func (s *MongoSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Only a running source has a change stream loop to stop
+	if s.running {
+		s.cancel()
+		<-s.done
+	}
+	s.closeChannel()
+	s.running = false
+	return nil
+}
+
+// closeChannel Stops the spill queue and closes the event channel, only the first call has an effect
+func (s *MongoSource) closeChannel() {
+	s.finish.Do(func() {
+		if err := s.emitter.close(); err != nil {
+			logx.Warn("failed to remove spill queue: %v", err)
+		}
+		if dropped := s.emitter.Dropped(); dropped > 0 {
+			logx.Warn("MongoDB source discarded %d events because the event channel was full", dropped)
+		}
+		close(s.eventDataChan)
+	})
+}
+
+// handleChange Translates one change event
+// insert, update, replace and delete are emitted, other operations are skipped. An invalidate
+// event ends the stream, errStreamInvalidated is returned for it.
+// raw: Change event document
+// Returns: Possible errors
+func (s *MongoSource) handleChange(ctx context.Context, raw bson.Raw) error {
+	var change mongoChange
+	if err := bson.Unmarshal(raw, &change); err != nil {
+		return fmt.Errorf("decode change event error: %w", err)
+	}
+	event := types.EventData{Time: time.Now()}
+	switch change.OperationType {
+	case "insert":
+		event.Row.Type = types.InsertEventRowType
+		event.Row.Data = mongoDocument(change.FullDocument)
+	case "update", "replace":
+		event.Row.Type = types.UpdateEventRowType
+		if change.FullDocument != nil {
+			event.Row.Data = mongoDocument(change.FullDocument)
+		} else {
+			// Without a post-image only the key and the changed fields are known
+			event.Row.Data = mongoDocument(append(append(bson.D{}, change.DocumentKey...), change.UpdateDescription.UpdatedFields...))
+		}
+		if change.FullDocumentBeforeChange != nil {
+			event.Row.Old = mongoDocument(change.FullDocumentBeforeChange)
+		}
+	case "delete":
+		event.Row.Type = types.DeleteEventRowType
+		if change.FullDocumentBeforeChange != nil {
+			event.Row.Data = mongoDocument(change.FullDocumentBeforeChange)
+		} else {
+			event.Row.Data = mongoDocument(change.DocumentKey)
+		}
+	case "invalidate":
+		return fmt.Errorf("%w at %d", errStreamInvalidated, change.ClusterTime.T)
+	default:
+		return nil
+	}
+	if !s.filter.Match(change.NS.DB, change.NS.Coll) {
+		return nil
+	}
+	event.Row.Time = int64(change.ClusterTime.T)
+	event.Row.Database = change.NS.DB
+	event.Row.Table = change.NS.Coll
+	event.Row.Key = mongoDocument(change.DocumentKey)
+	event.Row.PrimaryKey = make([]string, len(change.DocumentKey))
+	for i, e := range change.DocumentKey {
+		event.Row.PrimaryKey[i] = e.Key
+	}
+	if key, err := json.Marshal(event.Row.Key); err == nil {
+		event.PartitionKey = string(key)
+	}
+	if change.TxnNumber != nil {
+		event.TxID = mongoTxID(change.LSID.ID, *change.TxnNumber)
+	}
+	event.Token = s.checkpoint.Track()
+	return s.emitter.emit(ctx, event)
+}
+
+// mongoTxID Identifies a transaction by its session id and transaction number
+// Transaction numbers start over in every session, so they are only unique together with the session
+// session: Id of the logical session, a UUID
+// txnNumber: Transaction number within the session
+// Returns: "<session uuid>:<txnNumber>"
+func mongoTxID(session bson.Binary, txnNumber int64) string {
+	id := hex.EncodeToString(session.Data)
+	if session.Subtype == bson.TypeBinaryUUID && len(session.Data) == 16 {
+		id = fmt.Sprintf("%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:32])
+	}
+	return id + ":" + strconv.FormatInt(txnNumber, 10)
+}
+
+// mongoDocument Converts a BSON document to a column name to value map
+// doc: BSON document
+// Returns: Mapping of field names to values, nil for a missing document
+func mongoDocument(doc bson.D) map[string]any {
+	if doc == nil {
+		return nil
+	}
+	data := make(map[string]any, len(doc))
+	for _, e := range doc {
+		data[e.Key] = mongoValue(e.Value)
+	}
+	return data
+}
+
+// mongoValue Converts a BSON value to the representation used by the other sources
+// ObjectIDs are hex strings, dates RFC 3339 strings, Decimal128 exact strings and binary data base64
+func mongoValue(v any) any {
+	switch v := v.(type) {
+	case bson.D:
+		return mongoDocument(v)
+	case bson.A:
+		values := make([]any, len(v))
+		for i := range v {
+			values[i] = mongoValue(v[i])
+		}
+		return values
+	case bson.ObjectID:
+		return v.Hex()
+	case bson.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case bson.Decimal128:
+		return v.String()
+	case bson.Binary:
+		return base64.StdEncoding.EncodeToString(v.Data)
+	case bson.Timestamp:
+		return int64(v.T)
+	case int32:
+		return int64(v)
+	case nil, bool, int64, float64, string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// loadPosition Loads the last saved resume token
+// Returns: Saved position, with an empty token when nothing is stored
+func (s *MongoSource) loadPosition() MongoPosition {
+	positionBytes, err := s.store.Get(StoreKeyPosition)
+	if err != nil || len(positionBytes) == 0 {
+		return MongoPosition{}
+	}
+	var pos MongoPosition
+	if err := json.Unmarshal(positionBytes, &pos); err != nil {
+		return MongoPosition{}
+	}
+	return pos
+}
+
+// savePosition Saves the acknowledged resume token
+// Calls are serialized by the checkpointer, so no additional locking is needed here
+// pos: Sync position to save
+// Returns: Possible errors
+func (s *MongoSource) savePosition(pos MongoPosition) error {
+	positionBytes, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("marshal position error: %w", err)
+	}
+	return s.store.Set(StoreKeyPosition, positionBytes)
+}
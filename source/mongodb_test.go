@@ -0,0 +1,175 @@
+package source
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newTestMongoSource(t *testing.T) *MongoSource {
+	s, err := NewMongoSource(MongoConfig{ExcludeTableRegex: []string{`shop\.tmp_.*`}, BufferSize: 16})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = s.emitter.close() })
+	return s
+}
+
+func marshalChange(t *testing.T, change bson.D) bson.Raw {
+	raw, err := bson.Marshal(change)
+	assert.NoError(t, err)
+	return raw
+}
+
+func TestMongoSource_UpdateWithPreImage(t *testing.T) {
+	s := newTestMongoSource(t)
+	id := bson.NewObjectID()
+	createdAt := time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC)
+	price, _ := bson.ParseDecimal128("12.30")
+	raw := marshalChange(t, bson.D{
+		{Key: "operationType", Value: "update"},
+		{Key: "clusterTime", Value: bson.Timestamp{T: 1760497200, I: 1}},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "orders"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+		{Key: "fullDocument", Value: bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: "paid"},
+			{Key: "price", Value: price},
+			{Key: "qty", Value: int32(2)},
+			{Key: "created_at", Value: bson.NewDateTimeFromTime(createdAt)},
+			{Key: "tags", Value: bson.A{"a", bson.D{{Key: "b", Value: true}}}},
+		}},
+		{Key: "fullDocumentBeforeChange", Value: bson.D{{Key: "_id", Value: id}, {Key: "status", Value: "new"}}},
+		{Key: "txnNumber", Value: int64(7)},
+		{Key: "lsid", Value: bson.D{
+			{Key: "id", Value: bson.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}}},
+			{Key: "uid", Value: bson.Binary{Data: []byte{0x01}}},
+		}},
+	})
+	assert.NoError(t, s.handleChange(context.Background(), raw))
+
+	event := <-s.eventDataChan
+	assert.Equal(t, types.UpdateEventRowType, event.Row.Type)
+	assert.Equal(t, "shop", event.Row.Database)
+	assert.Equal(t, "orders", event.Row.Table)
+	assert.Equal(t, int64(1760497200), event.Row.Time)
+	assert.Equal(t, []string{"_id"}, event.Row.PrimaryKey)
+	assert.Equal(t, map[string]any{"_id": id.Hex()}, event.Row.Key)
+	assert.Equal(t, "paid", event.Row.Data["status"])
+	assert.Equal(t, "12.30", event.Row.Data["price"])
+	assert.Equal(t, int64(2), event.Row.Data["qty"])
+	assert.Equal(t, "2026-10-15T03:00:00Z", event.Row.Data["created_at"])
+	assert.Equal(t, []any{"a", map[string]any{"b": true}}, event.Row.Data["tags"])
+	assert.Equal(t, "new", event.Row.Old["status"])
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:7", event.TxID)
+	assert.NotZero(t, event.Token)
+}
+
+func TestMongoSource_DeleteWithoutPreImageUsesKey(t *testing.T) {
+	s := newTestMongoSource(t)
+	raw := marshalChange(t, bson.D{
+		{Key: "operationType", Value: "delete"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "orders"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: "order-1"}}},
+	})
+	assert.NoError(t, s.handleChange(context.Background(), raw))
+
+	event := <-s.eventDataChan
+	assert.Equal(t, types.DeleteEventRowType, event.Row.Type)
+	assert.Equal(t, map[string]any{"_id": "order-1"}, event.Row.Data)
+	assert.Nil(t, event.Row.Old)
+}
+
+func TestMongoSource_SkipsFilteredAndUnknownOperations(t *testing.T) {
+	s := newTestMongoSource(t)
+	assert.NoError(t, s.handleChange(context.Background(), marshalChange(t, bson.D{
+		{Key: "operationType", Value: "insert"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "tmp_orders"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: 1}}},
+		{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: 1}}},
+	})))
+	assert.NoError(t, s.handleChange(context.Background(), marshalChange(t, bson.D{
+		{Key: "operationType", Value: "drop"},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "shop"}, {Key: "coll", Value: "orders"}}},
+	})))
+	assert.Len(t, s.eventDataChan, 0)
+
+	err := s.handleChange(context.Background(), marshalChange(t, bson.D{{Key: "operationType", Value: "invalidate"}}))
+	assert.ErrorIs(t, err, errStreamInvalidated)
+}
+
+func TestMongoSource_Position(t *testing.T) {
+	s := newTestMongoSource(t)
+	st, err := store.NewFileStore(store.FileConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	s.WithStore(st)
+	assert.Equal(t, MongoPosition{}, s.loadPosition())
+
+	token, err := bson.Marshal(bson.D{{Key: "_data", Value: "8266F0A1B2000000012B"}})
+	assert.NoError(t, err)
+	// The token of an invalidate event is resumed with startAfter, also after a restart
+	for _, pos := range []MongoPosition{{ResumeToken: token}, {ResumeToken: token, StartAfter: true}} {
+		assert.NoError(t, s.savePosition(pos))
+		assert.Equal(t, pos, s.loadPosition())
+	}
+}
+
+func TestMongoTxID(t *testing.T) {
+	a := bson.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}}
+	b := bson.Binary{Subtype: bson.TypeBinaryUUID, Data: []byte{0x9b, 0x2c, 0x01, 0x5e, 0x0d, 0x4f, 0x4a, 0x7e, 0x8c, 0x21, 0x55, 0x10, 0x6f, 0xe3, 0x77, 0x0a}}
+	tests := []struct {
+		name    string
+		session bson.Binary
+		txn     int64
+		want    string
+	}{
+		{name: "uuid session", session: a, txn: 1, want: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1"},
+		{name: "same number in another session", session: b, txn: 1, want: "9b2c015e-0d4f-4a7e-8c21-55106fe3770a:1"},
+		{name: "non uuid session id", session: bson.Binary{Data: []byte{0xab, 0xcd}}, txn: 42, want: "abcd:42"},
+		{name: "missing session", txn: 3, want: ":3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mongoTxID(tt.session, tt.txn))
+		})
+	}
+}
+
+func TestMongoSource_CloseReleasesEmitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+	}{
+		{name: "never run or run returned", running: false},
+		{name: "running", running: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewMongoSource(MongoConfig{BufferSize: 1, OverflowPolicy: OverflowPolicySpill, SpillDir: dir})
+			assert.NoError(t, err)
+			if tt.running {
+				// Run has returned, its loop is done
+				s.running = true
+				s.cancel = func() {}
+				close(s.done)
+			}
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, s.emitter.emit(context.Background(), types.EventData{Token: uint64(i + 1)}))
+			}
+
+			assert.NoError(t, s.Close())
+			assert.NoError(t, s.Close())
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Empty(t, entries, "the spill file must be removed")
+			for range s.eventDataChan {
+			}
+			assert.False(t, s.running)
+		})
+	}
+}
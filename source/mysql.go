@@ -3,8 +3,9 @@ package source
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/chihqiang/dbxgo/pkg/cmdx"
+	"github.com/chihqiang/dbxgo/pkg/structx"
 	"github.com/chihqiang/dbxgo/store"
 	"github.com/chihqiang/dbxgo/types"
 	"github.com/chihqiang/logx"
@@ -12,7 +13,8 @@ import (
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
-	"strconv"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -40,6 +42,45 @@ type MysqlConfig struct {
 	Password          string   `yaml:"password" json:"password" mapstructure:"password" env:"SOURCE_MYSQL_PASSWORD" envDefault:""`
 	ExcludeTableRegex []string `yaml:"exclude_table_regex" json:"exclude_table_regex" mapstructure:"exclude_table_regex" env:"SOURCE_MYSQL_EXCLUDE_TABLE_REGEX"`
 	IncludeTableRegex []string `yaml:"include_table_regex" json:"include_table_regex" mapstructure:"include_table_regex" env:"SOURCE_MYSQL_INCLUDE_TABLE_REGEX"`
+	// Flavor Server flavor, decides the GTID format: mysql / mariadb
+	Flavor string `yaml:"flavor" json:"flavor" mapstructure:"flavor" env:"SOURCE_MYSQL_FLAVOR" envDefault:"mysql"`
+	// DisableGTID Always resume from binlog file/pos even if the server has GTIDs enabled
+	DisableGTID bool `yaml:"disable_gtid" json:"disable_gtid" mapstructure:"disable_gtid" env:"SOURCE_MYSQL_DISABLE_GTID" envDefault:"false"`
+	// BufferSize Capacity of the event channel between the binlog reader and the workers
+	BufferSize int `yaml:"buffer_size" json:"buffer_size" mapstructure:"buffer_size" env:"SOURCE_MYSQL_BUFFER_SIZE" envDefault:"10240"`
+	// OverflowPolicy What to do when the event channel is full: block / drop / spill
+	OverflowPolicy OverflowPolicy `yaml:"overflow_policy" json:"overflow_policy" mapstructure:"overflow_policy" env:"SOURCE_MYSQL_OVERFLOW_POLICY" envDefault:"block"`
+	// SpillDir Directory of the disk queue used by the spill policy, defaults to the system temp directory
+	SpillDir string `yaml:"spill_dir" json:"spill_dir" mapstructure:"spill_dir" env:"SOURCE_MYSQL_SPILL_DIR"`
+	// SnapshotMode Whether existing rows are read before streaming: never / initial (only without a checkpoint)
+	SnapshotMode SnapshotMode `yaml:"snapshot_mode" json:"snapshot_mode" mapstructure:"snapshot_mode" env:"SOURCE_MYSQL_SNAPSHOT_MODE" envDefault:"never"`
+	// SignalTable Table watched for incremental snapshot signals, as "database.table", empty disables them
+	SignalTable string `yaml:"signal_table" json:"signal_table" mapstructure:"signal_table" env:"SOURCE_MYSQL_SIGNAL_TABLE"`
+	// ColumnMetadata Include the column descriptors (name, SQL type, unsigned, nullable) in every row event
+	ColumnMetadata bool `yaml:"column_metadata" json:"column_metadata" mapstructure:"column_metadata" env:"SOURCE_MYSQL_COLUMN_METADATA" envDefault:"false"`
+	// SnapshotChunkSize Number of rows read per SELECT during a snapshot
+	SnapshotChunkSize int `yaml:"snapshot_chunk_size" json:"snapshot_chunk_size" mapstructure:"snapshot_chunk_size" env:"SOURCE_MYSQL_SNAPSHOT_CHUNK_SIZE" envDefault:"1024"`
+	// DecimalMode Representation of DECIMAL columns: string (exact) / float
+	DecimalMode DecimalMode `yaml:"decimal_mode" json:"decimal_mode" mapstructure:"decimal_mode" env:"SOURCE_MYSQL_DECIMAL_MODE" envDefault:"string"`
+	// BinaryMode Encoding of BINARY, VARBINARY, BLOB and spatial columns: base64 / hex
+	BinaryMode BinaryMode `yaml:"binary_mode" json:"binary_mode" mapstructure:"binary_mode" env:"SOURCE_MYSQL_BINARY_MODE" envDefault:"base64"`
+	// JSONMode Representation of JSON columns: object (nested) / string
+	JSONMode JSONMode `yaml:"json_mode" json:"json_mode" mapstructure:"json_mode" env:"SOURCE_MYSQL_JSON_MODE" envDefault:"object"`
+	// BigintMode Representation of BIGINT columns: number / string
+	BigintMode BigintMode `yaml:"bigint_mode" json:"bigint_mode" mapstructure:"bigint_mode" env:"SOURCE_MYSQL_BIGINT_MODE" envDefault:"number"`
+	// TimeZone Zone TIMESTAMP columns are rendered in, DATETIME columns are wall-clock values and kept as is
+	TimeZone string `yaml:"time_zone" json:"time_zone" mapstructure:"time_zone" env:"SOURCE_MYSQL_TIME_ZONE" envDefault:"UTC"`
+	// TransactionMarkers Emit begin/commit events around the rows of every transaction
+	TransactionMarkers bool `yaml:"transaction_markers" json:"transaction_markers" mapstructure:"transaction_markers" env:"SOURCE_MYSQL_TRANSACTION_MARKERS" envDefault:"false"`
+	// StartTime Start from the first transaction written at or after this time, RFC3339 or "2006-01-02 15:04:05" (UTC)
+	// It replaces a checkpoint that was not reached from the same start time
+	StartTime string `yaml:"start_time" json:"start_time" mapstructure:"start_time" env:"SOURCE_MYSQL_START_TIME"`
+	// StopPosition Stop before the first transaction starting at or after this "file:pos", empty streams forever
+	StopPosition string `yaml:"stop_position" json:"stop_position" mapstructure:"stop_position" env:"SOURCE_MYSQL_STOP_POSITION"`
+	// StopGTID Stop once this GTID set has been executed, the source must stream in GTID mode
+	StopGTID string `yaml:"stop_gtid" json:"stop_gtid" mapstructure:"stop_gtid" env:"SOURCE_MYSQL_STOP_GTID"`
+	// StopTime Stop before the first transaction written at or after this time, same formats as StartTime
+	StopTime string `yaml:"stop_time" json:"stop_time" mapstructure:"stop_time" env:"SOURCE_MYSQL_STOP_TIME"`
 }
 
 // MySQLSource MySQL datasource specific implementation
@@ -53,12 +94,50 @@ type MySQLSource struct {
 	store store.IStore
 	// canal MySQL binlog parser instance
 	canal *canal.Canal
+	// stream Locates and starts the binlog stream, the canal outside of tests
+	stream binlogStream
 	// cfg Datasource configuration information
 	cfg MysqlConfig
 	// eventDataChan Event data output channel
 	eventDataChan chan types.EventData
+	// emitter Delivers events into eventDataChan according to the overflow policy
+	emitter *emitter
+	// checkpoint Tracks delivered events and persists the lowest fully acknowledged position
+	checkpoint *Checkpointer[MysqlPosition]
 	// running Indicates whether the datasource is running
 	running bool
+	// filter Include/exclude table filter, applied to DDL events
+	filter *tableFilter
+	// incremental Signal-triggered incremental snapshot, nil when no signal table is configured
+	incremental *incrementalSnapshot
+	// converter Converts raw column values into their event representation
+	converter *valueConverter
+	// nullable Cached column nullability per "database.table"
+	nullable map[string]map[string]bool
+	// pendingDDL Tables reported by OnTableChanged, waiting for the OnDDL call of the same statement
+	pendingDDL []tableRef
+	// tx Binlog transaction the current events belong to
+	tx transaction
+	// startTime Parsed StartTime, zero when unset
+	startTime time.Time
+	// stop Where a bounded source stops streaming
+	stop stopBound
+	// finish Closes the event channel exactly once
+	finish sync.Once
+}
+
+// binlogStream Reads the master position and starts streaming from a checkpoint, implemented by canal
+type binlogStream interface {
+	GetMasterPos() (mysql.Position, error)
+	GetMasterGTIDSet() (mysql.GTIDSet, error)
+	StartFromGTID(set mysql.GTIDSet) error
+	RunFrom(pos mysql.Position) error
+}
+
+// tableRef Identifies a table by database and name
+type tableRef struct {
+	database string
+	table    string
 }
 
 // MysqlPosition MySQL binlog position structure
@@ -68,12 +147,23 @@ type MysqlPosition struct {
 	File string `json:"file"`
 	// Pos offset position in the binlog file
 	Pos uint32 `json:"pos"`
+	// GTID executed GTID set at this position, empty when the server has GTIDs disabled
+	GTID string `json:"gtid,omitempty"`
+	// Flavor flavor the GTID set was recorded with: mysql / mariadb
+	Flavor string `json:"flavor,omitempty"`
+	// StartTime start_time option the position descends from, a different option locates the start again
+	StartTime string `json:"start_time,omitempty"`
 }
 
 // NewMySQLSource Creates a MySQL datasource instance
 // cfg: MySQL datasource configuration information
 // Returns: MySQLSource instance that implements the ISource interface and potential errors
 func NewMySQLSource(cfg MysqlConfig) (ISource, error) {
+	var err error
+	cfg, err = structx.MergeWithDefaults[MysqlConfig](cfg)
+	if err != nil {
+		return nil, err
+	}
 	if len(cfg.ExcludeTableRegex) == 0 {
 		cfg.ExcludeTableRegex = DefaultMysqlExcludeTableRegex
 	}
@@ -83,17 +173,58 @@ func NewMySQLSource(cfg MysqlConfig) (ISource, error) {
 	cc.Addr = cfg.Addr
 	cc.User = cfg.User
 	cc.Password = cfg.Password
-	if !cmdx.CommandExists("mysqldump") {
-		cc.Dump.ExecutionPath = ""
-	}
+	cc.Flavor = cfg.Flavor
+	// Existing rows are read by the built-in snapshot, canal never shells out to mysqldump
+	cc.Dump.ExecutionPath = ""
+	// TIMESTAMP values are decoded in UTC and rendered in the configured zone by the converter
+	cc.TimestampStringLocation = time.UTC
 	cc.ExcludeTableRegex = cfg.ExcludeTableRegex
 	if len(cfg.IncludeTableRegex) > 0 {
 		cc.IncludeTableRegex = cfg.IncludeTableRegex
+		// The signal table must reach OnRow even when it is not part of the captured tables
+		if cfg.SignalTable != "" {
+			cc.IncludeTableRegex = append(append([]string{}, cfg.IncludeTableRegex...), "^"+regexp.QuoteMeta(cfg.SignalTable)+"$")
+		}
+	}
+	filter, err := newTableFilter(cfg.IncludeTableRegex, cfg.ExcludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	converter, err := newValueConverter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	startTime, err := parseTimeOption(cfg.StartTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_time: %w", err)
+	}
+	stop, err := parseStopBound(cfg)
+	if err != nil {
+		return nil, err
 	}
 	// Create MySQLSource instance
 	source := &MySQLSource{
-		cfg:           cfg,
-		eventDataChan: make(chan types.EventData, 10240), // Event channel with buffer size 10240
+		cfg:       cfg,
+		filter:    filter,
+		converter: converter,
+		nullable:  make(map[string]map[string]bool),
+		startTime: startTime,
+		stop:      stop,
+	}
+	source.checkpoint = NewCheckpointer[MysqlPosition](source.savePosition)
+	source.emitter, err = newEmitter(cfg.BufferSize, cfg.OverflowPolicy, cfg.SpillDir, func(event types.EventData) {
+		// A discarded event is never delivered, acknowledge it so the checkpoint is not held back
+		_ = source.checkpoint.Ack(event.Token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	source.eventDataChan = source.emitter.ch
+	if cfg.SignalTable != "" {
+		source.incremental, err = newIncrementalSnapshot(source, cfg.SignalTable)
+		if err != nil {
+			return nil, err
+		}
 	}
 	// Create canal instance
 	c, err := canal.NewCanal(cc)
@@ -103,6 +234,7 @@ func NewMySQLSource(cfg MysqlConfig) (ISource, error) {
 
 	// Save canal instance and set event handler
 	source.canal = c
+	source.stream = c
 	source.canal.SetEventHandler(source)
 	return source, nil
 }
@@ -130,28 +262,61 @@ func (s *MySQLSource) Run(ctx context.Context) error {
 	s.running = true
 	s.mu.Unlock()
 	// Load last saved sync position
-	startPos := s.loadPosition()
+	startPos, stored := s.loadPosition()
 	// Create a channel to receive canal exit notifications
 	done := make(chan error, 1)
 
 	// Start canal listener in background goroutine
 	go func() {
-		// Use RunFrom method to start syncing binlog from the specified position
-		err := s.canal.RunFrom(startPos)
-		done <- err
+		// A start time overrides checkpoints that were not reached from it, and replaces the snapshot
+		if !s.startTime.IsZero() && (!stored || startPos.StartTime != s.cfg.StartTime) {
+			pos, err := s.locatePosition(ctx, s.startTime)
+			if err != nil {
+				done <- fmt.Errorf("locate start time error: %w", err)
+				return
+			}
+			startPos, stored = pos, true
+		}
+		// Without a checkpoint, existing rows are read first and streaming continues from the snapshot position
+		if !stored && s.cfg.SnapshotMode == SnapshotModeInitial {
+			pos, err := s.snapshot(ctx)
+			if err != nil {
+				done <- fmt.Errorf("snapshot error: %w", err)
+				return
+			}
+			startPos = pos
+		}
+		if s.incremental != nil {
+			if err := s.incremental.load(); err != nil {
+				done <- err
+				return
+			}
+			go s.incremental.run(ctx)
+		}
+		done <- s.startCanal(startPos)
 	}()
 
 	// Wait for context cancellation or canal error
 	select {
 	case <-ctx.Done():
-		// Context cancelled, stop canal
+		// Context cancelled, stop canal and wait until nothing sends to the emitter anymore
 		s.canal.Close()
+		<-done
+		_ = s.Close()
 		return ctx.Err()
 	case err := <-done:
-		// Canal error, update running state
-		s.mu.Lock()
-		s.running = false
-		s.mu.Unlock()
+		if errors.Is(err, errStopBound) {
+			// Bounded run: hand over what is still spilled and let the workers drain the channel
+			if err := s.emitter.flush(ctx); err != nil {
+				_ = s.Close()
+				return err
+			}
+			logx.Info("MySQL source reached its stop bound at %s:%d", s.canal.SyncedPosition().Name, s.canal.SyncedPosition().Pos)
+			s.closeChannel()
+			return nil
+		}
+		// Canal error, release the canal and the spill queue, a restart creates a new source
+		_ = s.Close()
 		return fmt.Errorf("canal operation error: %w", err)
 	}
 }
@@ -162,209 +327,395 @@ func (s *MySQLSource) GetChanEventData() <-chan types.EventData {
 	return s.eventDataChan
 }
 
+// Ack Acknowledges a delivered event so that its position can be checkpointed
+// event: Event that has been sent downstream
+// Returns: Possible errors while saving the position
+func (s *MySQLSource) Ack(event types.EventData) error {
+	return s.checkpoint.Ack(event.Token)
+}
+
 // Close Closes the datasource and releases resources
+// The emitter is released even if Run was never called or has already returned
 // Returns: Possible errors
 func (s *MySQLSource) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// If already stopped, return directly
-	if !s.running {
-		return nil
-	}
-
-	// Close canal instance
-	if s.canal != nil {
+	// Close canal instance, only a running one has a stream to stop
+	if s.running && s.canal != nil {
 		s.canal.Close()
 	}
 
-	// Close event channel
-	close(s.eventDataChan)
+	s.closeChannel()
 	s.running = false
 	return nil
 }
 
+// closeChannel Stops the spill queue and closes the event channel, only the first call has an effect
+// A bounded run closes the channel when it reaches its stop bound, Close does it otherwise
+func (s *MySQLSource) closeChannel() {
+	s.finish.Do(func() {
+		// Stop the spill queue before closing the channel it feeds
+		if err := s.emitter.close(); err != nil {
+			logx.Warn("failed to remove spill queue: %v", err)
+		}
+		if dropped := s.emitter.Dropped(); dropped > 0 {
+			logx.Warn("MySQL source discarded %d events because the event channel was full", dropped)
+		}
+		// Close event channel
+		close(s.eventDataChan)
+	})
+}
+
 // OnRow Handles row change events (implements canal.EventHandler interface)
 // e: Row change event object
 // Returns: Possible errors
 func (s *MySQLSource) OnRow(rowsEvent *canal.RowsEvent) error {
-	// Get current timestamp (milliseconds)
+	if s.incremental != nil {
+		// Signal rows drive the incremental snapshot and are never sent downstream
+		if s.isSignalTable(rowsEvent.Table.Schema, rowsEvent.Table.Name) {
+			return s.incremental.onSignal(s.canal.Ctx(), rowsEvent)
+		}
+		s.incremental.observe(rowsEvent)
+	}
+	if err := s.beginTransaction(rowsEvent.Header); err != nil {
+		return err
+	}
 	// Process each row of data
 	for i := 0; i < len(rowsEvent.Rows); i++ {
-		row := rowsEvent.Rows[i]
-		var event types.EventData
-		event.Time = time.Now()
-		event.Pos = int64(rowsEvent.Header.LogPos)
-		event.ServerID = int64(rowsEvent.Header.ServerID)
 		// Fill in event basic information
-		event.Row.Time = int64(rowsEvent.Header.Timestamp)
-		event.Row.Database = rowsEvent.Table.Schema
-		event.Row.Table = rowsEvent.Table.Name
-		// Handle different event types based on action
-		switch rowsEvent.Action {
-		case canal.InsertAction:
-			event.Row.Type = types.InsertEventRowType
-			event.Row.Data = s.rowToMap(row, rowsEvent.Table)
-		case canal.DeleteAction:
-			event.Row.Type = types.DeleteEventRowType
-			event.Row.Data = s.rowToMap(row, rowsEvent.Table)
-		case canal.UpdateAction:
-			event.Row.Type = types.UpdateEventRowType
-			oldRow := row
-			// Update action has two rows: old data and new data
-			if i+1 < len(rowsEvent.Rows) {
-				newRow := rowsEvent.Rows[i+1]
-				event.Row.Data = s.rowToMap(newRow, rowsEvent.Table)
-				event.Row.Old = s.rowToMap(oldRow, rowsEvent.Table)
-				i++ // Skip the next row (new data)
-			} else {
-				event.Row.Data = s.rowToMap(row, rowsEvent.Table)
-			}
-		default:
-			event.Row.Type = types.EventRowType(rowsEvent.Action)
-			event.Row.Data = s.rowToMap(row, rowsEvent.Table)
+		event := s.newEvent(rowsEvent.Header, rowsEvent.Table.Schema, rowsEvent.Table.Name)
+		event.TxSeq = s.tx.next()
+		i = fillRow(&event, rowsEvent, i, s.converter)
+		s.fillMetadata(&event, rowsEvent.Table)
+		// Blocking here applies backpressure to canal instead of losing the row
+		if err := s.emitter.emit(s.canal.Ctx(), event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillRow Fills the type, data and old image of an event from the row at index i of a rows event
+// event: Event with the header information filled in
+// rowsEvent: Row change event object
+// i: Index of the row
+// converter: Converts raw column values
+// Returns: Index of the last row consumed, an update consumes its before and after images
+func fillRow(event *types.EventData, rowsEvent *canal.RowsEvent, i int, converter *valueConverter) int {
+	row := rowsEvent.Rows[i]
+	// Handle different event types based on action
+	switch rowsEvent.Action {
+	case canal.InsertAction:
+		event.Row.Type = types.InsertEventRowType
+		event.Row.Data = converter.row(row, rowsEvent.Table)
+	case canal.DeleteAction:
+		event.Row.Type = types.DeleteEventRowType
+		event.Row.Data = converter.row(row, rowsEvent.Table)
+	case canal.UpdateAction:
+		event.Row.Type = types.UpdateEventRowType
+		oldRow := row
+		// Update action has two rows: old data and new data
+		if i+1 < len(rowsEvent.Rows) {
+			newRow := rowsEvent.Rows[i+1]
+			event.Row.Data = converter.row(newRow, rowsEvent.Table)
+			event.Row.Old = converter.row(oldRow, rowsEvent.Table)
+			i++ // Skip the next row (new data)
+		} else {
+			event.Row.Data = converter.row(row, rowsEvent.Table)
+		}
+	default:
+		event.Row.Type = types.EventRowType(rowsEvent.Action)
+		event.Row.Data = converter.row(row, rowsEvent.Table)
+	}
+	// For updates, i now points at the new image so the key follows the latest value
+	event.PartitionKey = primaryKeyString(rowsEvent.Table, rowsEvent.Rows[i])
+	return i
+}
+
+// OnTableChanged Records a table touched by a DDL statement (implements canal.EventHandler interface)
+// It is called for every affected table before OnDDL
+// header: Event header information
+// schema: Database name
+// table: Table name
+// Returns: Possible errors
+func (s *MySQLSource) OnTableChanged(header *replication.EventHeader, schema string, table string) error {
+	s.mu.Lock()
+	delete(s.nullable, schema+"."+table)
+	s.mu.Unlock()
+	if !s.filter.Match(schema, table) || s.isSignalTable(schema, table) {
+		return nil
+	}
+	s.pendingDDL = append(s.pendingDDL, tableRef{database: schema, table: table})
+	return nil
+}
+
+// OnDDL Emits a DDL event for every table changed by the statement (implements canal.EventHandler interface)
+// header: Event header information
+// nextPos: Position after the statement
+// queryEvent: Query event holding the raw SQL
+// Returns: Possible errors
+func (s *MySQLSource) OnDDL(header *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+	tables := s.pendingDDL
+	s.pendingDDL = nil
+	if s.stop.reached(s.canal.SyncedPosition(), header.Timestamp) {
+		return errStopBound
+	}
+	// A DDL statement commits on its own, it is never wrapped in transaction markers
+	s.tx.begin(s.canal.SyncedPosition())
+	defer s.tx.end()
+	for _, t := range tables {
+		event := s.newEvent(header, t.database, t.table)
+		event.TxSeq = s.tx.next()
+		event.Row.Type = types.DDLEventRowType
+		event.Row.SQL = string(queryEvent.Query)
+		// The table cache was cleared by canal, so this loads the new definition
+		// A dropped table has no definition left and is emitted without columns
+		if table, err := s.canal.GetTable(t.database, t.table); err == nil {
+			event.Row.PrimaryKey = primaryKeyColumns(table)
+			event.Row.Columns = s.tableColumns(table)
 		}
-		select {
-		case s.eventDataChan <- event:
-		default:
-			logx.Warn("Event channel is full, discarding event, db: %s, table: %s", event.Row.Database, event.Row.Table)
+		if err := s.emitter.emit(s.canal.Ctx(), event); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 // OnPosSynced Handles binlog position sync events (implements canal.EventHandler interface)
+// The position is not saved right away, it is handed to the checkpointer and persisted
+// once every event emitted before it has been acknowledged by the output
 // header: Event header information
 // pos: Current sync position
 // set: GTID set
 // force: Force sync or not
 // Returns: Possible errors
 func (s *MySQLSource) OnPosSynced(header *replication.EventHeader, pos mysql.Position, set mysql.GTIDSet, force bool) error {
-	// Save current sync position
-	return s.savePosition(pos)
+	// Save current sync position once all preceding events are delivered
+	position := MysqlPosition{File: pos.Name, Pos: pos.Pos, StartTime: s.cfg.StartTime}
+	if set != nil && set.String() != "" {
+		position.GTID = set.String()
+		position.Flavor = s.cfg.Flavor
+	}
+	if err := s.checkpoint.Mark(position); err != nil {
+		return err
+	}
+	// Closing the canal syncs the position without an event header
+	if header == nil {
+		return nil
+	}
+	// The next transaction starts at pos, stop here if it lies beyond the bound
+	if s.stop.reached(pos, header.Timestamp) || s.stop.executed(set) {
+		return errStopBound
+	}
+	return nil
 }
 
-// rowToMap Converts database row data to a key-value map
-// row: Row data array
+// isSignalTable Reports whether a table is the incremental snapshot signal table
+func (s *MySQLSource) isSignalTable(database, table string) bool {
+	return s.incremental != nil && s.incremental.isSignalTable(database, table)
+}
+
+// newEvent Creates an event with the binlog header and transaction information filled in
+// header: Event header information
+// database: Database name
+// table: Table name
+// Returns: Event with a tracked acknowledgement token
+func (s *MySQLSource) newEvent(header *replication.EventHeader, database, table string) types.EventData {
+	var event types.EventData
+	event.Time = time.Now()
+	event.Pos = int64(header.LogPos)
+	event.ServerID = int64(header.ServerID)
+	event.File = s.canal.SyncedPosition().Name
+	event.GTID = s.tx.gtid
+	event.TxID = s.tx.id
+	event.Token = s.checkpoint.Track()
+	event.Row.Time = int64(header.Timestamp)
+	event.Row.Database = database
+	event.Row.Table = table
+	return event
+}
+
+// fillMetadata Adds primary key and, when enabled, column metadata to a row event
+// event: Event whose Data is already filled
 // table: Table schema information
-// Returns: Mapping of column names to values
-func (s *MySQLSource) rowToMap(row []interface{}, table *schema.Table) map[string]interface{} {
-	m := make(map[string]interface{})
+func (s *MySQLSource) fillMetadata(event *types.EventData, table *schema.Table) {
+	fillPrimaryKey(event, table)
+	if s.cfg.ColumnMetadata {
+		event.Row.Columns = s.tableColumns(table)
+	}
+}
 
-	for j, col := range table.Columns {
-		raw := row[j]
-		if raw == nil {
-			m[col.Name] = nil
-			continue
+// fillPrimaryKey Adds the primary key column names and values to a row event
+// event: Event whose Data is already filled
+// table: Table schema information
+func fillPrimaryKey(event *types.EventData, table *schema.Table) {
+	event.Row.PrimaryKey = primaryKeyColumns(table)
+	if len(event.Row.PrimaryKey) > 0 {
+		event.Row.Key = make(map[string]any, len(event.Row.PrimaryKey))
+		for _, name := range event.Row.PrimaryKey {
+			event.Row.Key[name] = event.Row.Data[name]
 		}
+	}
+}
 
-		switch col.Type {
-		case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT:
-			switch v := raw.(type) {
-			case []byte:
-				val, err := strconv.ParseInt(string(v), 10, 64)
-				if err != nil {
-					m[col.Name] = v
-				} else {
-					m[col.Name] = val
-				}
-			case int, int32, int64:
-				m[col.Name] = v
-			default:
-				m[col.Name] = raw
-			}
+// primaryKeyColumns Returns the primary key column names of a table
+// table: Table schema information
+// Returns: Column names in key order, nil if the table has no primary key
+func primaryKeyColumns(table *schema.Table) []string {
+	if len(table.PKColumns) == 0 {
+		return nil
+	}
+	names := make([]string, len(table.PKColumns))
+	for i, idx := range table.PKColumns {
+		names[i] = table.Columns[idx].Name
+	}
+	return names
+}
 
-		case schema.TYPE_FLOAT, schema.TYPE_DECIMAL:
-			switch v := raw.(type) {
-			case []byte:
-				val, err := strconv.ParseFloat(string(v), 64)
-				if err != nil {
-					m[col.Name] = v
-				} else {
-					m[col.Name] = val
-				}
-			case float32, float64:
-				m[col.Name] = v
-			default:
-				m[col.Name] = raw
-			}
+// tableColumns Describes the columns of a table
+// table: Table schema information
+// Returns: Column descriptors in table order
+func (s *MySQLSource) tableColumns(table *schema.Table) []types.Column {
+	return describeColumns(table, s.nullableColumns(table))
+}
 
-		case schema.TYPE_BIT:
-			switch v := raw.(type) {
-			case []byte:
-				if len(v) > 0 {
-					m[col.Name] = v[0] != 0
-				} else {
-					m[col.Name] = false
-				}
-			default:
-				m[col.Name] = raw
-			}
+// describeColumns Describes the columns of a table
+// table: Table schema information
+// nullable: Column name to nullability
+// Returns: Column descriptors in table order
+func describeColumns(table *schema.Table, nullable map[string]bool) []types.Column {
+	columns := make([]types.Column, len(table.Columns))
+	for i, col := range table.Columns {
+		columns[i] = types.Column{
+			Name:     col.Name,
+			Type:     col.RawType,
+			Unsigned: col.IsUnsigned,
+			Nullable: nullable[col.Name],
+		}
+	}
+	return columns
+}
 
-		case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP, schema.TYPE_DATE, schema.TYPE_TIME:
-			switch v := raw.(type) {
-			case []byte:
-				t, err := time.Parse("2006-01-02 15:04:05", string(v))
-				if err != nil {
-					m[col.Name] = string(v)
-				} else {
-					m[col.Name] = t
-				}
-			case time.Time:
-				m[col.Name] = v
-			default:
-				m[col.Name] = raw
-			}
+// nullableColumns Returns which columns of a table accept NULL
+// canal's schema does not keep nullability, so it is read from information_schema and cached
+// until the table changes
+// table: Table schema information
+// Returns: Column name to nullability, empty if the lookup fails
+func (s *MySQLSource) nullableColumns(table *schema.Table) map[string]bool {
+	key := table.Schema + "." + table.Name
+	s.mu.Lock()
+	cached, ok := s.nullable[key]
+	s.mu.Unlock()
+	if ok {
+		return cached
+	}
+	nullable := make(map[string]bool, len(table.Columns))
+	rr, err := s.canal.Execute("SELECT COLUMN_NAME, IS_NULLABLE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", table.Schema, table.Name)
+	if err != nil {
+		logx.Warn("failed to read column nullability, table: %s, error: %v", key, err)
+		return nullable
+	}
+	for i := 0; i < rr.RowNumber(); i++ {
+		name, _ := rr.GetString(i, 0)
+		isNullable, _ := rr.GetString(i, 1)
+		nullable[name] = isNullable == "YES"
+	}
+	s.mu.Lock()
+	s.nullable[key] = nullable
+	s.mu.Unlock()
+	return nullable
+}
 
-		case schema.TYPE_STRING, schema.TYPE_ENUM, schema.TYPE_SET, schema.TYPE_JSON, schema.TYPE_BINARY, schema.TYPE_POINT:
-			switch v := raw.(type) {
-			case []byte:
-				m[col.Name] = string(v)
-			default:
-				m[col.Name] = raw
-			}
+// rowToMap Converts database row data to a key-value map
+// row: Row data array
+// table: Table schema information
+// Returns: Mapping of column names to values
+func (s *MySQLSource) rowToMap(row []interface{}, table *schema.Table) map[string]interface{} {
+	return s.converter.row(row, table)
+}
 
-		default:
-			m[col.Name] = raw
+// primaryKeyString Builds a stable string from the primary key values of a row
+// table: Table schema information
+// row: Row data array
+// Returns: The joined key values, empty if the table has no primary key
+func primaryKeyString(table *schema.Table, row []interface{}) string {
+	values, err := table.GetPKValues(row)
+	if err != nil || len(values) == 0 {
+		return ""
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
 		}
+		parts[i] = fmt.Sprint(v)
 	}
-
-	return m
+	return strings.Join(parts, "\x00")
 }
 
 // loadPosition Loads the last saved sync position
-// Returns: MySQL binlog sync position
-func (s *MySQLSource) loadPosition() mysql.Position {
+// Returns: MySQL binlog sync position, with a GTID set when one is known, and whether it came from the store
+func (s *MySQLSource) loadPosition() (MysqlPosition, bool) {
 	// Try to load the last saved position from storage
 	positionBytes, err := s.store.Get(StoreKeyPosition)
 	if err == nil && len(positionBytes) > 0 {
 		var storePos MysqlPosition
 		_ = json.Unmarshal(positionBytes, &storePos)
-		if storePos.File != "" && storePos.Pos != 0 {
-			// Set position information
-			return mysql.Position{Name: storePos.File, Pos: storePos.Pos}
+		if storePos.GTID != "" || (storePos.File != "" && storePos.Pos != 0) {
+			return storePos, true
 		}
 	}
 	// If loading fails, try to get the position from the master
-	pos, err := s.canal.GetMasterPos()
-	if err == nil {
-		return pos
+	return s.masterPosition(), false
+}
+
+// masterPosition Reads the current position of the master
+// Returns: Current binlog file/pos, with the executed GTID set unless GTIDs are disabled
+func (s *MySQLSource) masterPosition() MysqlPosition {
+	var position MysqlPosition
+	if pos, err := s.stream.GetMasterPos(); err == nil {
+		position.File = pos.Name
+		position.Pos = pos.Pos
+	}
+	// Prefer the executed GTID set so later checkpoints survive a failover
+	if !s.cfg.DisableGTID {
+		if set, err := s.stream.GetMasterGTIDSet(); err == nil && set.String() != "" {
+			position.GTID = set.String()
+			position.Flavor = s.cfg.Flavor
+		}
 	}
-	// If all fails, return default position
-	return mysql.Position{}
+	return position
 }
 
-// savePosition Saves the current sync position
+// startCanal Starts canal from a saved position
+// A GTID set takes precedence over file/pos, which is meaningless on another server after a failover
+// pos: Position to resume from
+// Returns: Error when canal stops
+func (s *MySQLSource) startCanal(pos MysqlPosition) error {
+	if pos.GTID != "" && !s.cfg.DisableGTID {
+		flavor := pos.Flavor
+		if flavor == "" {
+			flavor = s.cfg.Flavor
+		}
+		set, err := mysql.ParseGTIDSet(flavor, pos.GTID)
+		if err != nil {
+			return fmt.Errorf("parse gtid set %q error: %w", pos.GTID, err)
+		}
+		logx.Info("MySQL source resuming from GTID set: %s", pos.GTID)
+		return s.stream.StartFromGTID(set)
+	}
+	logx.Info("MySQL source resuming from binlog position: %s:%d", pos.File, pos.Pos)
+	return s.stream.RunFrom(mysql.Position{Name: pos.File, Pos: pos.Pos})
+}
+
+// savePosition Saves the acknowledged sync position
+// Calls are serialized by the checkpointer, so no additional locking is needed here
 // pos: Sync position to save
 // Returns: Possible errors
-func (s *MySQLSource) savePosition(pos mysql.Position) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *MySQLSource) savePosition(pos MysqlPosition) error {
 	// Convert position format
-	positionBytes, err := json.Marshal(MysqlPosition{
-		File: pos.Name,
-		Pos:  pos.Pos,
-	})
+	positionBytes, err := json.Marshal(pos)
 	if err != nil {
 		return fmt.Errorf("marshal position error: %w", err)
 	}
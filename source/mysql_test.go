@@ -0,0 +1,226 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/pkg/structx"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMySQLSource Creates a MySQL source without a canal connection, backed by a file store
+func newTestMySQLSource(t *testing.T, cfg MysqlConfig) (*MySQLSource, store.IStore) {
+	cfg, err := structx.MergeWithDefaults[MysqlConfig](cfg)
+	assert.NoError(t, err)
+	filter, err := newTableFilter(cfg.IncludeTableRegex, DefaultMysqlExcludeTableRegex)
+	assert.NoError(t, err)
+	converter, err := newValueConverter(cfg)
+	assert.NoError(t, err)
+	s := &MySQLSource{
+		cfg:       cfg,
+		filter:    filter,
+		converter: converter,
+		nullable:  make(map[string]map[string]bool),
+	}
+	s.checkpoint = NewCheckpointer[MysqlPosition](s.savePosition)
+	s.emitter, err = newEmitter(64, OverflowPolicyBlock, "", nil)
+	assert.NoError(t, err)
+	s.eventDataChan = s.emitter.ch
+	st, err := store.NewFileStore(store.FileConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	s.WithStore(st)
+	return s, st
+}
+
+func TestMySQLSource_CloseReleasesEmitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+	}{
+		{name: "never run or run returned", running: false},
+		{name: "running", running: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestMySQLSource(t, MysqlConfig{})
+			dir := t.TempDir()
+			var err error
+			s.emitter, err = newEmitter(1, OverflowPolicySpill, dir, nil)
+			assert.NoError(t, err)
+			s.eventDataChan = s.emitter.ch
+			s.running = tt.running
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, s.emitter.emit(context.Background(), types.EventData{Token: uint64(i + 1)}))
+			}
+
+			assert.NoError(t, s.Close())
+			assert.NoError(t, s.Close())
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Empty(t, entries, "the spill file must be removed")
+			for range s.eventDataChan {
+			}
+			assert.False(t, s.running)
+		})
+	}
+}
+
+func TestMySQLSource_OnPosSyncedWithoutHeader(t *testing.T) {
+	s, st := newTestMySQLSource(t, MysqlConfig{})
+	pos := mysql.Position{Name: "mysql-bin.000003", Pos: 1234}
+	// Closing the canal syncs its position without an event header
+	assert.NoError(t, s.OnPosSynced(nil, pos, nil, true))
+	assert.True(t, st.Has(StoreKeyPosition))
+}
+
+// fakeStream Serves a fixed master position and records where streaming was started
+type fakeStream struct {
+	pos    mysql.Position
+	posErr error
+	// gtid Executed GTID set of the master, in MySQL format
+	gtid string
+	// started "gtid <set>" or "pos <file>:<pos>"
+	started string
+}
+
+func (f *fakeStream) GetMasterPos() (mysql.Position, error) { return f.pos, f.posErr }
+
+func (f *fakeStream) GetMasterGTIDSet() (mysql.GTIDSet, error) {
+	return mysql.ParseGTIDSet(mysql.MySQLFlavor, f.gtid)
+}
+
+func (f *fakeStream) StartFromGTID(set mysql.GTIDSet) error {
+	f.started = "gtid " + set.String()
+	return nil
+}
+
+func (f *fakeStream) RunFrom(pos mysql.Position) error {
+	f.started = fmt.Sprintf("pos %s:%d", pos.Name, pos.Pos)
+	return nil
+}
+
+func TestMySQLSource_LoadPosition(t *testing.T) {
+	const gtid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23"
+	master := mysql.Position{Name: "mysql-bin.000009", Pos: 900}
+	tests := []struct {
+		name       string
+		cfg        MysqlConfig
+		stored     string
+		stream     *fakeStream
+		want       MysqlPosition
+		wantStored bool
+	}{
+		{
+			name:       "stored gtid set",
+			stored:     `{"file":"mysql-bin.000003","pos":1234,"gtid":"` + gtid + `","flavor":"mysql"}`,
+			stream:     &fakeStream{pos: master},
+			want:       MysqlPosition{File: "mysql-bin.000003", Pos: 1234, GTID: gtid, Flavor: "mysql"},
+			wantStored: true,
+		},
+		{
+			name:       "stored file and position",
+			stored:     `{"file":"mysql-bin.000003","pos":1234}`,
+			stream:     &fakeStream{pos: master, gtid: gtid},
+			want:       MysqlPosition{File: "mysql-bin.000003", Pos: 1234},
+			wantStored: true,
+		},
+		{
+			name:   "nothing stored reads the master gtid set",
+			stream: &fakeStream{pos: master, gtid: gtid},
+			want:   MysqlPosition{File: master.Name, Pos: master.Pos, GTID: gtid, Flavor: "mysql"},
+		},
+		{
+			name:   "empty stored position reads the master",
+			stored: `{"file":"","pos":0}`,
+			stream: &fakeStream{pos: master},
+			want:   MysqlPosition{File: master.Name, Pos: master.Pos},
+		},
+		{
+			name:   "disabled gtid reads the master file and position only",
+			cfg:    MysqlConfig{DisableGTID: true},
+			stream: &fakeStream{pos: master, gtid: gtid},
+			want:   MysqlPosition{File: master.Name, Pos: master.Pos},
+		},
+		{
+			name:   "master position unavailable",
+			stream: &fakeStream{posErr: fmt.Errorf("access denied")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, st := newTestMySQLSource(t, tt.cfg)
+			s.stream = tt.stream
+			if tt.stored != "" {
+				assert.NoError(t, st.Set(StoreKeyPosition, []byte(tt.stored)))
+			}
+			pos, stored := s.loadPosition()
+			assert.Equal(t, tt.want, pos)
+			assert.Equal(t, tt.wantStored, stored)
+		})
+	}
+}
+
+func TestMySQLSource_StartCanal(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MysqlConfig
+		pos     MysqlPosition
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "gtid set takes precedence over file and position",
+			pos:  MysqlPosition{File: "mysql-bin.000003", Pos: 1234, GTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", Flavor: "mysql"},
+			want: "gtid 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23",
+		},
+		{
+			name: "recorded flavor wins over the configured one",
+			cfg:  MysqlConfig{Flavor: mysql.MySQLFlavor},
+			pos:  MysqlPosition{GTID: "0-1-100", Flavor: mysql.MariaDBFlavor},
+			want: "gtid 0-1-100",
+		},
+		{
+			name: "configured flavor when none was recorded",
+			cfg:  MysqlConfig{Flavor: mysql.MariaDBFlavor},
+			pos:  MysqlPosition{GTID: "0-1-100"},
+			want: "gtid 0-1-100",
+		},
+		{
+			name:    "gtid set of another flavor",
+			cfg:     MysqlConfig{Flavor: mysql.MySQLFlavor},
+			pos:     MysqlPosition{GTID: "0-1-100"},
+			wantErr: true,
+		},
+		{
+			name: "disabled gtid resumes from file and position",
+			cfg:  MysqlConfig{DisableGTID: true},
+			pos:  MysqlPosition{File: "mysql-bin.000003", Pos: 1234, GTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", Flavor: "mysql"},
+			want: "pos mysql-bin.000003:1234",
+		},
+		{
+			name: "file and position",
+			pos:  MysqlPosition{File: "mysql-bin.000003", Pos: 1234},
+			want: "pos mysql-bin.000003:1234",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestMySQLSource(t, tt.cfg)
+			stream := &fakeStream{}
+			s.stream = stream
+			err := s.startCanal(tt.pos)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, stream.started)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, stream.started)
+		})
+	}
+}
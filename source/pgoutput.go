@@ -0,0 +1,334 @@
+package source
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pgEpoch Start of the PostgreSQL timestamp epoch, replication timestamps are microseconds since it
+var pgEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// errPgShortMessage Returned when a replication message ends before all of its fields are read
+var errPgShortMessage = errors.New("pgoutput: message too short")
+
+// PostgreSQL type OIDs that are converted to something other than a string
+const (
+	pgOIDBool   = 16
+	pgOIDBytea  = 17
+	pgOIDInt8   = 20
+	pgOIDInt2   = 21
+	pgOIDInt4   = 23
+	pgOIDOid    = 26
+	pgOIDJSON   = 114
+	pgOIDFloat4 = 700
+	pgOIDFloat8 = 701
+	pgOIDJSONB  = 3802
+)
+
+// pgRelation Describes a table announced by a Relation message
+type pgRelation struct {
+	id        uint32
+	namespace string
+	name      string
+	columns   []pgColumn
+}
+
+// pgColumn Describes a column of a relation
+type pgColumn struct {
+	name    string
+	key     bool
+	typeOID uint32
+}
+
+// pgTupleValue One column of a tuple
+type pgTupleValue struct {
+	// kind 'n' null, 'u' unchanged TOAST value, 't' text, 'b' binary
+	kind byte
+	data []byte
+}
+
+// pgBegin Begin message, starts a transaction
+type pgBegin struct {
+	finalLSN   uint64
+	commitTime time.Time
+	xid        uint32
+}
+
+// pgCommit Commit message, ends a transaction
+type pgCommit struct {
+	commitLSN  uint64
+	endLSN     uint64
+	commitTime time.Time
+}
+
+// pgInsert Insert message
+type pgInsert struct {
+	relationID uint32
+	tuple      []pgTupleValue
+}
+
+// pgUpdate Update message, old is only present with REPLICA IDENTITY FULL or when the key changed
+type pgUpdate struct {
+	relationID uint32
+	old        []pgTupleValue
+	tuple      []pgTupleValue
+}
+
+// pgDelete Delete message, old holds the key columns or the full row with REPLICA IDENTITY FULL
+type pgDelete struct {
+	relationID uint32
+	old        []pgTupleValue
+}
+
+// pgReader Reads big-endian protocol fields from a message
+type pgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errPgShortMessage
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgReader) time() time.Time {
+	return pgTime(int64(r.uint64()))
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	i := strings.IndexByte(string(r.data), 0)
+	if i < 0 {
+		r.err = errPgShortMessage
+		return ""
+	}
+	s := string(r.data[:i])
+	r.data = r.data[i+1:]
+	return s
+}
+
+func (r *pgReader) tuple() []pgTupleValue {
+	n := int(r.uint16())
+	values := make([]pgTupleValue, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		value := pgTupleValue{kind: r.byte()}
+		switch value.kind {
+		case 'n', 'u':
+		case 't', 'b':
+			value.data = r.take(int(r.uint32()))
+		default:
+			r.err = fmt.Errorf("pgoutput: unknown tuple value kind %q", value.kind)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// decodePgoutput Decodes a pgoutput (protocol version 1) message
+// Messages that carry no row changes (Origin, Type, Truncate, logical decoding messages) decode to nil
+// data: Payload of an XLogData message
+// Returns: One of *pgBegin, *pgCommit, *pgRelation, *pgInsert, *pgUpdate, *pgDelete or nil, and possible errors
+func decodePgoutput(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errPgShortMessage
+	}
+	r := &pgReader{data: data[1:]}
+	var msg any
+	switch data[0] {
+	case 'B':
+		msg = &pgBegin{finalLSN: r.uint64(), commitTime: r.time(), xid: r.uint32()}
+	case 'C':
+		r.byte() // flags, currently unused
+		msg = &pgCommit{commitLSN: r.uint64(), endLSN: r.uint64(), commitTime: r.time()}
+	case 'R':
+		rel := &pgRelation{id: r.uint32(), namespace: r.string(), name: r.string()}
+		r.byte() // replica identity setting
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			col := pgColumn{key: r.byte()&1 == 1, name: r.string(), typeOID: r.uint32()}
+			r.uint32() // type modifier
+			rel.columns = append(rel.columns, col)
+		}
+		msg = rel
+	case 'I':
+		insert := &pgInsert{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("pgoutput: unexpected insert tuple kind %q", kind)
+		}
+		insert.tuple = r.tuple()
+		msg = insert
+	case 'U':
+		update := &pgUpdate{relationID: r.uint32()}
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			update.old = r.tuple()
+			kind = r.byte()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("pgoutput: unexpected update tuple kind %q", kind)
+		}
+		update.tuple = r.tuple()
+		msg = update
+	case 'D':
+		del := &pgDelete{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'K' && kind != 'O' && r.err == nil {
+			return nil, fmt.Errorf("pgoutput: unexpected delete tuple kind %q", kind)
+		}
+		del.old = r.tuple()
+		msg = del
+	case 'O', 'Y', 'T', 'M':
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("pgoutput: unknown message type %q", data[0])
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return msg, nil
+}
+
+// tupleToMap Converts a tuple of a relation to a column name to value map
+// Unchanged TOAST values are not sent by the server and are left out
+// rel: Relation the tuple belongs to
+// tuple: Tuple values in column order
+// Returns: Mapping of column names to values
+func (rel *pgRelation) tupleToMap(tuple []pgTupleValue) map[string]any {
+	data := make(map[string]any, len(tuple))
+	for i, value := range tuple {
+		if i >= len(rel.columns) {
+			break
+		}
+		col := rel.columns[i]
+		switch value.kind {
+		case 'n':
+			data[col.name] = nil
+		case 'u':
+		case 'b':
+			data[col.name] = base64.StdEncoding.EncodeToString(value.data)
+		default:
+			data[col.name] = pgTextValue(col.typeOID, string(value.data))
+		}
+	}
+	return data
+}
+
+// keyColumns Returns the replica identity key column names in column order
+func (rel *pgRelation) keyColumns() []string {
+	var names []string
+	for _, col := range rel.columns {
+		if col.key {
+			names = append(names, col.name)
+		}
+	}
+	return names
+}
+
+// pgTextValue Converts a value in PostgreSQL text output format
+// NUMERIC is kept as exact text, BYTEA is re-encoded as base64, JSON is embedded as a nested value
+// typeOID: Column type OID
+// text: Text representation sent by the server
+// Returns: Converted value, the text itself for unknown types or unparsable values
+func pgTextValue(typeOID uint32, text string) any {
+	switch typeOID {
+	case pgOIDBool:
+		return text == "t"
+	case pgOIDInt2, pgOIDInt4, pgOIDInt8:
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return v
+		}
+	case pgOIDOid:
+		if v, err := strconv.ParseUint(text, 10, 32); err == nil {
+			return v
+		}
+	case pgOIDFloat4, pgOIDFloat8:
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return v
+		}
+	case pgOIDBytea:
+		if b, err := hex.DecodeString(strings.TrimPrefix(text, `\x`)); err == nil {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+	case pgOIDJSON, pgOIDJSONB:
+		if json.Valid([]byte(text)) {
+			return json.RawMessage(text)
+		}
+	}
+	return text
+}
+
+// pgTime Converts microseconds since the PostgreSQL epoch to a time
+func pgTime(micros int64) time.Time {
+	return pgEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+// pgTimestamp Converts a time to microseconds since the PostgreSQL epoch
+func pgTimestamp(t time.Time) int64 {
+	return t.Sub(pgEpoch).Microseconds()
+}
+
+// parseLSN Parses a log sequence number written as "XXX/XXX"
+func parseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid lsn %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q: %w", s, err)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lsn %q: %w", s, err)
+	}
+	return h<<32 | l, nil
+}
+
+// formatLSN Formats a log sequence number as "XXX/XXX"
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", lsn>>32, uint32(lsn))
+}
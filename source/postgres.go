@@ -0,0 +1,503 @@
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chihqiang/dbxgo/pkg/structx"
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+var (
+	// DefaultPostgresExcludeTableRegex Default regular expression to exclude system schemas
+	DefaultPostgresExcludeTableRegex = []string{
+		"pg_catalog.*",
+		"information_schema.*",
+	}
+)
+
+// PostgresConfig PostgreSQL configuration entity
+// Changes are read from a logical replication slot with the pgoutput plugin. The publication must
+// exist beforehand (e.g. CREATE PUBLICATION dbxgo FOR ALL TABLES), the slot is created when missing.
+// Table filtering follows the MySQL rules, matched against "schema.table".
+type PostgresConfig struct {
+	Addr     string `yaml:"addr" json:"addr" mapstructure:"addr" env:"SOURCE_POSTGRES_ADDR" envDefault:"127.0.0.1:5432"`
+	User     string `yaml:"user" json:"user" mapstructure:"user" env:"SOURCE_POSTGRES_USER" envDefault:"postgres"`
+	Password string `yaml:"password" json:"password" mapstructure:"password" env:"SOURCE_POSTGRES_PASSWORD" envDefault:""`
+	// Database Database the replication slot belongs to
+	Database string `yaml:"database" json:"database" mapstructure:"database" env:"SOURCE_POSTGRES_DATABASE" envDefault:"postgres"`
+	// Slot Logical replication slot name
+	Slot string `yaml:"slot" json:"slot" mapstructure:"slot" env:"SOURCE_POSTGRES_SLOT" envDefault:"dbxgo"`
+	// Publication Publication that decides which tables are replicated
+	Publication       string   `yaml:"publication" json:"publication" mapstructure:"publication" env:"SOURCE_POSTGRES_PUBLICATION" envDefault:"dbxgo"`
+	ExcludeTableRegex []string `yaml:"exclude_table_regex" json:"exclude_table_regex" mapstructure:"exclude_table_regex" env:"SOURCE_POSTGRES_EXCLUDE_TABLE_REGEX"`
+	IncludeTableRegex []string `yaml:"include_table_regex" json:"include_table_regex" mapstructure:"include_table_regex" env:"SOURCE_POSTGRES_INCLUDE_TABLE_REGEX"`
+	// StatusInterval Seconds between standby status updates that report the confirmed LSN to the server
+	StatusInterval int `yaml:"status_interval" json:"status_interval" mapstructure:"status_interval" env:"SOURCE_POSTGRES_STATUS_INTERVAL" envDefault:"10"`
+	// BufferSize Capacity of the event channel between the replication reader and the workers
+	BufferSize int `yaml:"buffer_size" json:"buffer_size" mapstructure:"buffer_size" env:"SOURCE_POSTGRES_BUFFER_SIZE" envDefault:"10240"`
+	// OverflowPolicy What to do when the event channel is full: block / drop / spill
+	OverflowPolicy OverflowPolicy `yaml:"overflow_policy" json:"overflow_policy" mapstructure:"overflow_policy" env:"SOURCE_POSTGRES_OVERFLOW_POLICY" envDefault:"block"`
+	// SpillDir Directory of the disk queue used by the spill policy, defaults to the system temp directory
+	SpillDir string `yaml:"spill_dir" json:"spill_dir" mapstructure:"spill_dir" env:"SOURCE_POSTGRES_SPILL_DIR"`
+}
+
+// PostgresPosition PostgreSQL replication position
+// Used to save and restore sync positions
+type PostgresPosition struct {
+	// LSN End of the last fully acknowledged transaction, as "XXX/XXX"
+	LSN string `json:"lsn"`
+}
+
+// PostgresSource PostgreSQL datasource specific implementation
+// Responsible for consuming a logical replication slot and converting pgoutput messages to the unified event format
+type PostgresSource struct {
+	// mu Mutex used to ensure concurrency safety
+	mu sync.Mutex
+	// store Storage interface for persisting or reading offsets and states
+	store store.IStore
+	// cfg Datasource configuration information
+	cfg PostgresConfig
+	// eventDataChan Event data output channel
+	eventDataChan chan types.EventData
+	// emitter Delivers events into eventDataChan according to the overflow policy
+	emitter *emitter
+	// checkpoint Tracks delivered events and persists the lowest fully acknowledged LSN
+	checkpoint *Checkpointer[PostgresPosition]
+	// filter Include/exclude table filter
+	filter *tableFilter
+	// running Indicates whether the datasource is running
+	running bool
+	// cancel Stops the replication loop started by Run
+	cancel context.CancelFunc
+	// done Closed once the replication loop has returned
+	done chan struct{}
+	// finish Closes the event channel exactly once
+	finish sync.Once
+	// relations Relations announced by the server, by relation ID
+	relations map[uint32]*pgRelation
+	// xid Transaction ID of the open transaction
+	xid uint32
+	// commitTime Commit time of the open transaction
+	commitTime time.Time
+	// seq Number of events emitted in the open transaction
+	seq int
+	// received Highest WAL position received from the server
+	received uint64
+	// confirmed Highest LSN whose events are all acknowledged, reported back to the server
+	confirmed atomic.Uint64
+}
+
+// NewPostgresSource Creates a PostgreSQL datasource instance
+// No connection is made until Run is called
+// cfg: PostgreSQL datasource configuration information
+// Returns: PostgresSource instance that implements the ISource interface and potential errors
+func NewPostgresSource(cfg PostgresConfig) (*PostgresSource, error) {
+	var err error
+	cfg, err = structx.MergeWithDefaults[PostgresConfig](cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.ExcludeTableRegex) == 0 {
+		cfg.ExcludeTableRegex = DefaultPostgresExcludeTableRegex
+	}
+	filter, err := newTableFilter(cfg.IncludeTableRegex, cfg.ExcludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	source := &PostgresSource{
+		cfg:       cfg,
+		filter:    filter,
+		relations: make(map[uint32]*pgRelation),
+		done:      make(chan struct{}),
+	}
+	source.checkpoint = NewCheckpointer[PostgresPosition](source.savePosition)
+	source.emitter, err = newEmitter(cfg.BufferSize, cfg.OverflowPolicy, cfg.SpillDir, func(event types.EventData) {
+		// A discarded event is never delivered, acknowledge it so the checkpoint is not held back
+		_ = source.checkpoint.Ack(event.Token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	source.eventDataChan = source.emitter.ch
+	return source, nil
+}
+
+// WithStore Sets the store for the PostgreSQL source
+func (s *PostgresSource) WithStore(store store.IStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+// Run Starts streaming from the replication slot
+// ctx: Context to control cancellation and timeout
+// Returns: Possible errors
+func (s *PostgresSource) Run(ctx context.Context) error {
+	if s.store == nil {
+		return fmt.Errorf("store is not initialized, cannot run PostgresSource")
+	}
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("it is already running")
+	}
+	s.running = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+	defer close(s.done)
+
+	startLSN, err := s.loadPosition()
+	if err != nil {
+		return err
+	}
+	s.confirmed.Store(startLSN)
+	conn, err := pgconn.Connect(ctx, s.connString())
+	if err != nil {
+		return fmt.Errorf("connect error: %w", err)
+	}
+	defer func() { _ = conn.Close(context.Background()) }()
+	if err := s.ensureSlot(ctx, conn); err != nil {
+		return err
+	}
+	if err := s.startReplication(ctx, conn, startLSN); err != nil {
+		return err
+	}
+	logx.Info("PostgreSQL source streaming from slot %s, lsn: %s", s.cfg.Slot, formatLSN(startLSN))
+	err = s.stream(ctx, conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("replication error: %w", err)
+}
+
+// GetChanEventData Returns event channel for external reading
+func (s *PostgresSource) GetChanEventData() <-chan types.EventData {
+	return s.eventDataChan
+}
+
+// Ack Acknowledges a delivered event so that its LSN can be checkpointed
+// event: Event that has been sent downstream
+// Returns: Possible errors while saving the position
+func (s *PostgresSource) Ack(event types.EventData) error {
+	return s.checkpoint.Ack(event.Token)
+}
+
+// Close Stops the replication loop and releases resources
+// The emitter is released even if Run was never called or has already returned
+// Returns: Possible errors
+func (s *PostgresSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Only a running source has a replication loop to stop
+	if s.running {
+		s.cancel()
+		<-s.done
+	}
+	s.closeChannel()
+	s.running = false
+	return nil
+}
+
+// closeChannel Stops the spill queue and closes the event channel, only the first call has an effect
+func (s *PostgresSource) closeChannel() {
+	s.finish.Do(func() {
+		if err := s.emitter.close(); err != nil {
+			logx.Warn("failed to remove spill queue: %v", err)
+		}
+		if dropped := s.emitter.Dropped(); dropped > 0 {
+			logx.Warn("PostgreSQL source discarded %d events because the event channel was full", dropped)
+		}
+		close(s.eventDataChan)
+	})
+}
+
+// connString Builds a replication connection string for the configured database
+func (s *PostgresSource) connString() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(s.cfg.User, s.cfg.Password),
+		Host:     s.cfg.Addr,
+		Path:     "/" + s.cfg.Database,
+		RawQuery: "replication=database",
+	}
+	return u.String()
+}
+
+// ensureSlot Creates the logical replication slot if it does not exist yet
+// conn: Replication connection
+// Returns: Possible errors
+func (s *PostgresSource) ensureSlot(ctx context.Context, conn *pgconn.PgConn) error {
+	results, err := conn.Exec(ctx, "SELECT 1 FROM pg_replication_slots WHERE slot_name = "+quoteLiteral(s.cfg.Slot)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("read replication slots error: %w", err)
+	}
+	if len(results) > 0 && len(results[0].Rows) > 0 {
+		return nil
+	}
+	sql := fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput NOEXPORT_SNAPSHOT", quoteIdent(s.cfg.Slot))
+	if _, err := conn.Exec(ctx, sql).ReadAll(); err != nil {
+		return fmt.Errorf("create replication slot %s error: %w", s.cfg.Slot, err)
+	}
+	logx.Info("PostgreSQL replication slot created: %s", s.cfg.Slot)
+	return nil
+}
+
+// startReplication Switches the connection into streaming mode
+// A start LSN of zero lets the server continue from the slot's confirmed position
+// conn: Replication connection
+// startLSN: Position to resume from
+// Returns: Possible errors
+func (s *PostgresSource) startReplication(ctx context.Context, conn *pgconn.PgConn, startLSN uint64) error {
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names %s)",
+		quoteIdent(s.cfg.Slot), formatLSN(startLSN), quoteLiteral(quoteIdent(s.cfg.Publication)))
+	conn.Frontend().Send(&pgproto3.Query{String: sql})
+	if err := conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("start replication error: %w", err)
+	}
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("start replication error: %w", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("start replication error: %w", pgconn.ErrorResponseToPgError(msg))
+		}
+	}
+}
+
+// stream Reads replication messages until the context is canceled or the connection fails
+// A standby status update is sent every StatusInterval and whenever the server asks for one
+// conn: Replication connection in streaming mode
+// Returns: Error that stopped the stream
+func (s *PostgresSource) stream(ctx context.Context, conn *pgconn.PgConn) error {
+	interval := time.Duration(s.cfg.StatusInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	deadline := time.Now().Add(interval)
+	for {
+		if time.Now().After(deadline) {
+			if err := s.sendStatus(conn); err != nil {
+				return err
+			}
+			deadline = time.Now().Add(interval)
+		}
+		receiveCtx, cancel := context.WithDeadline(ctx, deadline)
+		msg, err := conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && pgconn.Timeout(err) {
+				continue
+			}
+			return err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			reply, err := s.handleCopyData(ctx, msg.Data)
+			if err != nil {
+				return err
+			}
+			if reply {
+				deadline = time.Time{}
+			}
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		}
+	}
+}
+
+// handleCopyData Handles one message of the replication stream
+// data: CopyData payload, an XLogData ('w') or primary keepalive ('k') message
+// Returns: Whether the server asked for an immediate status update, and possible errors
+func (s *PostgresSource) handleCopyData(ctx context.Context, data []byte) (bool, error) {
+	if len(data) == 0 {
+		return false, errPgShortMessage
+	}
+	r := &pgReader{data: data[1:]}
+	switch data[0] {
+	case 'k':
+		walEnd := r.uint64()
+		r.uint64() // server time
+		reply := r.byte() == 1
+		if r.err != nil {
+			return false, r.err
+		}
+		s.receivedUpTo(walEnd)
+		return reply, nil
+	case 'w':
+		walStart := r.uint64()
+		walEnd := r.uint64()
+		r.uint64() // server time
+		if r.err != nil {
+			return false, r.err
+		}
+		msg, err := decodePgoutput(r.data)
+		if err != nil {
+			return false, err
+		}
+		if err := s.handleMessage(ctx, walStart, msg); err != nil {
+			return false, err
+		}
+		s.receivedUpTo(walEnd)
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown replication message type %q", data[0])
+	}
+}
+
+// handleMessage Converts a decoded pgoutput message into events
+// walStart: WAL position of the message
+// msg: Decoded message
+// Returns: Possible errors
+func (s *PostgresSource) handleMessage(ctx context.Context, walStart uint64, msg any) error {
+	switch msg := msg.(type) {
+	case *pgRelation:
+		s.relations[msg.id] = msg
+	case *pgBegin:
+		s.xid = msg.xid
+		s.commitTime = msg.commitTime
+		s.seq = 0
+	case *pgCommit:
+		// The commit is safe to confirm once every row of the transaction is acknowledged
+		return s.checkpoint.Mark(PostgresPosition{LSN: formatLSN(msg.endLSN)})
+	case *pgInsert:
+		return s.emitRow(ctx, walStart, msg.relationID, types.InsertEventRowType, msg.tuple, nil)
+	case *pgUpdate:
+		return s.emitRow(ctx, walStart, msg.relationID, types.UpdateEventRowType, msg.tuple, msg.old)
+	case *pgDelete:
+		return s.emitRow(ctx, walStart, msg.relationID, types.DeleteEventRowType, msg.old, nil)
+	}
+	return nil
+}
+
+// emitRow Emits a row change of a relation
+// Database holds the schema name of the table
+// walStart: WAL position of the change
+// relationID: Relation the row belongs to
+// rowType: insert / update / delete
+// tuple: New row, or the old row for deletes
+// old: Old row of an update, nil when the server did not send it
+// Returns: Possible errors
+func (s *PostgresSource) emitRow(ctx context.Context, walStart uint64, relationID uint32, rowType types.EventRowType, tuple, old []pgTupleValue) error {
+	rel, ok := s.relations[relationID]
+	if !ok {
+		return fmt.Errorf("pgoutput: unknown relation %d", relationID)
+	}
+	if !s.filter.Match(rel.namespace, rel.name) {
+		return nil
+	}
+	s.seq++
+	event := types.EventData{
+		Time:  time.Now(),
+		Pos:   int64(walStart),
+		TxID:  strconv.FormatUint(uint64(s.xid), 10),
+		TxSeq: s.seq,
+		Token: s.checkpoint.Track(),
+	}
+	event.Row.Time = s.commitTime.Unix()
+	event.Row.Database = rel.namespace
+	event.Row.Table = rel.name
+	event.Row.Type = rowType
+	event.Row.Data = rel.tupleToMap(tuple)
+	if old != nil {
+		event.Row.Old = rel.tupleToMap(old)
+	}
+	event.Row.PrimaryKey = rel.keyColumns()
+	if len(event.Row.PrimaryKey) > 0 {
+		event.Row.Key = make(map[string]any, len(event.Row.PrimaryKey))
+		parts := make([]string, len(event.Row.PrimaryKey))
+		for i, name := range event.Row.PrimaryKey {
+			event.Row.Key[name] = event.Row.Data[name]
+			parts[i] = fmt.Sprint(event.Row.Data[name])
+		}
+		event.PartitionKey = strings.Join(parts, "\x00")
+	}
+	return s.emitter.emit(ctx, event)
+}
+
+// receivedUpTo Records the highest WAL position received from the server
+func (s *PostgresSource) receivedUpTo(lsn uint64) {
+	if lsn > s.received {
+		s.received = lsn
+	}
+}
+
+// sendStatus Sends a standby status update
+// Only the acknowledged LSN is reported as flushed, so the server keeps WAL that is still in flight
+// conn: Replication connection in streaming mode
+// Returns: Possible errors
+func (s *PostgresSource) sendStatus(conn *pgconn.PgConn) error {
+	confirmed := s.confirmed.Load()
+	data := make([]byte, 0, 34)
+	data = append(data, 'r')
+	data = binary.BigEndian.AppendUint64(data, max(s.received, confirmed))
+	data = binary.BigEndian.AppendUint64(data, confirmed)
+	data = binary.BigEndian.AppendUint64(data, confirmed)
+	data = binary.BigEndian.AppendUint64(data, uint64(pgTimestamp(time.Now())))
+	data = append(data, 0)
+	conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	if err := conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("send standby status error: %w", err)
+	}
+	return nil
+}
+
+// loadPosition Loads the last saved LSN
+// Returns: Saved LSN, zero when nothing is stored, and possible errors for a corrupt position
+func (s *PostgresSource) loadPosition() (uint64, error) {
+	positionBytes, err := s.store.Get(StoreKeyPosition)
+	if err != nil || len(positionBytes) == 0 {
+		return 0, nil
+	}
+	var pos PostgresPosition
+	if err := json.Unmarshal(positionBytes, &pos); err != nil || pos.LSN == "" {
+		return 0, nil
+	}
+	return parseLSN(pos.LSN)
+}
+
+// savePosition Saves the acknowledged LSN and reports it to the server with the next status update
+// Calls are serialized by the checkpointer, so no additional locking is needed here
+// pos: Sync position to save
+// Returns: Possible errors
+func (s *PostgresSource) savePosition(pos PostgresPosition) error {
+	lsn, err := parseLSN(pos.LSN)
+	if err != nil {
+		return err
+	}
+	positionBytes, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("marshal position error: %w", err)
+	}
+	if err := s.store.Set(StoreKeyPosition, positionBytes); err != nil {
+		return err
+	}
+	s.confirmed.Store(lsn)
+	return nil
+}
+
+// quoteIdent Quotes a PostgreSQL identifier with double quotes
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral Quotes a PostgreSQL string literal with single quotes
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,142 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chihqiang/dbxgo/store"
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// readPgFixture Reads recorded CopyData payloads, one hex encoded message per line
+func readPgFixture(t *testing.T, name string) [][]byte {
+	f, err := os.Open("testdata/" + name)
+	assert.NoError(t, err)
+	defer f.Close()
+	var messages [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		data, err := hex.DecodeString(line)
+		assert.NoError(t, err)
+		messages = append(messages, data)
+	}
+	assert.NoError(t, scanner.Err())
+	return messages
+}
+
+func newTestPostgresSource(t *testing.T) (*PostgresSource, store.IStore) {
+	s, err := NewPostgresSource(PostgresConfig{IncludeTableRegex: []string{`public\.users`}, BufferSize: 16})
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = s.emitter.close() })
+	st, err := store.NewFileStore(store.FileConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	s.WithStore(st)
+	return s, st
+}
+
+func TestPostgresSource_ReplaysTransaction(t *testing.T) {
+	s, st := newTestPostgresSource(t)
+	for _, data := range readPgFixture(t, "pgoutput_transaction.hex") {
+		_, err := s.handleCopyData(context.Background(), data)
+		assert.NoError(t, err)
+	}
+	if !assert.Len(t, s.eventDataChan, 3) {
+		return
+	}
+	insert, update, del := <-s.eventDataChan, <-s.eventDataChan, <-s.eventDataChan
+
+	assert.Equal(t, types.InsertEventRowType, insert.Row.Type)
+	assert.Equal(t, "public", insert.Row.Database)
+	assert.Equal(t, "users", insert.Row.Table)
+	assert.Equal(t, "731", insert.TxID)
+	assert.Equal(t, 1, insert.TxSeq)
+	assert.Equal(t, []string{"id"}, insert.Row.PrimaryKey)
+	assert.Equal(t, map[string]any{"id": int64(1)}, insert.Row.Key)
+	assert.Equal(t, "1", insert.PartitionKey)
+	assert.Equal(t, "12.30", insert.Row.Data["balance"])
+	assert.Equal(t, true, insert.Row.Data["active"])
+	assert.Equal(t, "AQI=", insert.Row.Data["avatar"])
+	meta, err := json.Marshal(insert.Row.Data["meta"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tags":["a"]}`, string(meta))
+
+	assert.Equal(t, types.UpdateEventRowType, update.Row.Type)
+	assert.Equal(t, "alice", update.Row.Old["name"])
+	assert.Equal(t, "bob", update.Row.Data["name"])
+	assert.Nil(t, update.Row.Data["meta"])
+	assert.NotContains(t, update.Row.Data, "avatar")
+	assert.Equal(t, 2, update.TxSeq)
+
+	assert.Equal(t, types.DeleteEventRowType, del.Row.Type)
+	assert.Equal(t, int64(1), del.Row.Data["id"])
+	assert.Equal(t, 3, del.TxSeq)
+
+	// The commit LSN is only saved once every row of the transaction is acknowledged
+	assert.False(t, st.Has(StoreKeyPosition))
+	for _, event := range []types.EventData{update, insert, del} {
+		assert.NoError(t, s.Ack(event))
+	}
+	lsn, err := s.loadPosition()
+	assert.NoError(t, err)
+	assert.Equal(t, "0/16B3830", formatLSN(lsn))
+	assert.Equal(t, lsn, s.confirmed.Load())
+}
+
+func TestDecodePgoutput_ShortMessage(t *testing.T) {
+	_, err := decodePgoutput([]byte{'B', 0, 1})
+	assert.ErrorIs(t, err, errPgShortMessage)
+}
+
+func TestParseLSN_RoundTrip(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	assert.NoError(t, err)
+	assert.Equal(t, "16/B374D848", formatLSN(lsn))
+
+	_, err = parseLSN("16B374D848")
+	assert.Error(t, err)
+}
+
+func TestPostgresSource_CloseReleasesEmitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+	}{
+		{name: "never run or run returned", running: false},
+		{name: "running", running: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewPostgresSource(PostgresConfig{BufferSize: 1, OverflowPolicy: OverflowPolicySpill, SpillDir: dir})
+			assert.NoError(t, err)
+			if tt.running {
+				// Run has returned, its loop is done
+				s.running = true
+				s.cancel = func() {}
+				close(s.done)
+			}
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, s.emitter.emit(context.Background(), types.EventData{Token: uint64(i + 1)}))
+			}
+
+			assert.NoError(t, s.Close())
+			assert.NoError(t, s.Close())
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Empty(t, entries, "the spill file must be removed")
+			for range s.eventDataChan {
+			}
+			assert.False(t, s.running)
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// schemaRegistry Table definitions kept up to date by replaying DDL statements
+// Tables are built from CREATE TABLE statements, either read from a schema file or found in the binlog,
+// and ALTER, RENAME and DROP statements are applied to them as they are replayed.
+// Tables added with put (e.g. read from a live server) have no statement, an ALTER forgets them
+// so they are loaded again.
+type schemaRegistry struct {
+	// parser SQL parser, it is not safe for concurrent use
+	parser *parser.Parser
+	// defs CREATE TABLE statements by "database.table", updated in place by ALTER statements
+	defs map[string]*ast.CreateTableStmt
+	// tables Table definitions by "database.table"
+	tables map[string]*schema.Table
+	// nullable Column nullability by "database.table"
+	nullable map[string]map[string]bool
+	// database Current database set by USE statements
+	database string
+}
+
+// newSchemaRegistry Creates an empty registry
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		parser:   parser.New(),
+		defs:     make(map[string]*ast.CreateTableStmt),
+		tables:   make(map[string]*schema.Table),
+		nullable: make(map[string]map[string]bool),
+	}
+}
+
+// loadSchemaFile Builds a registry from a file of SQL statements, e.g. the output of mysqldump --no-data
+// path: Path of the SQL file
+// Returns: Registry and possible errors
+func loadSchemaFile(path string) (*schemaRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schema file error: %w", err)
+	}
+	r := newSchemaRegistry()
+	if _, err := r.apply(string(data), ""); err != nil {
+		return nil, fmt.Errorf("parse schema file %s error: %w", path, err)
+	}
+	return r, nil
+}
+
+// apply Applies USE, CREATE, ALTER, RENAME, TRUNCATE and DROP TABLE statements, other statements are ignored
+// sql: One or more SQL statements
+// database: Default database of the statements, the current database when empty
+// Returns: Tables changed by the statements and possible parse errors
+func (r *schemaRegistry) apply(sql string, database string) ([]tableRef, error) {
+	stmts, _, err := r.parser.Parse(sql, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if database != "" {
+		r.database = database
+	}
+	var changed []tableRef
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.UseStmt:
+			r.database = stmt.DBName
+		case *ast.CreateTableStmt:
+			ref := r.ref(stmt.Table)
+			if stmt.ReferTable != nil {
+				// CREATE TABLE ... LIKE copies the columns of the referenced table
+				like, ok := r.defs[r.ref(stmt.ReferTable).key()]
+				if !ok {
+					r.forget(ref)
+					changed = append(changed, ref)
+					continue
+				}
+				def := *like
+				def.Table = stmt.Table
+				stmt = &def
+			}
+			r.define(ref, stmt)
+			changed = append(changed, ref)
+		case *ast.AlterTableStmt:
+			changed = append(changed, r.alter(stmt)...)
+		case *ast.RenameTableStmt:
+			for _, t := range stmt.TableToTables {
+				from, to := r.ref(t.OldTable), r.ref(t.NewTable)
+				r.rename(from, to)
+				changed = append(changed, from)
+			}
+		case *ast.TruncateTableStmt:
+			changed = append(changed, r.ref(stmt.Table))
+		case *ast.DropTableStmt:
+			for _, t := range stmt.Tables {
+				ref := r.ref(t)
+				r.forget(ref)
+				changed = append(changed, ref)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// alter Applies the column and primary key changes of an ALTER TABLE statement
+// Returns: Tables changed by the statement
+func (r *schemaRegistry) alter(stmt *ast.AlterTableStmt) []tableRef {
+	ref := r.ref(stmt.Table)
+	def, ok := r.defs[ref.key()]
+	if !ok {
+		// Without the statement the change cannot be applied, the table is loaded again when needed
+		r.forget(ref)
+		return []tableRef{ref}
+	}
+	changed := []tableRef{ref}
+	for _, spec := range stmt.Specs {
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			for i, col := range spec.NewColumns {
+				pos := spec.Position
+				if i > 0 {
+					pos = nil
+				}
+				def.Cols = insertColumn(def.Cols, col, pos)
+			}
+		case ast.AlterTableDropColumn:
+			def.Cols = removeColumn(def.Cols, spec.OldColumnName.Name.L)
+			renameKeyColumn(def, spec.OldColumnName.Name.L, "")
+		case ast.AlterTableModifyColumn:
+			col := spec.NewColumns[0]
+			def.Cols = replaceColumn(def.Cols, col.Name.Name.L, col, spec.Position)
+		case ast.AlterTableChangeColumn:
+			col := spec.NewColumns[0]
+			def.Cols = replaceColumn(def.Cols, spec.OldColumnName.Name.L, col, spec.Position)
+			renameKeyColumn(def, spec.OldColumnName.Name.L, col.Name.Name.O)
+		case ast.AlterTableRenameColumn:
+			for _, col := range def.Cols {
+				if col.Name.Name.L == spec.OldColumnName.Name.L {
+					renamed := *col
+					renamed.Name = spec.NewColumnName
+					def.Cols = replaceColumn(def.Cols, col.Name.Name.L, &renamed, nil)
+					break
+				}
+			}
+			renameKeyColumn(def, spec.OldColumnName.Name.L, spec.NewColumnName.Name.O)
+		case ast.AlterTableAddConstraint:
+			if spec.Constraint != nil && spec.Constraint.Tp == ast.ConstraintPrimaryKey {
+				def.Constraints = append(def.Constraints, spec.Constraint)
+			}
+		case ast.AlterTableDropPrimaryKey:
+			dropPrimaryKey(def)
+		case ast.AlterTableRenameTable:
+			to := r.ref(spec.NewTable)
+			r.rename(ref, to)
+			ref = to
+			changed = append(changed, to)
+		}
+	}
+	r.define(ref, def)
+	return changed
+}
+
+// define Builds the table definition of a CREATE TABLE statement
+func (r *schemaRegistry) define(ref tableRef, stmt *ast.CreateTableStmt) {
+	table := &schema.Table{Schema: ref.database, Name: ref.table}
+	nullable := make(map[string]bool, len(stmt.Cols))
+	var primaryKey []string
+	for _, col := range stmt.Cols {
+		name := col.Name.Name.O
+		extra := ""
+		nullable[name] = true
+		for _, opt := range col.Options {
+			switch opt.Tp {
+			case ast.ColumnOptionNotNull:
+				nullable[name] = false
+			case ast.ColumnOptionPrimaryKey:
+				nullable[name] = false
+				primaryKey = append(primaryKey, name)
+			case ast.ColumnOptionAutoIncrement:
+				extra = "auto_increment"
+			}
+		}
+		table.AddColumn(name, col.Tp.InfoSchemaStr(), "", extra)
+	}
+	for _, constraint := range stmt.Constraints {
+		if constraint.Tp != ast.ConstraintPrimaryKey {
+			continue
+		}
+		for _, key := range constraint.Keys {
+			if key.Column != nil {
+				primaryKey = append(primaryKey, key.Column.Name.O)
+				nullable[key.Column.Name.O] = false
+			}
+		}
+	}
+	if len(primaryKey) > 0 {
+		index := table.AddIndex("PRIMARY")
+		for _, name := range primaryKey {
+			if i := table.FindColumn(name); i >= 0 {
+				index.AddColumn(name, 0)
+				table.PKColumns = append(table.PKColumns, i)
+			}
+		}
+	}
+	r.defs[ref.key()] = stmt
+	r.tables[ref.key()] = table
+	r.nullable[ref.key()] = nullable
+}
+
+// put Adds a table definition that was not built from a statement
+func (r *schemaRegistry) put(table *schema.Table, nullable map[string]bool) {
+	key := table.Schema + "." + table.Name
+	delete(r.defs, key)
+	r.tables[key] = table
+	r.nullable[key] = nullable
+}
+
+// rename Moves a table definition to a new name
+func (r *schemaRegistry) rename(from, to tableRef) {
+	if def, ok := r.defs[from.key()]; ok {
+		r.forget(from)
+		r.define(to, def)
+		return
+	}
+	r.forget(from)
+	r.forget(to)
+}
+
+// forget Removes a table definition
+func (r *schemaRegistry) forget(ref tableRef) {
+	delete(r.defs, ref.key())
+	delete(r.tables, ref.key())
+	delete(r.nullable, ref.key())
+}
+
+// table Returns a table definition and its column nullability
+// Returns: Table, nullability and whether the table is known
+func (r *schemaRegistry) table(database, table string) (*schema.Table, map[string]bool, bool) {
+	key := database + "." + table
+	t, ok := r.tables[key]
+	return t, r.nullable[key], ok
+}
+
+// ref Resolves a table name against the current database
+func (r *schemaRegistry) ref(name *ast.TableName) tableRef {
+	database := name.Schema.O
+	if database == "" {
+		database = r.database
+	}
+	return tableRef{database: database, table: name.Name.O}
+}
+
+// key Returns the "database.table" form of a table reference
+func (t tableRef) key() string {
+	return t.database + "." + t.table
+}
+
+// insertColumn Inserts a column at a position, at the end when pos is nil or has no position
+func insertColumn(cols []*ast.ColumnDef, col *ast.ColumnDef, pos *ast.ColumnPosition) []*ast.ColumnDef {
+	at := len(cols)
+	if pos != nil {
+		switch pos.Tp {
+		case ast.ColumnPositionFirst:
+			at = 0
+		case ast.ColumnPositionAfter:
+			for i, c := range cols {
+				if c.Name.Name.L == pos.RelativeColumn.Name.L {
+					at = i + 1
+				}
+			}
+		}
+	}
+	out := make([]*ast.ColumnDef, 0, len(cols)+1)
+	out = append(append(append(out, cols[:at]...), col), cols[at:]...)
+	return out
+}
+
+// replaceColumn Replaces a column with a new definition
+// Without a position the new definition keeps the place of the old one
+func replaceColumn(cols []*ast.ColumnDef, name string, col *ast.ColumnDef, pos *ast.ColumnPosition) []*ast.ColumnDef {
+	if pos != nil && pos.Tp != ast.ColumnPositionNone {
+		return insertColumn(removeColumn(cols, name), col, pos)
+	}
+	out := make([]*ast.ColumnDef, len(cols))
+	for i, c := range cols {
+		out[i] = c
+		if c.Name.Name.L == name {
+			out[i] = col
+		}
+	}
+	return out
+}
+
+// removeColumn Removes a column by lower-case name
+func removeColumn(cols []*ast.ColumnDef, name string) []*ast.ColumnDef {
+	out := make([]*ast.ColumnDef, 0, len(cols))
+	for _, c := range cols {
+		if c.Name.Name.L != name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// renameKeyColumn Renames a primary key column, an empty name removes it from the key
+// Constraints are copied, statements may share them after CREATE TABLE ... LIKE
+func renameKeyColumn(def *ast.CreateTableStmt, from, to string) {
+	constraints := make([]*ast.Constraint, len(def.Constraints))
+	for i, constraint := range def.Constraints {
+		constraints[i] = constraint
+		if constraint.Tp != ast.ConstraintPrimaryKey {
+			continue
+		}
+		renamed := *constraint
+		renamed.Keys = nil
+		for _, key := range constraint.Keys {
+			if key.Column != nil && key.Column.Name.L == from {
+				if to == "" {
+					continue
+				}
+				key = &ast.IndexPartSpecification{Column: &ast.ColumnName{Name: ast.NewCIStr(to)}, Length: key.Length}
+			}
+			renamed.Keys = append(renamed.Keys, key)
+		}
+		constraints[i] = &renamed
+	}
+	def.Constraints = constraints
+}
+
+// dropPrimaryKey Removes the primary key constraint and column options
+func dropPrimaryKey(def *ast.CreateTableStmt) {
+	var constraints []*ast.Constraint
+	for _, constraint := range def.Constraints {
+		if constraint.Tp != ast.ConstraintPrimaryKey {
+			constraints = append(constraints, constraint)
+		}
+	}
+	def.Constraints = constraints
+	cols := make([]*ast.ColumnDef, len(def.Cols))
+	for i, col := range def.Cols {
+		stripped := *col
+		stripped.Options = nil
+		for _, opt := range col.Options {
+			if opt.Tp != ast.ColumnOptionPrimaryKey {
+				stripped.Options = append(stripped.Options, opt)
+			}
+		}
+		cols[i] = &stripped
+	}
+	def.Cols = cols
+}
+
+// isTableDDL Reports whether a query may change a table definition, cheap check before parsing
+func isTableDDL(query string) bool {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	for _, prefix := range []string{"CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE"} {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func columnNames(r *schemaRegistry, database, table string) []string {
+	t, _, ok := r.table(database, table)
+	if !ok {
+		return nil
+	}
+	names := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func TestSchemaRegistry_CreateTable(t *testing.T) {
+	r := newSchemaRegistry()
+	_, err := r.apply("USE shop;\n"+
+		"CREATE TABLE `orders` (\n"+
+		"  `id` bigint unsigned NOT NULL AUTO_INCREMENT,\n"+
+		"  `status` enum('new','paid') DEFAULT NULL,\n"+
+		"  `total` decimal(10,2) NOT NULL,\n"+
+		"  PRIMARY KEY (`id`)\n"+
+		") ENGINE=InnoDB;\n"+
+		"CREATE TABLE other.tags (name varchar(32) PRIMARY KEY);", "")
+	assert.NoError(t, err)
+
+	table, nullable, ok := r.table("shop", "orders")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, []string{"id"}, primaryKeyColumns(table))
+	assert.True(t, table.Columns[0].IsUnsigned)
+	assert.True(t, table.Columns[0].IsAuto)
+	assert.Equal(t, []string{"new", "paid"}, table.Columns[1].EnumValues)
+	assert.Equal(t, map[string]bool{"id": false, "status": true, "total": false}, nullable)
+
+	tags, _, ok := r.table("other", "tags")
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{"name"}, primaryKeyColumns(tags))
+	}
+}
+
+func TestSchemaRegistry_AppliesDDL(t *testing.T) {
+	r := newSchemaRegistry()
+	_, err := r.apply("CREATE TABLE orders (id int PRIMARY KEY, a int, b int)", "shop")
+	assert.NoError(t, err)
+
+	changed, err := r.apply("ALTER TABLE orders ADD COLUMN c int AFTER id, DROP COLUMN a, CHANGE b bb varchar(8)", "shop")
+	assert.NoError(t, err)
+	assert.Equal(t, []tableRef{{database: "shop", table: "orders"}}, changed)
+	assert.Equal(t, []string{"id", "c", "bb"}, columnNames(r, "shop", "orders"))
+
+	_, err = r.apply("ALTER TABLE orders RENAME COLUMN id TO order_id", "shop")
+	assert.NoError(t, err)
+	table, _, _ := r.table("shop", "orders")
+	assert.Equal(t, []string{"order_id"}, primaryKeyColumns(table))
+
+	changed, err = r.apply("RENAME TABLE orders TO orders_old", "shop")
+	assert.NoError(t, err)
+	assert.Equal(t, []tableRef{{database: "shop", table: "orders"}}, changed)
+	assert.Nil(t, columnNames(r, "shop", "orders"))
+	assert.Equal(t, []string{"order_id", "c", "bb"}, columnNames(r, "shop", "orders_old"))
+
+	_, err = r.apply("CREATE TABLE orders LIKE orders_old; DROP TABLE orders_old", "shop")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"order_id", "c", "bb"}, columnNames(r, "shop", "orders"))
+	assert.Nil(t, columnNames(r, "shop", "orders_old"))
+}
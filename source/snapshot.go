@@ -0,0 +1,303 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/chihqiang/logx"
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// SnapshotMode Defines whether existing rows are read before streaming the binlog
+type SnapshotMode string
+
+const (
+	// SnapshotModeNever Only stream changes (default)
+	SnapshotModeNever SnapshotMode = "never"
+	// SnapshotModeInitial Read every included table when no checkpoint exists yet
+	SnapshotModeInitial SnapshotMode = "initial"
+)
+
+const (
+	// DefaultSnapshotChunkSize Default number of rows read per SELECT
+	DefaultSnapshotChunkSize = 1024
+)
+
+// snapshot Reads every included table inside one consistent transaction
+// The rows are emitted as snapshot events and the returned position is where streaming continues.
+// The position is checkpointed only after all snapshot rows are acknowledged, so an interrupted
+// snapshot is started over on the next run.
+// ctx: Context to control cancellation
+// Returns: Binlog position matching the snapshot and possible errors
+func (s *MySQLSource) snapshot(ctx context.Context) (MysqlPosition, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	defer conn.Close()
+
+	pos, err := s.beginSnapshot(conn)
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	// Read-only transaction, there is nothing to roll back on failure
+	defer func() { _, _ = conn.Execute("COMMIT") }()
+
+	tables, err := s.snapshotTables(conn)
+	if err != nil {
+		return MysqlPosition{}, err
+	}
+	logx.Info("MySQL snapshot started, tables: %d, position: %s:%d", len(tables), pos.File, pos.Pos)
+	startedAt := time.Now()
+	for _, t := range tables {
+		table, err := s.canal.GetTable(t.database, t.table)
+		if err != nil {
+			return MysqlPosition{}, fmt.Errorf("load table %s.%s error: %w", t.database, t.table, err)
+		}
+		count, err := s.snapshotTable(ctx, conn, table, startedAt)
+		if err != nil {
+			return MysqlPosition{}, fmt.Errorf("snapshot table %s.%s error: %w", t.database, t.table, err)
+		}
+		logx.Info("MySQL snapshot table done, table: %s.%s, rows: %d", t.database, t.table, count)
+	}
+	if err := s.checkpoint.Mark(pos); err != nil {
+		return MysqlPosition{}, err
+	}
+	logx.Info("MySQL snapshot finished, elapsed: %s", time.Since(startedAt))
+	return pos, nil
+}
+
+// connect Opens a dedicated connection for reading table rows
+// The session reads TIMESTAMP values in UTC, like the binlog decoder does
+// Returns: Connection and possible errors
+func (s *MySQLSource) connect() (*client.Conn, error) {
+	conn, err := client.Connect(s.cfg.Addr, s.cfg.User, s.cfg.Password, "")
+	if err != nil {
+		return nil, fmt.Errorf("connect error: %w", err)
+	}
+	if _, err := conn.Execute("SET time_zone = '+00:00'"); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("set session time zone error: %w", err)
+	}
+	return conn, nil
+}
+
+// beginSnapshot Opens a consistent snapshot transaction and reads the matching binlog position
+// A global read lock is held for the short time between opening the transaction and reading
+// the position. Without the RELOAD privilege the position is read before the transaction
+// starts instead, which may replay a few changes twice but never misses any.
+// conn: Dedicated snapshot connection
+// Returns: Binlog position of the snapshot and possible errors
+func (s *MySQLSource) beginSnapshot(conn *client.Conn) (MysqlPosition, error) {
+	if _, err := conn.Execute("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return MysqlPosition{}, err
+	}
+	if _, err := conn.Execute("FLUSH TABLES WITH READ LOCK"); err != nil {
+		logx.Warn("MySQL snapshot cannot acquire global read lock, continuing without it: %v", err)
+		pos := s.masterPosition()
+		if _, err := conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+			return MysqlPosition{}, err
+		}
+		return pos, nil
+	}
+	defer func() { _, _ = conn.Execute("UNLOCK TABLES") }()
+	if _, err := conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return MysqlPosition{}, err
+	}
+	return s.masterPosition(), nil
+}
+
+// snapshotTables Lists the base tables matching the include/exclude regexes
+// conn: Dedicated snapshot connection
+// Returns: Tables to read and possible errors
+func (s *MySQLSource) snapshotTables(conn *client.Conn) ([]tableRef, error) {
+	rr, err := conn.Execute("SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_SCHEMA, TABLE_NAME")
+	if err != nil {
+		return nil, fmt.Errorf("list tables error: %w", err)
+	}
+	var tables []tableRef
+	for i := 0; i < rr.RowNumber(); i++ {
+		database, _ := rr.GetString(i, 0)
+		table, _ := rr.GetString(i, 1)
+		if s.filter.Match(database, table) && !s.isSignalTable(database, table) {
+			tables = append(tables, tableRef{database: database, table: table})
+		}
+	}
+	return tables, nil
+}
+
+// snapshotTable Reads one table in primary key order, chunk by chunk
+// Tables without a primary key have no stable order to page by, they are streamed in a single SELECT
+// ctx: Context to control cancellation
+// conn: Dedicated snapshot connection
+// table: Table schema information
+// startedAt: Snapshot start time, used as the event time
+// Returns: Number of rows emitted and possible errors
+func (s *MySQLSource) snapshotTable(ctx context.Context, conn *client.Conn, table *schema.Table, startedAt time.Time) (int, error) {
+	count := 0
+	emit := func(row []any) error {
+		if err := s.emitter.emit(ctx, s.newSnapshotEvent(table, row, startedAt)); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+	if len(table.PKColumns) == 0 {
+		return count, scanTable(conn, table, emit)
+	}
+	err := readChunks(table, s.snapshotChunkSize(), nil, func(lastPK []any, chunkSize int) ([][]any, error) {
+		return selectChunk(conn, table, lastPK, chunkSize)
+	}, emit)
+	return count, err
+}
+
+// readChunks Reads a table in primary key order until a chunk comes back short
+// table: Table schema information, must have a primary key
+// chunkSize: Maximum number of rows per chunk
+// lastPK: Primary key values to continue after, nil to start at the first row
+// read: Reads the chunk following lastPK
+// visit: Called for every row in key order
+// Returns: Possible errors of read and visit
+func readChunks(table *schema.Table, chunkSize int, lastPK []any, read func(lastPK []any, chunkSize int) ([][]any, error), visit func(row []any) error) error {
+	for {
+		rows, err := read(lastPK, chunkSize)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := visit(row); err != nil {
+				return err
+			}
+		}
+		if len(rows) < chunkSize {
+			return nil
+		}
+		lastPK, err = table.GetPKValues(rows[len(rows)-1])
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// snapshotChunkSize Returns the configured chunk size or the default
+func (s *MySQLSource) snapshotChunkSize() int {
+	if s.cfg.SnapshotChunkSize <= 0 {
+		return DefaultSnapshotChunkSize
+	}
+	return s.cfg.SnapshotChunkSize
+}
+
+// newSnapshotEvent Creates a snapshot event for a row read from a table
+// table: Table schema information
+// row: Row values in column order
+// startedAt: Snapshot start time, used as the event time
+// Returns: Event with a tracked acknowledgement token
+func (s *MySQLSource) newSnapshotEvent(table *schema.Table, row []any, startedAt time.Time) types.EventData {
+	event := types.EventData{
+		Time:         time.Now(),
+		Token:        s.checkpoint.Track(),
+		PartitionKey: primaryKeyString(table, row),
+	}
+	event.Row.Time = startedAt.Unix()
+	event.Row.Database = table.Schema
+	event.Row.Table = table.Name
+	event.Row.Type = types.SnapshotEventRowType
+	event.Row.Data = s.rowToMap(row, table)
+	s.fillMetadata(&event, table)
+	return event
+}
+
+// selectChunk Reads the chunk of a table following lastPK in primary key order
+// conn: Connection to query on
+// table: Table schema information, must have a primary key
+// lastPK: Primary key values of the last row read, nil for the first chunk
+// chunkSize: Maximum number of rows to read
+// Returns: Row values in column order and possible errors
+func selectChunk(conn *client.Conn, table *schema.Table, lastPK []any, chunkSize int) ([][]any, error) {
+	query, args := chunkQuery(table, lastPK, chunkSize)
+	rr, err := conn.Execute(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return resultRows(rr), nil
+}
+
+// chunkQuery Builds the SELECT of the chunk following lastPK
+// table: Table schema information, must have a primary key
+// lastPK: Primary key values of the last row read, nil for the first chunk
+// chunkSize: Maximum number of rows to read
+// Returns: Query and its arguments
+func chunkQuery(table *schema.Table, lastPK []any, chunkSize int) (string, []any) {
+	pkColumns := make([]string, len(table.PKColumns))
+	for i, idx := range table.PKColumns {
+		pkColumns[i] = quoteIdentifier(table.Columns[idx].Name)
+	}
+	order := strings.Join(pkColumns, ", ")
+	if lastPK == nil {
+		return fmt.Sprintf("%s ORDER BY %s LIMIT ?", tableQuery(table), order), []any{chunkSize}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(pkColumns)), ", ")
+	query := fmt.Sprintf("%s WHERE (%s) > (%s) ORDER BY %s LIMIT ?", tableQuery(table), order, placeholders, order)
+	return query, append(slices.Clone(lastPK), chunkSize)
+}
+
+// tableQuery Builds the SELECT of every column of a table, in column order
+func tableQuery(table *schema.Table) string {
+	columns := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		columns[i] = quoteIdentifier(col.Name)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s.%s", strings.Join(columns, ", "), quoteIdentifier(table.Schema), quoteIdentifier(table.Name))
+}
+
+// scanTable Streams every row of a table in a single SELECT, without holding the result in memory
+// conn: Connection to query on
+// table: Table schema information
+// visit: Called for every row, the server waits while it blocks
+// Returns: Possible errors of the query and visit
+func scanTable(conn *client.Conn, table *schema.Table, visit func(row []any) error) error {
+	var result mysql.Result
+	return conn.ExecuteSelectStreaming(tableQuery(table), &result, func(values []mysql.FieldValue) error {
+		return visit(fieldValues(values))
+	}, nil)
+}
+
+// resultRows Converts a result set into rows shaped like canal row events
+// rr: Query result
+// Returns: Row values in column order
+func resultRows(rr *mysql.Result) [][]any {
+	if rr == nil || rr.Resultset == nil {
+		return nil
+	}
+	rows := make([][]any, len(rr.Values))
+	for i, values := range rr.Values {
+		rows[i] = fieldValues(values)
+	}
+	return rows
+}
+
+// fieldValues Converts the fields of a result row into row values
+// Byte values are copied, a streamed row reuses its buffer for the next one
+func fieldValues(values []mysql.FieldValue) []any {
+	row := make([]any, len(values))
+	for i := range values {
+		v := values[i].Value()
+		if b, ok := v.([]byte); ok {
+			v = bytes.Clone(b)
+		}
+		row[i] = v
+	}
+	return row
+}
+
+// quoteIdentifier Quotes a MySQL identifier with backticks
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
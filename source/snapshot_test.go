@@ -0,0 +1,244 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// ordersTable Schema of shop.orders, keyed by id
+func ordersTable() *schema.Table {
+	return &schema.Table{
+		Schema: "shop",
+		Name:   "orders",
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER, RawType: "bigint"},
+			{Name: "status", Type: schema.TYPE_STRING, RawType: "varchar(16)"},
+		},
+		PKColumns: []int{0},
+	}
+}
+
+// itemsTable Schema of shop.items, keyed by (region, id)
+func itemsTable() *schema.Table {
+	return &schema.Table{
+		Schema: "shop",
+		Name:   "items",
+		Columns: []schema.TableColumn{
+			{Name: "region", Type: schema.TYPE_STRING},
+			{Name: "id", Type: schema.TYPE_NUMBER},
+			{Name: "name", Type: schema.TYPE_STRING},
+		},
+		PKColumns: []int{0, 1},
+	}
+}
+
+// chunkTable In-memory table read by primary key, like selectChunk does
+type chunkTable struct {
+	table *schema.Table
+	// rows Rows sorted by primary key
+	rows [][]any
+	// reads lastPK of every chunk read
+	reads [][]any
+}
+
+func (c *chunkTable) read(lastPK []any, chunkSize int) ([][]any, error) {
+	c.reads = append(c.reads, lastPK)
+	start := 0
+	if lastPK != nil {
+		for start < len(c.rows) && c.compare(c.rows[start], lastPK) <= 0 {
+			start++
+		}
+	}
+	end := min(start+chunkSize, len(c.rows))
+	return c.rows[start:end], nil
+}
+
+// compare Compares the primary key of a row with key values
+func (c *chunkTable) compare(row, key []any) int {
+	for i, idx := range c.table.PKColumns {
+		a, b := fmt.Sprint(row[idx]), fmt.Sprint(key[i])
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// orderRows Builds rows of shop.orders with ids 1..n
+func orderRows(n int) [][]any {
+	rows := make([][]any, n)
+	for i := range rows {
+		rows[i] = []any{int64(i + 1), "new"}
+	}
+	return rows
+}
+
+func TestReadChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		table     *schema.Table
+		rows      [][]any
+		chunkSize int
+		lastPK    []any
+		wantRows  int
+		wantReads [][]any
+	}{
+		{
+			name:      "empty table",
+			table:     ordersTable(),
+			chunkSize: 3,
+			wantReads: [][]any{nil},
+		},
+		{
+			name:      "less than one chunk",
+			table:     ordersTable(),
+			rows:      orderRows(2),
+			chunkSize: 3,
+			wantRows:  2,
+			wantReads: [][]any{nil},
+		},
+		{
+			name:      "exactly one chunk reads an empty one",
+			table:     ordersTable(),
+			rows:      orderRows(3),
+			chunkSize: 3,
+			wantRows:  3,
+			wantReads: [][]any{nil, {int64(3)}},
+		},
+		{
+			name:      "partial last chunk",
+			table:     ordersTable(),
+			rows:      orderRows(7),
+			chunkSize: 3,
+			wantRows:  7,
+			wantReads: [][]any{nil, {int64(3)}, {int64(6)}},
+		},
+		{
+			name:      "resume after a key",
+			table:     ordersTable(),
+			rows:      orderRows(7),
+			chunkSize: 3,
+			lastPK:    []any{int64(5)},
+			wantRows:  2,
+			wantReads: [][]any{{int64(5)}},
+		},
+		{
+			name:  "composite key",
+			table: itemsTable(),
+			rows: [][]any{
+				{"eu", int64(1), "a"}, {"eu", int64(2), "b"},
+				{"us", int64(1), "c"}, {"us", int64(2), "d"},
+			},
+			chunkSize: 2,
+			wantRows:  4,
+			wantReads: [][]any{nil, {"eu", int64(2)}, {"us", int64(2)}},
+		},
+		{
+			name:  "resume inside a composite key prefix",
+			table: itemsTable(),
+			rows: [][]any{
+				{"eu", int64(1), "a"}, {"eu", int64(2), "b"},
+				{"us", int64(1), "c"}, {"us", int64(2), "d"},
+			},
+			chunkSize: 2,
+			lastPK:    []any{"eu", int64(1)},
+			wantRows:  3,
+			wantReads: [][]any{{"eu", int64(1)}, {"us", int64(1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &chunkTable{table: tt.table, rows: tt.rows}
+			var visited [][]any
+			err := readChunks(tt.table, tt.chunkSize, tt.lastPK, c.read, func(row []any) error {
+				visited = append(visited, row)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, visited, tt.wantRows)
+			assert.Equal(t, tt.rows[len(tt.rows)-tt.wantRows:], visited)
+			assert.Equal(t, tt.wantReads, c.reads)
+		})
+	}
+}
+
+func TestReadChunks_StopsOnError(t *testing.T) {
+	c := &chunkTable{table: ordersTable(), rows: orderRows(5)}
+	visits := 0
+	err := readChunks(ordersTable(), 2, nil, c.read, func(row []any) error {
+		visits++
+		if visits == 3 {
+			return fmt.Errorf("channel closed")
+		}
+		return nil
+	})
+	assert.ErrorContains(t, err, "channel closed")
+	assert.Equal(t, 3, visits)
+	assert.Len(t, c.reads, 2)
+}
+
+func TestChunkQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		table     *schema.Table
+		lastPK    []any
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "first chunk",
+			table:     ordersTable(),
+			wantQuery: "SELECT `id`, `status` FROM `shop`.`orders` ORDER BY `id` LIMIT ?",
+			wantArgs:  []any{100},
+		},
+		{
+			name:      "after a key",
+			table:     ordersTable(),
+			lastPK:    []any{int64(42)},
+			wantQuery: "SELECT `id`, `status` FROM `shop`.`orders` WHERE (`id`) > (?) ORDER BY `id` LIMIT ?",
+			wantArgs:  []any{int64(42), 100},
+		},
+		{
+			name:      "after a composite key",
+			table:     itemsTable(),
+			lastPK:    []any{"eu", int64(7)},
+			wantQuery: "SELECT `region`, `id`, `name` FROM `shop`.`items` WHERE (`region`, `id`) > (?, ?) ORDER BY `region`, `id` LIMIT ?",
+			wantArgs:  []any{"eu", int64(7), 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastPK := append([]any(nil), tt.lastPK...)
+			query, args := chunkQuery(tt.table, tt.lastPK, 100)
+			assert.Equal(t, tt.wantQuery, query)
+			assert.Equal(t, tt.wantArgs, args)
+			assert.Equal(t, lastPK, append([]any(nil), tt.lastPK...), "lastPK must not be modified")
+		})
+	}
+
+	table := ordersTable()
+	table.PKColumns = nil
+	assert.Equal(t, "SELECT `id`, `status` FROM `shop`.`orders`", tableQuery(table))
+}
+
+func TestFieldValues_CopiesBytes(t *testing.T) {
+	buf := []byte("widget")
+	values := []mysql.FieldValue{
+		mysql.NewFieldValue(mysql.FieldValueTypeSigned, 1, nil),
+		mysql.NewFieldValue(mysql.FieldValueTypeString, 0, buf),
+		mysql.NewFieldValue(mysql.FieldValueTypeNull, 0, nil),
+	}
+	row := fieldValues(values)
+	assert.Equal(t, []any{int64(1), []byte("widget"), nil}, row)
+
+	// A streamed row reuses its buffer for the next row
+	copy(buf, "gadget")
+	assert.Equal(t, []byte("widget"), row[1])
+}
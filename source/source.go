@@ -9,21 +9,35 @@ import (
 
 const (
 	StoreKeyPosition = "_dbxgo_position"
+	// StoreKeyBinlogFilePosition Replay position of the binlog file source, kept apart from the live MySQL position
+	StoreKeyBinlogFilePosition = "_dbxgo_binlogfile_position"
+	// StoreKeyIncrementalSnapshot Progress of a signal-triggered incremental snapshot
+	StoreKeyIncrementalSnapshot = "_dbxgo_incremental_snapshot"
 )
 
 type SourceType string
 
 var (
-	SourceTypeMysql SourceType = "mysql"
+	SourceTypeMysql    SourceType = "mysql"
+	SourceTypePostgres SourceType = "postgres"
+	SourceTypeMongoDB  SourceType = "mongodb"
+	// SourceTypeBinlogFile Replays local binlog files, finishes once they are exhausted
+	SourceTypeBinlogFile SourceType = "binlogfile"
 )
 
 // Config Defines the data source configuration structure
 // Used to configure database connection information and storage settings
 type Config struct {
-	// Type The type of the data source, such as "mysql"
-	Type  SourceType   `yaml:"type" json:"type" mapstructure:"type" env:"SOURCE_TYPE,required"`
-	Mysql MysqlConfig  `yaml:"mysql" json:"mysql" mapstructure:"mysql"`
-	Store store.Config `yaml:"store" json:"store" mapstructure:"store"`
+	// Name Unique name of the source, namespaces its checkpoints and is stamped into its events
+	// It may stay empty when only one source is configured
+	Name string `yaml:"name" json:"name" mapstructure:"name" env:"SOURCE_NAME"`
+	// Type The type of the data source: mysql / postgres / mongodb / binlogfile
+	Type       SourceType       `yaml:"type" json:"type" mapstructure:"type" env:"SOURCE_TYPE,required"`
+	Mysql      MysqlConfig      `yaml:"mysql" json:"mysql" mapstructure:"mysql"`
+	Postgres   PostgresConfig   `yaml:"postgres" json:"postgres" mapstructure:"postgres"`
+	MongoDB    MongoConfig      `yaml:"mongodb" json:"mongodb" mapstructure:"mongodb"`
+	BinlogFile BinlogFileConfig `yaml:"binlogfile" json:"binlogfile" mapstructure:"binlogfile"`
+	Store      store.Config     `yaml:"store" json:"store" mapstructure:"store"`
 }
 
 // ISource Defines the data source interface
@@ -42,6 +56,12 @@ type ISource interface {
 	// Return value: A read-only event data channel
 	GetChanEventData() <-chan types.EventData
 
+	// Ack Acknowledges that an event has been delivered downstream
+	// The source only persists a position once every event before it has been acknowledged
+	// event: The delivered event
+	// Return value: Possible error while persisting the position
+	Ack(event types.EventData) error
+
 	// Close Closes the data source and releases resources
 	// Return value: Possible error
 	Close() error
@@ -54,6 +74,12 @@ func NewSource(cfg Config) (ISource, error) {
 	switch cfg.Type {
 	case SourceTypeMysql:
 		return NewMySQLSource(cfg.Mysql)
+	case SourceTypePostgres:
+		return NewPostgresSource(cfg.Postgres)
+	case SourceTypeMongoDB:
+		return NewMongoSource(cfg.MongoDB)
+	case SourceTypeBinlogFile:
+		return NewBinlogFileSource(cfg.BinlogFile, cfg.Mysql)
 	default:
 		return nil, fmt.Errorf("unsupported source type: %s", cfg.Type)
 	}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/chihqiang/dbxgo/types"
+)
+
+// spillFilePattern Name pattern of spill files
+const spillFilePattern = "dbxgo-spill-*"
+
+// spilledEvent Record written to the spill file
+// Token and PartitionKey are excluded from the JSON form of EventData, so they are stored alongside the event
+type spilledEvent struct {
+	Token        uint64          `json:"token"`
+	PartitionKey string          `json:"partition_key,omitempty"`
+	Event        types.EventData `json:"event"`
+}
+
+// spillQueue Append-only disk FIFO used when the event channel is full
+// Push is called by the binlog reader, Peek/Pop by a single drain goroutine
+type spillQueue struct {
+	mu sync.Mutex
+	// path Location of the spill file
+	path string
+	// writer Append handle
+	writer *os.File
+	// reader Read handle positioned at the oldest pending record
+	reader *os.File
+	// buf Buffered reader on top of reader
+	buf *bufio.Reader
+	// count Number of records not yet popped
+	count int
+	// head Record returned by the last Peek, nil if not read yet
+	head *types.EventData
+	// ready Signaled whenever a record is pushed
+	ready chan struct{}
+}
+
+// newSpillQueue Creates a spill file in dir, the system temp directory when empty
+func newSpillQueue(dir string) (*spillQueue, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "dbxgo-spill")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	writer, err := os.CreateTemp(dir, spillFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("create spill file error: %w", err)
+	}
+	reader, err := os.Open(writer.Name())
+	if err != nil {
+		_ = writer.Close()
+		_ = os.Remove(writer.Name())
+		return nil, fmt.Errorf("open spill file error: %w", err)
+	}
+	return &spillQueue{
+		path:   writer.Name(),
+		writer: writer,
+		reader: reader,
+		buf:    bufio.NewReader(reader),
+		ready:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Len Returns the number of records not yet popped
+func (q *spillQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Ready Returns a channel that is signaled after a push
+func (q *spillQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Push Appends an event to the spill file
+func (q *spillQueue) Push(event types.EventData) error {
+	data, err := json.Marshal(spilledEvent{Token: event.Token, PartitionKey: event.PartitionKey, Event: event})
+	if err != nil {
+		return fmt.Errorf("marshal spilled event error: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := q.writer.Write(data); err != nil {
+		return fmt.Errorf("write spill file error: %w", err)
+	}
+	q.mu.Lock()
+	q.count++
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek Returns the oldest pending event without removing it
+func (q *spillQueue) Peek() (types.EventData, error) {
+	if q.head != nil {
+		return *q.head, nil
+	}
+	line, err := q.buf.ReadBytes('\n')
+	if err != nil {
+		return types.EventData{}, fmt.Errorf("read spill file error: %w", err)
+	}
+	// UseNumber keeps integers exact, so the re-encoded event matches the original
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var record spilledEvent
+	if err := decoder.Decode(&record); err != nil {
+		return types.EventData{}, fmt.Errorf("decode spilled event error: %w", err)
+	}
+	record.Event.Token = record.Token
+	record.Event.PartitionKey = record.PartitionKey
+	q.head = &record.Event
+	return record.Event, nil
+}
+
+// Pop Removes the event returned by the last Peek
+// The file is truncated once the queue is empty
+func (q *spillQueue) Pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.head = nil
+	q.count--
+	if q.count > 0 {
+		return nil
+	}
+	if err := q.writer.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := q.writer.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := q.reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	q.buf.Reset(q.reader)
+	return nil
+}
+
+// Close Closes and removes the spill file
+// Spilled events are never acknowledged, so they are replayed from the checkpoint after a restart
+func (q *spillQueue) Close() error {
+	_ = q.reader.Close()
+	_ = q.writer.Close()
+	return os.Remove(q.path)
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/chihqiang/dbxgo/types"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// transaction Tracks the binlog transaction that events are currently read from
+// canal calls the handler from a single goroutine, so no locking is needed
+type transaction struct {
+	// gtid GTID announced for the next transaction, empty when GTIDs are disabled
+	gtid string
+	// id Identifier of the open transaction
+	id string
+	// seq Number of events emitted in the open transaction
+	seq int
+	// open Whether a transaction has emitted events and is waiting for its commit
+	open bool
+}
+
+// begin Opens the transaction if it is not open yet
+// pos: Last synced position, identifies the transaction when there is no GTID
+// Returns: Whether a new transaction was opened
+func (t *transaction) begin(pos mysql.Position) bool {
+	if t.open {
+		return false
+	}
+	t.open = true
+	t.seq = 0
+	t.id = t.gtid
+	if t.id == "" {
+		t.id = fmt.Sprintf("%s:%d", pos.Name, pos.Pos)
+	}
+	return true
+}
+
+// next Returns the 1-based sequence number of the next event in the open transaction
+func (t *transaction) next() int {
+	t.seq++
+	return t.seq
+}
+
+// end Closes the transaction and forgets its GTID
+// Returns: Whether a transaction was open, and the number of events it emitted
+func (t *transaction) end() (bool, int) {
+	open, seq := t.open, t.seq
+	t.open = false
+	t.gtid = ""
+	t.id = ""
+	t.seq = 0
+	return open, seq
+}
+
+// OnGTID Remembers the GTID of the transaction that follows (implements canal.EventHandler interface)
+// header: Event header information
+// gtidEvent: GTID event of MySQL or MariaDB
+// Returns: Possible errors
+func (s *MySQLSource) OnGTID(header *replication.EventHeader, gtidEvent mysql.BinlogGTIDEvent) error {
+	if s.stop.reached(s.canal.SyncedPosition(), header.Timestamp) {
+		return errStopBound
+	}
+	set, err := gtidEvent.GTIDNext()
+	if err != nil {
+		return fmt.Errorf("read gtid error: %w", err)
+	}
+	s.tx.gtid = set.String()
+	return nil
+}
+
+// OnXID Closes the transaction at its commit (implements canal.EventHandler interface)
+// A commit marker is emitted when transaction markers are enabled and the transaction emitted rows
+// header: Event header information
+// nextPos: Position after the commit
+// Returns: Possible errors
+func (s *MySQLSource) OnXID(header *replication.EventHeader, nextPos mysql.Position) error {
+	id, gtid := s.tx.id, s.tx.gtid
+	open, count := s.tx.end()
+	if !open || !s.cfg.TransactionMarkers {
+		return nil
+	}
+	event := s.newEvent(header, "", "")
+	event.GTID = gtid
+	event.TxID = id
+	event.Row.Type = types.CommitEventRowType
+	event.Row.Data = map[string]any{"events": count}
+	return s.emitter.emit(s.canal.Ctx(), event)
+}
+
+// beginTransaction Opens the transaction for an event about to be emitted
+// A begin marker is emitted first when transaction markers are enabled
+// header: Event header information
+// Returns: errStopBound when the transaction lies beyond the stop bound, or possible errors
+func (s *MySQLSource) beginTransaction(header *replication.EventHeader) error {
+	if !s.tx.open && s.stop.reached(s.canal.SyncedPosition(), header.Timestamp) {
+		return errStopBound
+	}
+	if !s.tx.begin(s.canal.SyncedPosition()) || !s.cfg.TransactionMarkers {
+		return nil
+	}
+	event := s.newEvent(header, "", "")
+	event.Row.Type = types.BeginEventRowType
+	return s.emitter.emit(s.canal.Ctx(), event)
+}
@@ -0,0 +1,34 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_IDFromPositionWithoutGTID(t *testing.T) {
+	var tx transaction
+	assert.True(t, tx.begin(mysql.Position{Name: "mysql-bin.000003", Pos: 120}))
+	assert.False(t, tx.begin(mysql.Position{Name: "mysql-bin.000003", Pos: 400}))
+	assert.Equal(t, "mysql-bin.000003:120", tx.id)
+	assert.Equal(t, 1, tx.next())
+	assert.Equal(t, 2, tx.next())
+
+	open, count := tx.end()
+	assert.True(t, open)
+	assert.Equal(t, 2, count)
+	assert.Empty(t, tx.id)
+}
+
+func TestTransaction_IDFromGTID(t *testing.T) {
+	var tx transaction
+	tx.gtid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"
+	tx.begin(mysql.Position{Name: "mysql-bin.000003", Pos: 120})
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:23", tx.id)
+
+	tx.end()
+	assert.Empty(t, tx.gtid)
+	open, _ := tx.end()
+	assert.False(t, open)
+}
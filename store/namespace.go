@@ -0,0 +1,42 @@
+package store
+
+// NamespaceStore Prefixes every key with a namespace so several sources can share one store
+// Closing it does not close the shared store, the owner of the shared store closes it.
+type NamespaceStore struct {
+	store  IStore
+	prefix string
+}
+
+// NewNamespaceStore Wraps a store so that its keys live under a namespace
+// An empty namespace returns the store itself, keeping the keys of a single unnamed source
+func NewNamespaceStore(store IStore, namespace string) IStore {
+	if namespace == "" {
+		return store
+	}
+	return &NamespaceStore{store: store, prefix: namespace + "/"}
+}
+
+// Set Stores the value under the namespaced key
+func (s *NamespaceStore) Set(key string, value []byte) error {
+	return s.store.Set(s.prefix+key, value)
+}
+
+// Get Reads the value of the namespaced key
+func (s *NamespaceStore) Get(key string) ([]byte, error) {
+	return s.store.Get(s.prefix + key)
+}
+
+// Has Checks if the namespaced key exists
+func (s *NamespaceStore) Has(key string) bool {
+	return s.store.Has(s.prefix + key)
+}
+
+// Delete Removes the namespaced key
+func (s *NamespaceStore) Delete(key string) error {
+	return s.store.Delete(s.prefix + key)
+}
+
+// Close Does nothing, the shared store is closed by its owner
+func (s *NamespaceStore) Close() error {
+	return nil
+}
@@ -14,6 +14,14 @@ const (
 	UpdateEventRowType EventRowType = "update"
 	// DeleteEventRowType Represents a delete operation type
 	DeleteEventRowType EventRowType = "delete"
+	// SnapshotEventRowType Represents a row read by the initial snapshot
+	SnapshotEventRowType EventRowType = "snapshot"
+	// DDLEventRowType Represents a schema change (CREATE/ALTER/DROP/TRUNCATE/RENAME TABLE, index changes)
+	DDLEventRowType EventRowType = "ddl"
+	// BeginEventRowType Marks the start of a transaction, only emitted when transaction markers are enabled
+	BeginEventRowType EventRowType = "begin"
+	// CommitEventRowType Marks the end of a transaction, only emitted when transaction markers are enabled
+	CommitEventRowType EventRowType = "commit"
 )
 
 // EventData Represents a standard event structure
@@ -24,6 +32,39 @@ type EventData struct {
 	ServerID int64        `json:"server_id"` // Server ID where the event was generated
 	Pos      int64        `json:"pos"`       // Log position for tracking
 	Row      EventRowData `json:"row"`       // The row data associated with the event
+	// File Binlog file the event was read from, Pos is an offset inside it
+	File string `json:"file,omitempty"`
+	// GTID Global transaction identifier of the transaction, empty when GTIDs are disabled
+	GTID string `json:"gtid,omitempty"`
+	// TxID Identifies the transaction the event was committed in: the GTID when GTIDs are
+	// enabled, otherwise the binlog "file:pos" at which the transaction starts
+	TxID string `json:"tx_id,omitempty"`
+	// TxSeq 1-based position of the event inside its transaction
+	TxSeq int `json:"tx_seq,omitempty"`
+	// Source Name of the source that captured the event, empty for a single unnamed source
+	Source string `json:"source,omitempty"`
+	// DeadLetter Why the event was dead-lettered, only set on events in the dead-letter queue
+	DeadLetter *DeadLetter `json:"dead_letter,omitempty"`
+	// PartitionKey Primary key values of the row, used to keep per-row ordering across workers
+	PartitionKey string `json:"-"`
+	// Token Acknowledgement token assigned by the source, handed back through ISource.Ack
+	// once the event has been delivered downstream
+	Token uint64 `json:"-"`
+}
+
+// DeadLetter Describes an event that could not be delivered to its output
+
+type DeadLetter struct {
+	// Error The last send error
+	Error string `json:"error"`
+	// Attempts Number of send attempts made
+	Attempts int `json:"attempts"`
+	// FirstAttemptAt Time of the first send attempt
+	FirstAttemptAt time.Time `json:"first_attempt_at"`
+	// FailedAt Time the event was given up on
+	FailedAt time.Time `json:"failed_at"`
+	// Output Type of the output the event was meant for
+	Output string `json:"output"`
 }
 
 // EventRowData Represents the row data of a database change event
@@ -36,10 +77,32 @@ type EventRowData struct {
 	Database string `json:"database"`
 	// Table The name of the table where the change occurred
 	Table string `json:"table"`
-	// Type The type of the event (insert/update/delete)
+	// Type The type of the event (insert/update/delete/snapshot/ddl/begin/commit)
 	Type EventRowType `json:"type"`
 	// Data The new data content, represented as a map of field names to values
+	// For commit markers it holds the number of events in the transaction under "events"
 	Data map[string]any `json:"data"`
 	// Old The old data content, only present for update events
 	Old map[string]any `json:"old,omitempty"`
+	// PrimaryKey The primary key column names, in key order
+	PrimaryKey []string `json:"primary_key,omitempty"`
+	// Key The primary key values of the row, taken from Data
+	Key map[string]any `json:"key,omitempty"`
+	// SQL The raw statement, only present for ddl events
+	SQL string `json:"sql,omitempty"`
+	// Columns The table columns; always present for ddl events, optional for row events
+	Columns []Column `json:"columns,omitempty"`
+}
+
+// Column Describes a table column
+
+type Column struct {
+	// Name The column name
+	Name string `json:"name"`
+	// Type The SQL type as declared, e.g. "bigint(20) unsigned"
+	Type string `json:"type"`
+	// Unsigned Whether the column is an unsigned number
+	Unsigned bool `json:"unsigned"`
+	// Nullable Whether the column accepts NULL
+	Nullable bool `json:"nullable"`
 }